@@ -5,10 +5,25 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
 
+	"gometeo/budget"
+	"gometeo/clientip"
+	"gometeo/clock"
+	"gometeo/crawl"
+	"gometeo/mfmap"
 	"gometeo/mfmap/schedule"
+	"gometeo/mfmap/scope"
+	"gometeo/quarantine"
+	"gometeo/ratelimit"
+	"gometeo/rewrite"
+	"gometeo/schema"
+	"gometeo/svgtools"
 )
 
 const (
@@ -29,21 +44,81 @@ const (
 	fastHotMaxAge      = 1 * time.Minute
 	fastColdMaxAge     = 5 * time.Minute
 	fastFailureBackoff = 2 * time.Minute
+	fastHitDedup       = 1 * time.Minute
+	fastRunMargin      = 1 * time.Minute
 
 	normalHotDuration    = 72 * time.Hour
 	normalHotMaxAge      = 60 * time.Minute
 	normalColdMaxAge     = 240 * time.Minute
 	normalFailureBackoff = 30 * time.Minute
+	normalHitDedup       = 30 * time.Minute
+	normalRunMargin      = 10 * time.Minute
+
+	// ColdMaxAge multiplier while the upstream request budget runs low
+	lowBudgetStretch = 4
 )
 
 type CliOpts struct {
 	Addr       string
 	Upstream   string
+	Hosts      rewrite.Hosts // forecast api base and upstream url rewriting rules
 	OneShot    bool
 	Limit      int
 	Vue        string
 	FastUpdate bool
 	CacheFile  string
+
+	// reverse proxies allowed to set client address headers
+	TrustedProxies []netip.Prefix
+	ProxyHeader    clientip.Header
+
+	// visits accounting for the hot/cold scheduler
+	HotVisitors int
+	Hits        *schedule.HitFilter
+
+	// hotness propagation to child maps
+	PropagateFactor float64
+	PropagateDepth  int
+
+	// per-client rate limits and load shedding, disabled by default
+	RateLimit ratelimit.Conf
+
+	// max concurrent map refreshes, and min delay between their starts
+	FetchWorkers  int
+	FetchInterval time.Duration
+
+	// max age of page data reused by api-only refreshes, 0 disables them
+	PageTTL time.Duration
+
+	// share of POIs or echeances below which a refresh is degraded
+	DegradedRatio float64
+
+	// crawl include/exclude rules
+	Scope *scope.Scope
+
+	// zone families crawled in addition to metropolitan France
+	Zones []mfmap.ZoneKind
+
+	// clock shifted to a past time, nil for the system clock
+	Clock clock.Clock
+
+	// unparsable upstream payloads, nil if disabled
+	Quarantine *quarantine.Store
+
+	// upstream payload shapes, nil if disabled
+	Schema *schema.Checker
+
+	// upstream requests per hour and per day, nil if unlimited
+	Budget *budget.Budget
+
+	// optimization of svg maps and pictos, nil if disabled
+	Svg *svgtools.OptimizeConf
+
+	// network settings of the upstream client
+	Network crawl.TransportConf
+
+	// upstream transport: the network, or recording or replaying a tape
+	Transport http.RoundTripper
 }
 
 var appOpts *CliOpts
@@ -86,15 +161,232 @@ func getOpts(args []string) (*CliOpts, error) {
 
 	// define cli flags — env vars override hardcoded defaults, explicit flags override env vars
 	f.StringVar(&opts.Addr, "addr", envDefault("GOMETEO_ADDR", DEFAULT_ADDR), "listening server address")
-	opts.Upstream = envDefault("GOMETEO_UPSTREAM", UPSTREAM_ROOT)
+	f.StringVar(&opts.Upstream, "upstream", envDefault("GOMETEO_UPSTREAM", UPSTREAM_ROOT), "base url of the upstream site")
+	f.StringVar(&opts.Hosts.ApiBase, "apiurl", envDefault("GOMETEO_API_URL", ""), "base url of the forecast api, e.g. http://localhost:1052/internet2018client/2.0 (empty = scraped from pages)")
+	rewrites := f.String("rewrite", envDefault("GOMETEO_REWRITE", ""), "comma-separated 'from=to' rules moving upstream urls to other hosts, e.g. https://rpcache-aa.meteofrance.com=http://localhost:1052 (empty = none)")
 	f.IntVar(&opts.Limit, "limit", 0, "limit number of maps")
+	include := f.String("crawlinclude", envDefault("GOMETEO_CRAWL_INCLUDE", ""), "comma-separated '[path|id|taxonomy:]glob' or '~regexp' rules of subzones to crawl (empty = all)")
+	exclude := f.String("crawlexclude", envDefault("GOMETEO_CRAWL_EXCLUDE", ""), "comma-separated rules of subzones not to crawl, same syntax as -crawlinclude")
+	scopeFile := f.String("crawlscope", envDefault("GOMETEO_CRAWL_SCOPE", ""), "file of crawl scope rules, one '+rule' (include) or '-rule' (exclude) per line, added to -crawlinclude and -crawlexclude (empty = none)")
+	zones := f.String("zones", envDefault("GOMETEO_ZONES", ""), "comma-separated zone families crawled besides metropolitan France: outremer, montagne, marine")
 	f.BoolVar(&opts.OneShot, "oneshot", false, "useful only for dev and debug")
 	f.StringVar(&opts.Vue, "vue", "prod", "select 'prod' or 'dev' build of vue.js")
 	f.BoolVar(&opts.FastUpdate, "fastupdate", false, "increase update rate (for dev)")
 	f.StringVar(&opts.CacheFile, "cache", "", "path to .gob cache file for oneshot mode (empty = disabled)")
+	trusted := f.String("trustedproxies", envDefault("GOMETEO_TRUSTED_PROXIES", ""), "comma-separated CIDRs of reverse proxies allowed to set client address headers")
+	proxyHeader := f.String("proxyheader", envDefault("GOMETEO_PROXY_HEADER", "xff"), "client address header set by trusted proxies: 'xff' or 'forwarded'")
+	hotVisitors := f.String("hotvisitors", envDefault("GOMETEO_HOT_VISITORS", "1"), "unique visitors needed to make a map hot")
+	botUA := f.String("botua", envDefault("GOMETEO_BOT_UA", schedule.DefaultBotPattern), "regexp of user agents not counted as visitors (empty = none)")
+	hotPropagation := f.String("hotpropagation", envDefault("GOMETEO_HOT_PROPAGATION", "0.5"), "share of hotness passed down to each child map level (0 = disabled)")
+	hotDepth := f.String("hotdepth", envDefault("GOMETEO_HOT_DEPTH", "2"), "max levels of child maps warmed up by a hot map")
+	monitors := f.String("monitorips", envDefault("GOMETEO_MONITOR_IPS", ""), "comma-separated CIDRs of monitoring clients not counted as visitors")
+
+	ratePages := f.String("ratepages", envDefault("GOMETEO_RATE_PAGES", ""), "per-client budget for html pages as 'req_per_sec/burst' (empty = unlimited)")
+	rateData := f.String("ratedata", envDefault("GOMETEO_RATE_DATA", ""), "per-client budget for map data as 'req_per_sec/burst' (empty = unlimited)")
+	rateStatic := f.String("ratestatic", envDefault("GOMETEO_RATE_STATIC", ""), "per-client budget for static assets as 'req_per_sec/burst' (empty = unlimited)")
+	maxInFlight := f.String("maxinflight", envDefault("GOMETEO_MAX_INFLIGHT", "0"), "max concurrent requests before shedding load with 503 (0 = unlimited)")
+	asOf := f.String("asof", envDefault("GOMETEO_AS_OF", ""), "run as of this RFC3339 time, e.g. against a -cache snapshot (empty = now)")
+	pageTTL := f.String("pagettl", envDefault("GOMETEO_PAGE_TTL", "0"), "max age of scraped pages reused by refreshes calling only the forecast api, e.g. 24h (0 = scrape every refresh)")
+	fetchWorkers := f.String("fetchworkers", envDefault("GOMETEO_FETCH_WORKERS", "1"), "max concurrent map refreshes")
+	fetchInterval := f.String("fetchinterval", envDefault("GOMETEO_FETCH_INTERVAL", "10s"), "min delay between the starts of two map refreshes")
+	quarantineDir := f.String("quarantine", envDefault("GOMETEO_QUARANTINE_DIR", ""), "directory keeping upstream payloads that fail parsing (empty = disabled)")
+	quarantineSize := f.String("quarantinesize", envDefault("GOMETEO_QUARANTINE_SIZE", "20"), "max total size of the quarantine directory, in MB")
+	schemaCheck := f.String("schemacheck", envDefault("GOMETEO_SCHEMA_CHECK", "false"), "report unknown, missing and changing fields of upstream payloads: 'true' or 'false'")
+	record := f.String("record", envDefault("GOMETEO_RECORD_DIR", ""), "directory recording every upstream exchange, for a later -replay (empty = disabled)")
+	replay := f.String("replay", envDefault("GOMETEO_REPLAY_DIR", ""), "directory of exchanges recorded with -record, served instead of the network (empty = disabled)")
+	proxy := f.String("proxy", envDefault("GOMETEO_PROXY", ""), "http, https or socks5 proxy url of upstream requests (empty = HTTP_PROXY/HTTPS_PROXY environment)")
+	f.StringVar(&opts.Network.BindAddr, "bindaddr", envDefault("GOMETEO_BIND_ADDR", ""), "local ip address of upstream connections (empty = any)")
+	dialTimeout := f.String("dialtimeout", envDefault("GOMETEO_DIAL_TIMEOUT", "30s"), "connect timeout of upstream requests")
+	tlsTimeout := f.String("tlstimeout", envDefault("GOMETEO_TLS_TIMEOUT", "10s"), "tls handshake timeout of upstream requests")
+	headerTimeout := f.String("headertimeout", envDefault("GOMETEO_HEADER_TIMEOUT", "0"), "timeout waiting for upstream response headers (0 = none)")
+	maxConns := f.String("maxconns", envDefault("GOMETEO_MAX_CONNS", "0"), "max connections per upstream host (0 = unlimited)")
+	maxIdleConns := f.String("maxidleconns", envDefault("GOMETEO_MAX_IDLE_CONNS", "0"), "max idle connections kept per upstream host (0 = default of 2)")
+	f.StringVar(&opts.Network.CAFile, "cafile", envDefault("GOMETEO_CA_FILE", ""), "PEM file of root certificates trusted for upstream, besides the system ones (empty = none)")
+	budgetHour := f.String("budgethour", envDefault("GOMETEO_BUDGET_HOUR", "0"), "max upstream requests per hour (0 = unlimited)")
+	budgetDay := f.String("budgetday", envDefault("GOMETEO_BUDGET_DAY", "0"), "max upstream requests per day (0 = unlimited)")
+	budgetLow := f.String("budgetlow", envDefault("GOMETEO_BUDGET_LOW", "0.2"), "share of the hourly or daily budget left below which only hot maps are refreshed")
+	svgOptimize := f.String("svgoptimize", envDefault("GOMETEO_SVG_OPTIMIZE", "true"), "strip and minify upstream svg maps and pictos: 'true' or 'false'")
+	svgPrecision := f.String("svgprecision", envDefault("GOMETEO_SVG_PRECISION", "1"), "decimals kept in svg coordinates by -svgoptimize (-1 = all)")
+	degraded := f.String("degradedratio", envDefault("GOMETEO_DEGRADED_RATIO", "0.5"), "share of POIs or forecasts of the stored map below which a refresh is backfilled or rejected (0 = disabled)")
 
 	f.Parse(args)
 
+	// validate flags --upstream, --apiurl and --rewrite
+	var err error
+	if err = checkBaseUrl(opts.Upstream, false); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -upstream: %w", err)
+	}
+	if err = checkBaseUrl(opts.Hosts.ApiBase, true); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -apiurl: %w", err)
+	}
+	if opts.Hosts.Rules, err = rewrite.ParseRules(*rewrites); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -rewrite: %w", err)
+	}
+
+	// validate flags --trustedproxies and --proxyheader
+	if opts.TrustedProxies, err = clientip.ParsePrefixes(*trusted); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -trustedproxies: %w", err)
+	}
+	if opts.ProxyHeader, err = clientip.ParseHeader(*proxyHeader); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -proxyheader: %w", err)
+	}
+
+	// validate flags --hotvisitors, --hotpropagation, --hotdepth, --botua and --monitorips
+	if opts.HotVisitors, err = strconv.Atoi(*hotVisitors); err != nil || opts.HotVisitors < 1 {
+		return nil, fmt.Errorf("invalid cli flag -hotvisitors '%s'", *hotVisitors)
+	}
+	if opts.PropagateFactor, err = strconv.ParseFloat(*hotPropagation, 64); err != nil || opts.PropagateFactor < 0 || opts.PropagateFactor > 1 {
+		return nil, fmt.Errorf("invalid cli flag -hotpropagation '%s', want in [0,1]", *hotPropagation)
+	}
+	if opts.PropagateDepth, err = strconv.Atoi(*hotDepth); err != nil || opts.PropagateDepth < 0 {
+		return nil, fmt.Errorf("invalid cli flag -hotdepth '%s'", *hotDepth)
+	}
+	ignored, err := clientip.ParsePrefixes(*monitors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cli flag -monitorips: %w", err)
+	}
+	if opts.Hits, err = schedule.NewHitFilter(*botUA, ignored); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -botua: %w", err)
+	}
+
+	// validate rate limiting flags
+	for _, rf := range []struct {
+		name string
+		val  string
+		dst  *ratelimit.Rate
+	}{
+		{"ratepages", *ratePages, &opts.RateLimit.Pages},
+		{"ratedata", *rateData, &opts.RateLimit.Data},
+		{"ratestatic", *rateStatic, &opts.RateLimit.Static},
+	} {
+		if *rf.dst, err = ratelimit.ParseRate(rf.val); err != nil {
+			return nil, fmt.Errorf("invalid cli flag -%s: %w", rf.name, err)
+		}
+	}
+	if opts.RateLimit.MaxInFlight, err = strconv.Atoi(*maxInFlight); err != nil || opts.RateLimit.MaxInFlight < 0 {
+		return nil, fmt.Errorf("invalid cli flag -maxinflight '%s'", *maxInFlight)
+	}
+
+	// validate flags --fetchworkers and --fetchinterval
+	if opts.FetchWorkers, err = strconv.Atoi(*fetchWorkers); err != nil || opts.FetchWorkers < 1 {
+		return nil, fmt.Errorf("invalid cli flag -fetchworkers '%s'", *fetchWorkers)
+	}
+	if opts.FetchInterval, err = time.ParseDuration(*fetchInterval); err != nil || opts.FetchInterval < 0 {
+		return nil, fmt.Errorf("invalid cli flag -fetchinterval '%s'", *fetchInterval)
+	}
+
+	// validate flag --pagettl
+	if opts.PageTTL, err = time.ParseDuration(*pageTTL); err != nil || opts.PageTTL < 0 {
+		return nil, fmt.Errorf("invalid cli flag -pagettl '%s'", *pageTTL)
+	}
+
+	// validate flag --degradedratio
+	if opts.DegradedRatio, err = strconv.ParseFloat(*degraded, 64); err != nil || opts.DegradedRatio < 0 || opts.DegradedRatio > 1 {
+		return nil, fmt.Errorf("invalid cli flag -degradedratio '%s', want in [0,1]", *degraded)
+	}
+
+	// validate flag --asof
+	if *asOf != "" {
+		t, err := time.Parse(time.RFC3339, *asOf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cli flag -asof: %w", err)
+		}
+		opts.Clock = clock.At(t)
+	}
+
+	// validate flags --quarantine and --quarantinesize
+	size, err := strconv.Atoi(*quarantineSize)
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("invalid cli flag -quarantinesize '%s'", *quarantineSize)
+	}
+	opts.Quarantine = quarantine.New(quarantine.Conf{
+		Dir:      *quarantineDir,
+		MaxBytes: int64(size) << 20,
+		Clock:    opts.Clock,
+	})
+
+	// validate flag --schemacheck
+	check, err := strconv.ParseBool(*schemaCheck)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cli flag -schemacheck '%s'", *schemaCheck)
+	}
+	if check {
+		opts.Schema = schema.New(opts.Clock)
+	}
+
+	// validate flags --budgethour, --budgetday and --budgetlow
+	bc := budget.Conf{Clock: opts.Clock}
+	if bc.Hourly, err = strconv.Atoi(*budgetHour); err != nil || bc.Hourly < 0 {
+		return nil, fmt.Errorf("invalid cli flag -budgethour '%s'", *budgetHour)
+	}
+	if bc.Daily, err = strconv.Atoi(*budgetDay); err != nil || bc.Daily < 0 {
+		return nil, fmt.Errorf("invalid cli flag -budgetday '%s'", *budgetDay)
+	}
+	if bc.LowRatio, err = strconv.ParseFloat(*budgetLow, 64); err != nil || bc.LowRatio <= 0 || bc.LowRatio >= 1 {
+		return nil, fmt.Errorf("invalid cli flag -budgetlow '%s', want a number between 0 and 1", *budgetLow)
+	}
+	opts.Budget = budget.New(bc)
+
+	// validate flags --svgoptimize and --svgprecision
+	optimize, err := strconv.ParseBool(*svgOptimize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cli flag -svgoptimize '%s'", *svgOptimize)
+	}
+	precision, err := strconv.Atoi(*svgPrecision)
+	if err != nil || precision < -1 || precision > 6 {
+		return nil, fmt.Errorf("invalid cli flag -svgprecision '%s', want -1 to 6", *svgPrecision)
+	}
+	if optimize {
+		opts.Svg = &svgtools.OptimizeConf{Precision: precision}
+	}
+
+	// validate upstream network flags
+	opts.Network.Proxy = *proxy
+	if opts.Network.DialTimeout, err = time.ParseDuration(*dialTimeout); err != nil || opts.Network.DialTimeout < 0 {
+		return nil, fmt.Errorf("invalid cli flag -dialtimeout '%s'", *dialTimeout)
+	}
+	if opts.Network.TLSHandshakeTimeout, err = time.ParseDuration(*tlsTimeout); err != nil || opts.Network.TLSHandshakeTimeout < 0 {
+		return nil, fmt.Errorf("invalid cli flag -tlstimeout '%s'", *tlsTimeout)
+	}
+	if opts.Network.ResponseHeaderTimeout, err = time.ParseDuration(*headerTimeout); err != nil || opts.Network.ResponseHeaderTimeout < 0 {
+		return nil, fmt.Errorf("invalid cli flag -headertimeout '%s'", *headerTimeout)
+	}
+	if opts.Network.MaxConnsPerHost, err = strconv.Atoi(*maxConns); err != nil || opts.Network.MaxConnsPerHost < 0 {
+		return nil, fmt.Errorf("invalid cli flag -maxconns '%s'", *maxConns)
+	}
+	if opts.Network.MaxIdleConnsPerHost, err = strconv.Atoi(*maxIdleConns); err != nil || opts.Network.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("invalid cli flag -maxidleconns '%s'", *maxIdleConns)
+	}
+	network, err := crawl.NewTransport(opts.Network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cli flag -proxy, -bindaddr or -cafile: %w", err)
+	}
+	opts.Transport = network
+
+	// validate flags --record and --replay
+	switch {
+	case *record != "" && *replay != "":
+		return nil, fmt.Errorf("invalid cli flags -record and -replay: use only one")
+	case *record != "":
+		opts.Transport = crawl.NewRecordTransport(*record, network)
+	case *replay != "":
+		rt, err := crawl.NewReplayTransport(*replay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cli flag -replay: %w", err)
+		}
+		opts.Transport = rt
+	}
+
+	// validate flags --crawlinclude, --crawlexclude and --crawlscope
+	if opts.Scope, err = scope.ParseFile(*scopeFile, *include, *exclude); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -crawlinclude, -crawlexclude or -crawlscope: %w", err)
+	}
+
+	// validate flag --zones
+	if opts.Zones, err = mfmap.ParseZoneKinds(*zones); err != nil {
+		return nil, fmt.Errorf("invalid cli flag -zones: %w", err)
+	}
+
 	// validate flag --limit
 	if opts.Limit < 0 {
 		return nil, fmt.Errorf("invalid cli flag -limit '%d'", opts.Limit)
@@ -112,6 +404,21 @@ func getOpts(args []string) (*CliOpts, error) {
 	return &opts, nil
 }
 
+// checkBaseUrl accepts absolute http(s) urls without query
+func checkBaseUrl(raw string, allowEmpty bool) error {
+	if raw == "" && allowEmpty {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		return fmt.Errorf("'%s' is not an absolute http(s) url", raw)
+	}
+	return nil
+}
+
 func Addr() string {
 	return appOpts.Addr
 }
@@ -120,6 +427,11 @@ func Upstream() string {
 	return appOpts.Upstream
 }
 
+// Hosts returns the forecast api base and the rewriting rules of upstream urls.
+func Hosts() rewrite.Hosts {
+	return appOpts.Hosts
+}
+
 func OneShot() bool {
 	return appOpts.OneShot
 }
@@ -128,6 +440,16 @@ func Limit() int {
 	return appOpts.Limit
 }
 
+// Zones returns the zone families crawled besides metropolitan France.
+func Zones() []mfmap.ZoneKind {
+	return appOpts.Zones
+}
+
+// CrawlScope returns the include/exclude rules of crawled subzones, nil for all.
+func CrawlScope() *scope.Scope {
+	return appOpts.Scope
+}
+
 // VueProd select which vue.js file is called from mail html template
 func VueJs() string {
 	if appOpts.Vue == "dev" {
@@ -141,23 +463,152 @@ func CacheFile() string {
 	return appOpts.CacheFile
 }
 
+// TrustedProxies returns the networks whose forwarding headers are honoured.
+func TrustedProxies() []netip.Prefix {
+	return appOpts.TrustedProxies
+}
+
+func ProxyHeader() clientip.Header {
+	return appOpts.ProxyHeader
+}
+
+// HitFilter returns the filter applied to data requests before they count as visits.
+func HitFilter() *schedule.HitFilter {
+	return appOpts.Hits
+}
+
+// RateLimit returns per-client rate limits and the in-flight requests cap.
+func RateLimit() ratelimit.Conf {
+	return appOpts.RateLimit
+}
+
+// FetchWorkers returns the max number of concurrent map refreshes.
+func FetchWorkers() int {
+	if appOpts == nil {
+		return 1
+	}
+	return appOpts.FetchWorkers
+}
+
+// FetchInterval returns the min delay between the starts of two map
+// refreshes.
+func FetchInterval() time.Duration {
+	if appOpts == nil {
+		return 10 * time.Second
+	}
+	return appOpts.FetchInterval
+}
+
+// DegradedRatio returns the share of POIs or echeances of a stored map
+// below which a refresh is degraded, 0 if disabled.
+func DegradedRatio() float64 {
+	if appOpts == nil {
+		return 0.5
+	}
+	return appOpts.DegradedRatio
+}
+
+// Quarantine returns the store of unparsable upstream payloads, nil if disabled.
+func Quarantine() *quarantine.Store {
+	if appOpts == nil {
+		return nil
+	}
+	return appOpts.Quarantine
+}
+
+// SchemaChecker returns the checker of upstream payload shapes, nil if disabled.
+func SchemaChecker() *schema.Checker {
+	if appOpts == nil {
+		return nil
+	}
+	return appOpts.Schema
+}
+
+// PageTTL returns the max age of page data reused by api-only refreshes,
+// 0 if disabled.
+func PageTTL() time.Duration {
+	if appOpts == nil {
+		return 0
+	}
+	return appOpts.PageTTL
+}
+
+// Budget returns the upstream request budget, nil if unlimited.
+func Budget() *budget.Budget {
+	if appOpts == nil {
+		return nil
+	}
+	return appOpts.Budget
+}
+
+// Svg returns the optimization settings of svg maps and pictos, nil if
+// disabled.
+func Svg() *svgtools.OptimizeConf {
+	if appOpts == nil {
+		return nil
+	}
+	return appOpts.Svg
+}
+
+// Network returns the network settings of the upstream client.
+func Network() crawl.TransportConf {
+	if appOpts == nil {
+		return crawl.TransportConf{}
+	}
+	return appOpts.Network
+}
+
+// Transport returns the upstream transport: the network, or recording or
+// replaying a tape. Nil uses http.DefaultTransport.
+func Transport() http.RoundTripper {
+	if appOpts == nil {
+		return nil
+	}
+	return appOpts.Transport
+}
+
+// Clock returns the clock of the app, the system clock unless -asof is set.
+func Clock() clock.Clock {
+	if appOpts == nil || appOpts.Clock == nil {
+		return clock.System
+	}
+	return appOpts.Clock
+}
+
 func KeepDays() (dayMin, dayMax int) {
 	return KEEP_DAY_MIN, KEEP_DAY_MAX
 }
 
 func UpdateRate() schedule.UpdateRates {
+	hotVisitors, factor, depth := 1, 0.5, 2
+	if appOpts != nil {
+		hotVisitors = appOpts.HotVisitors
+		factor, depth = appOpts.PropagateFactor, appOpts.PropagateDepth
+	}
 	if appOpts != nil && appOpts.FastUpdate {
 		return schedule.UpdateRates{
-			HotDuration:    fastHotDuration,
-			HotMaxAge:      fastHotMaxAge,
-			ColdMaxAge:     fastColdMaxAge,
-			FailureBackoff: fastFailureBackoff,
+			HotDuration:     fastHotDuration,
+			HotMaxAge:       fastHotMaxAge,
+			ColdMaxAge:      fastColdMaxAge,
+			FailureBackoff:  fastFailureBackoff,
+			HotVisitors:     hotVisitors,
+			HitDedup:        fastHitDedup,
+			RunMargin:       fastRunMargin,
+			PropagateFactor: factor,
+			PropagateDepth:  depth,
+			BudgetStretch:   lowBudgetStretch,
 		}
 	}
 	return schedule.UpdateRates{
-		HotDuration:    normalHotDuration,
-		HotMaxAge:      normalHotMaxAge,
-		ColdMaxAge:     normalColdMaxAge,
-		FailureBackoff: normalFailureBackoff,
+		HotDuration:     normalHotDuration,
+		HotMaxAge:       normalHotMaxAge,
+		ColdMaxAge:      normalColdMaxAge,
+		FailureBackoff:  normalFailureBackoff,
+		HotVisitors:     hotVisitors,
+		HitDedup:        normalHitDedup,
+		RunMargin:       normalRunMargin,
+		PropagateFactor: factor,
+		PropagateDepth:  depth,
+		BudgetStretch:   lowBudgetStretch,
 	}
 }
@@ -1,8 +1,17 @@
 package appconf
 
 import (
+	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"gometeo/clientip"
+	"gometeo/crawl"
+	"gometeo/svgtools"
 )
 
 func TestEmpty(t *testing.T) {
@@ -111,6 +120,40 @@ func TestUpstreamDefault(t *testing.T) {
 	}
 }
 
+func TestUpstreamFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		upstream string
+		apiBase  string
+		rules    int
+		wantErr  bool
+	}{
+		{args: []string{}, upstream: UPSTREAM_ROOT},
+		{args: []string{"-upstream", "http://localhost:1052", "-apiurl", "http://localhost:1052/api"}, upstream: "http://localhost:1052", apiBase: "http://localhost:1052/api"},
+		{args: []string{"-upstream", "localhost:1052"}, wantErr: true},
+		{args: []string{"-apiurl", "/api"}, wantErr: true},
+		{args: []string{"-apiurl", "http://localhost/api?x=1"}, wantErr: true},
+		{args: []string{"-rewrite", "https://*.meteofrance.com=http://localhost:1052, https://a.b=https://c.d"}, upstream: UPSTREAM_ROOT, rules: 2},
+		{args: []string{"-rewrite", "https://meteofrance.com"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		opts, err := getOpts(tc.args)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("getOpts(%v): expected error", tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getOpts(%v) error: %v", tc.args, err)
+			continue
+		}
+		if opts.Upstream != tc.upstream || opts.Hosts.ApiBase != tc.apiBase || len(opts.Hosts.Rules) != tc.rules {
+			t.Errorf("getOpts(%v) got %q, %q, %d rules, want %q, %q, %d", tc.args, opts.Upstream, opts.Hosts.ApiBase, len(opts.Hosts.Rules), tc.upstream, tc.apiBase, tc.rules)
+		}
+	}
+}
+
 func TestCacheId(t *testing.T) {
 	id := CacheId()
 	if len(id) != 8 {
@@ -118,3 +161,417 @@ func TestCacheId(t *testing.T) {
 	}
 	t.Logf("cacheId='%s'", id)
 }
+
+func TestTrustedProxies(t *testing.T) {
+	opts, err := getOpts([]string{"-trustedproxies", "172.16.0.0/12, 10.1.2.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.TrustedProxies) != 2 {
+		t.Fatalf("cmdline flag --trustedproxies got %v, want 2 prefixes", opts.TrustedProxies)
+	}
+	if _, err := getOpts([]string{"-trustedproxies", "172.16.0.0/40"}); err == nil {
+		t.Error("expected error on invalid CIDR")
+	}
+}
+
+func TestTrustedProxiesEnvVar(t *testing.T) {
+	os.Setenv("GOMETEO_TRUSTED_PROXIES", "10.0.0.0/8")
+	defer os.Unsetenv("GOMETEO_TRUSTED_PROXIES")
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.TrustedProxies) != 1 || opts.TrustedProxies[0].String() != "10.0.0.0/8" {
+		t.Errorf("env GOMETEO_TRUSTED_PROXIES: got %v, want [10.0.0.0/8]", opts.TrustedProxies)
+	}
+}
+
+func TestProxyHeader(t *testing.T) {
+	opts, err := getOpts([]string{"-proxyheader", "forwarded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ProxyHeader != clientip.HeaderForwarded {
+		t.Errorf("cmdline flag --proxyheader got %v, want forwarded", opts.ProxyHeader)
+	}
+	if _, err := getOpts([]string{"-proxyheader", "wesh"}); err == nil {
+		t.Error("expected error on unknown proxy header")
+	}
+}
+
+func TestHitAccounting(t *testing.T) {
+	opts, err := getOpts([]string{"-hotvisitors", "3", "-monitorips", "198.51.100.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.HotVisitors != 3 {
+		t.Errorf("cmdline flag --hotvisitors got %d, want 3", opts.HotVisitors)
+	}
+	if opts.Hits.Accept("198.51.100.4", "Mozilla/5.0") {
+		t.Error("monitor ip must not be accepted as a visitor")
+	}
+	if opts.Hits.Accept("192.0.2.1", "Googlebot/2.1") {
+		t.Error("default bot pattern must reject Googlebot")
+	}
+	t.Setenv("GOMETEO_HOT_VISITORS", "4")
+	if opts, err = getOpts([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.HotVisitors != 4 {
+		t.Errorf("env GOMETEO_HOT_VISITORS got %d, want 4", opts.HotVisitors)
+	}
+	for _, args := range [][]string{
+		{"-hotvisitors", "0"},
+		{"-monitorips", "wesh"},
+		{"-botua", "(unclosed"},
+	} {
+		if _, err := getOpts(args); err == nil {
+			t.Errorf("getOpts(%v): expected error", args)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.RateLimit.Enabled() {
+		t.Errorf("rate limiting must be disabled by default, got %+v", opts.RateLimit)
+	}
+	opts, err = getOpts([]string{"-ratedata", "2/10", "-maxinflight", "64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.RateLimit.Data.PerSec != 2 || opts.RateLimit.Data.Burst != 10 || opts.RateLimit.MaxInFlight != 64 {
+		t.Errorf("cmdline flags -ratedata/-maxinflight got %+v", opts.RateLimit)
+	}
+	for _, args := range [][]string{{"-ratepages", "x"}, {"-maxinflight", "-1"}} {
+		if _, err := getOpts(args); err == nil {
+			t.Errorf("getOpts(%v): expected error", args)
+		}
+	}
+}
+
+func TestFetchWorkers(t *testing.T) {
+	opts, err := getOpts([]string{"-fetchworkers", "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.FetchWorkers != 4 {
+		t.Errorf("cmdline flag -fetchworkers got %d, want 4", opts.FetchWorkers)
+	}
+	if opts, err = getOpts([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	// defaults keep the pacing of the former update tick
+	if opts.FetchWorkers != 1 || opts.FetchInterval != 10*time.Second {
+		t.Errorf("default -fetchworkers/-fetchinterval got %d/%s, want 1/10s", opts.FetchWorkers, opts.FetchInterval)
+	}
+	if _, err := getOpts([]string{"-fetchworkers", "0"}); err == nil {
+		t.Error("getOpts(-fetchworkers 0): expected error")
+	}
+	if _, err := getOpts([]string{"-fetchinterval", "-1s"}); err == nil {
+		t.Error("getOpts(-fetchinterval -1s): expected error")
+	}
+}
+
+func TestHotPropagation(t *testing.T) {
+	opts, err := getOpts([]string{"-hotpropagation", "0.3", "-hotdepth", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.PropagateFactor != 0.3 || opts.PropagateDepth != 1 {
+		t.Errorf("cmdline flags -hotpropagation/-hotdepth got %g/%d", opts.PropagateFactor, opts.PropagateDepth)
+	}
+	t.Setenv("GOMETEO_HOT_PROPAGATION", "0.25")
+	t.Setenv("GOMETEO_HOT_DEPTH", "3")
+	if opts, err = getOpts([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.PropagateFactor != 0.25 || opts.PropagateDepth != 3 {
+		t.Errorf("env GOMETEO_HOT_PROPAGATION/GOMETEO_HOT_DEPTH got %g/%d", opts.PropagateFactor, opts.PropagateDepth)
+	}
+	for _, args := range [][]string{{"-hotpropagation", "1.5"}, {"-hotdepth", "-1"}, {"-hotdepth", "deep"}} {
+		if _, err := getOpts(args); err == nil {
+			t.Errorf("getOpts(%v): expected error", args)
+		}
+	}
+}
+
+func TestDegradedRatio(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.DegradedRatio != 0.5 {
+		t.Errorf("default -degradedratio got %g, want 0.5", opts.DegradedRatio)
+	}
+	t.Setenv("GOMETEO_DEGRADED_RATIO", "0")
+	if opts, err = getOpts([]string{}); err != nil || opts.DegradedRatio != 0 {
+		t.Errorf("GOMETEO_DEGRADED_RATIO=0 got %v, %v", opts, err)
+	}
+	if _, err := getOpts([]string{"-degradedratio", "2"}); err == nil {
+		t.Error("getOpts(-degradedratio 2): expected error")
+	}
+}
+
+func TestPageTTL(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.PageTTL != 0 {
+		t.Errorf("default -pagettl got %v, want 0", opts.PageTTL)
+	}
+	t.Setenv("GOMETEO_PAGE_TTL", "24h")
+	if opts, err = getOpts([]string{}); err != nil || opts.PageTTL != 24*time.Hour {
+		t.Errorf("GOMETEO_PAGE_TTL=24h got %v, %v", opts, err)
+	}
+	for _, bad := range []string{"-1h", "day"} {
+		if _, err := getOpts([]string{"-pagettl", bad}); err == nil {
+			t.Errorf("getOpts(-pagettl %s): expected error", bad)
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Quarantine != nil {
+		t.Error("quarantine must be disabled by default")
+	}
+	t.Setenv("GOMETEO_QUARANTINE_DIR", t.TempDir())
+	if opts, err = getOpts([]string{"-quarantinesize", "5"}); err != nil || opts.Quarantine == nil {
+		t.Errorf("GOMETEO_QUARANTINE_DIR got %v, %v", opts, err)
+	}
+	if _, err := getOpts([]string{"-quarantinesize", "0"}); err == nil {
+		t.Error("getOpts(-quarantinesize 0): expected error")
+	}
+}
+
+func TestTape(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := opts.Transport.(*http.Transport); !ok {
+		t.Errorf("upstream transport is %T by default, want the network", opts.Transport)
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"-record", dir}, &crawl.RecordTransport{}},
+		{[]string{"-replay", dir}, &crawl.ReplayTransport{}},
+		{[]string{"-replay", dir + "/nowhere"}, nil},
+		{[]string{"-record", dir, "-replay", dir}, nil},
+	}
+	for _, tc := range tests {
+		opts, err := getOpts(tc.args)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("getOpts(%v): expected error", tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getOpts(%v) error: %v", tc.args, err)
+			continue
+		}
+		if got, want := fmt.Sprintf("%T", opts.Transport), fmt.Sprintf("%T", tc.want); got != want {
+			t.Errorf("getOpts(%v) transport is %s, want %s", tc.args, got, want)
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Schema != nil {
+		t.Error("schema checks must be disabled by default")
+	}
+	t.Setenv("GOMETEO_SCHEMA_CHECK", "true")
+	if opts, err = getOpts([]string{}); err != nil || opts.Schema == nil {
+		t.Errorf("GOMETEO_SCHEMA_CHECK=true got %v, %v", opts, err)
+	}
+	if _, err := getOpts([]string{"-schemacheck", "maybe"}); err == nil {
+		t.Error("getOpts(-schemacheck maybe): expected error")
+	}
+}
+
+func TestCrawlScope(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Scope != nil {
+		t.Errorf("crawl scope must be unrestricted by default, got %s", opts.Scope)
+	}
+	t.Setenv("GOMETEO_CRAWL_INCLUDE", "auvergne-rhone-alpes,taxonomy:DEPARTEMENT")
+	opts, err = getOpts([]string{"-crawlexclude", "cantal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Scope == nil {
+		t.Fatal("GOMETEO_CRAWL_INCLUDE and -crawlexclude ignored")
+	}
+	if _, err := getOpts([]string{"-crawlexclude", "nope:cantal"}); err == nil {
+		t.Error("getOpts(-crawlexclude nope:cantal): expected error")
+	}
+
+	// rules file, added to cli rules
+	file := filepath.Join(t.TempDir(), "scope.txt")
+	if err := os.WriteFile(file, []byte("# massifs too\n+taxonomy:MASSIF\n-id:~^DEPT0{1,2}1$\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOMETEO_CRAWL_SCOPE", file)
+	if opts, err = getOpts([]string{"-crawlexclude", "cantal"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "include=[auvergne-rhone-alpes,taxonomy:DEPARTEMENT,taxonomy:MASSIF] exclude=[cantal,id:~^DEPT0{1,2}1$]"
+	if got := opts.Scope.String(); got != want {
+		t.Errorf("GOMETEO_CRAWL_SCOPE got %s, want %s", got, want)
+	}
+	if _, err := getOpts([]string{"-crawlscope", filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("getOpts(-crawlscope missing): expected error")
+	}
+}
+
+func TestZones(t *testing.T) {
+	t.Setenv("GOMETEO_ZONES", "montagne,marine")
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Zones) != 2 {
+		t.Errorf("GOMETEO_ZONES got %v, want montagne and marine", opts.Zones)
+	}
+	if _, err := getOpts([]string{"-zones", "lune"}); err == nil {
+		t.Error("getOpts(-zones lune): expected error")
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	opts, err := getOpts([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Clock != nil {
+		t.Errorf("default clock got %v, want nil", opts.Clock)
+	}
+	opts, err = getOpts([]string{"-asof", "2025-01-15T12:00:00+01:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)
+	if d := opts.Clock.Now().Sub(want); d < 0 || d > time.Second {
+		t.Errorf("cmdline flag -asof clock got %s, want %s", opts.Clock.Now(), want)
+	}
+	if _, err := getOpts([]string{"-asof", "yesterday"}); err == nil {
+		t.Error("getOpts(-asof yesterday): expected error")
+	}
+}
+
+func TestNetworkFlags(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("no certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want crawl.TransportConf
+		ok   bool
+	}{
+		{[]string{}, crawl.TransportConf{DialTimeout: 30 * time.Second, TLSHandshakeTimeout: 10 * time.Second}, true},
+		{
+			[]string{"-proxy", "socks5://proxy.lan:1080", "-bindaddr", "127.0.0.1", "-headertimeout", "15s", "-maxconns", "8", "-maxidleconns", "4"},
+			crawl.TransportConf{Proxy: "socks5://proxy.lan:1080", BindAddr: "127.0.0.1", DialTimeout: 30 * time.Second, TLSHandshakeTimeout: 10 * time.Second, ResponseHeaderTimeout: 15 * time.Second, MaxConnsPerHost: 8, MaxIdleConnsPerHost: 4},
+			true,
+		},
+		{[]string{"-proxy", "ftp://proxy.lan"}, crawl.TransportConf{}, false},
+		{[]string{"-bindaddr", "localhost"}, crawl.TransportConf{}, false},
+		{[]string{"-dialtimeout", "-1s"}, crawl.TransportConf{}, false},
+		{[]string{"-tlstimeout", "soon"}, crawl.TransportConf{}, false},
+		{[]string{"-headertimeout", "1"}, crawl.TransportConf{}, false},
+		{[]string{"-maxconns", "-2"}, crawl.TransportConf{}, false},
+		{[]string{"-maxidleconns", "many"}, crawl.TransportConf{}, false},
+		{[]string{"-cafile", caFile}, crawl.TransportConf{}, false},
+	}
+	for _, tc := range tests {
+		opts, err := getOpts(tc.args)
+		if (err == nil) != tc.ok {
+			t.Errorf("getOpts(%v) error = %v, want ok %v", tc.args, err, tc.ok)
+			continue
+		}
+		if tc.ok && opts.Network != tc.want {
+			t.Errorf("getOpts(%v) network = %+v, want %+v", tc.args, opts.Network, tc.want)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		args   []string
+		hourly int
+		daily  int
+		ok     bool
+	}{
+		{[]string{}, 0, 0, true},
+		{[]string{"-budgethour", "500"}, 500, 0, true},
+		{[]string{"-budgethour", "500", "-budgetday", "5000", "-budgetlow", "0.1"}, 500, 5000, true},
+		{[]string{"-budgethour", "-1"}, 0, 0, false},
+		{[]string{"-budgetday", "lots"}, 0, 0, false},
+		{[]string{"-budgetlow", "1"}, 0, 0, false},
+		{[]string{"-budgetlow", "0"}, 0, 0, false},
+	}
+	for _, tc := range tests {
+		opts, err := getOpts(tc.args)
+		if (err == nil) != tc.ok {
+			t.Errorf("getOpts(%v) error = %v, want ok %v", tc.args, err, tc.ok)
+			continue
+		}
+		if !tc.ok {
+			continue
+		}
+		s := opts.Budget.State()
+		if s.Hour.Limit != tc.hourly || s.Day.Limit != tc.daily {
+			t.Errorf("getOpts(%v) budget = %d/hour %d/day, want %d, %d", tc.args, s.Hour.Limit, s.Day.Limit, tc.hourly, tc.daily)
+		}
+		if (tc.hourly == 0 && tc.daily == 0) != (opts.Budget == nil) {
+			t.Errorf("getOpts(%v) budget must be nil only when unlimited", tc.args)
+		}
+	}
+}
+
+func TestSvgFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want *svgtools.OptimizeConf
+		ok   bool
+	}{
+		{[]string{}, &svgtools.OptimizeConf{Precision: 1}, true},
+		{[]string{"-svgprecision", "-1"}, &svgtools.OptimizeConf{Precision: -1}, true},
+		{[]string{"-svgprecision", "3"}, &svgtools.OptimizeConf{Precision: 3}, true},
+		{[]string{"-svgoptimize", "false"}, nil, true},
+		{[]string{"-svgoptimize", "maybe"}, nil, false},
+		{[]string{"-svgprecision", "7"}, nil, false},
+		{[]string{"-svgprecision", "-2"}, nil, false},
+	}
+	for _, tc := range tests {
+		opts, err := getOpts(tc.args)
+		if (err == nil) != tc.ok {
+			t.Errorf("getOpts(%v) error = %v, want ok %v", tc.args, err, tc.ok)
+			continue
+		}
+		if tc.ok && !reflect.DeepEqual(opts.Svg, tc.want) {
+			t.Errorf("getOpts(%v) svg = %+v, want %+v", tc.args, opts.Svg, tc.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package budget caps the number of requests sent to upstream, per hour
+// and per day, so that a bug or a storm of hot maps cannot get us blocked.
+//
+// Windows are calendar hours and days in UTC: counts reset at the start of
+// each of them. A budget runs low when what is left of a window falls below
+// a share of its limit; the scheduler then refreshes only hot maps. Once a
+// window is spent, requests are refused until it resets.
+// A nil *Budget is valid and unlimited.
+package budget
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"gometeo/clock"
+)
+
+// DefaultLowRatio is the share of a window left below which the budget runs low
+const DefaultLowRatio = 0.2
+
+// ErrExhausted is returned for requests refused by a spent budget
+var ErrExhausted = errors.New("upstream request budget exhausted")
+
+// Recorder is notified when the budget runs low. *obs.Registry implements it.
+type Recorder interface {
+	RecordBudgetLow()
+}
+
+// Conf holds the limits of a Budget. Zero limits are unlimited.
+type Conf struct {
+	Hourly   int         // max upstream requests per hour
+	Daily    int         // max upstream requests per day
+	LowRatio float64     // share of a window left below which the budget runs low, 0 is DefaultLowRatio
+	Clock    clock.Clock // optional; nil is the system clock
+}
+
+// window counts requests from start over span
+type window struct {
+	span  time.Duration
+	limit int
+	start time.Time
+	used  int
+}
+
+// roll resets w if now is past its span
+func (w *window) roll(now time.Time) {
+	if start := now.UTC().Truncate(w.span); !start.Equal(w.start) {
+		w.start, w.used = start, 0
+	}
+}
+
+func (w *window) left() int {
+	return w.limit - w.used
+}
+
+func (w *window) low(ratio float64) bool {
+	return w.limit > 0 && float64(w.left()) < ratio*float64(w.limit)
+}
+
+func (w *window) spent() bool {
+	return w.limit > 0 && w.used >= w.limit
+}
+
+// Budget counts upstream requests. Safe for concurrent use.
+type Budget struct {
+	conf   Conf
+	mutex  sync.Mutex
+	hour   window
+	day    window
+	low    bool // last known state, to report transitions
+	denied int64
+	obs    Recorder // optional
+}
+
+// New returns a Budget with conf limits, nil if both are unlimited.
+func New(conf Conf) *Budget {
+	if conf.Hourly <= 0 && conf.Daily <= 0 {
+		return nil
+	}
+	if conf.LowRatio <= 0 {
+		conf.LowRatio = DefaultLowRatio
+	}
+	return &Budget{
+		conf: conf,
+		hour: window{span: time.Hour, limit: max(conf.Hourly, 0)},
+		day:  window{span: 24 * time.Hour, limit: max(conf.Daily, 0)},
+	}
+}
+
+// SetObs attaches a recorder of low budget events, usually the obs
+// registry. Nil-safe.
+func (b *Budget) SetObs(r Recorder) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.obs = r
+}
+
+// roll resets elapsed windows. Must be called with the mutex held.
+func (b *Budget) roll() {
+	now := clock.Or(b.conf.Clock).Now()
+	b.hour.roll(now)
+	b.day.roll(now)
+}
+
+// isLow must be called with the mutex held, after roll
+func (b *Budget) isLow() bool {
+	return b.hour.low(b.conf.LowRatio) || b.day.low(b.conf.LowRatio)
+}
+
+// Take consumes one request, or returns ErrExhausted if a window is spent.
+func (b *Budget) Take() error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.roll()
+	if b.hour.spent() || b.day.spent() {
+		b.denied++
+		return ErrExhausted
+	}
+	b.hour.used++
+	b.day.used++
+	low := b.isLow()
+	if low && !b.low {
+		slog.Warn("upstream request budget running low, refreshing hot maps only",
+			"hourUsed", b.hour.used, "dayUsed", b.day.used, "budget", b.String())
+		if b.obs != nil {
+			b.obs.RecordBudgetLow()
+		}
+	}
+	b.low = low
+	return nil
+}
+
+// Low reports whether a window of the budget is running low.
+func (b *Budget) Low() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.roll()
+	return b.isLow()
+}
+
+// Usage is the count and limit of a window, and when it resets
+type Usage struct {
+	Used  int
+	Limit int // 0 is unlimited
+	Reset time.Time
+}
+
+// State is a consistent read of a Budget
+type State struct {
+	Hour   Usage
+	Day    Usage
+	Low    bool
+	Spent  bool
+	Denied int64 // requests refused since startup
+}
+
+// State returns the current usage of the budget, the zero State for nil.
+func (b *Budget) State() State {
+	if b == nil {
+		return State{}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.roll()
+	return State{
+		Hour:   Usage{Used: b.hour.used, Limit: b.hour.limit, Reset: b.hour.start.Add(b.hour.span)},
+		Day:    Usage{Used: b.day.used, Limit: b.day.limit, Reset: b.day.start.Add(b.day.span)},
+		Low:    b.isLow(),
+		Spent:  b.hour.spent() || b.day.spent(),
+		Denied: b.denied,
+	}
+}
+
+// String describes the limits of b, for logs
+func (b *Budget) String() string {
+	if b == nil {
+		return "unlimited"
+	}
+	return fmtLimit(b.conf.Hourly) + "/hour " + fmtLimit(b.conf.Daily) + "/day"
+}
+
+func fmtLimit(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,89 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gometeo/testutils"
+)
+
+type lowRecorder struct{ lows int }
+
+func (r *lowRecorder) RecordBudgetLow() { r.lows++ }
+
+func TestNil(t *testing.T) {
+	var b *Budget
+	if b = New(Conf{}); b != nil {
+		t.Fatal("New() without limits must return nil")
+	}
+	b.SetObs(&lowRecorder{})
+	if err := b.Take(); err != nil || b.Low() || b.State() != (State{}) {
+		t.Error("nil budget must be unlimited")
+	}
+}
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    Conf
+		takes   int
+		advance time.Duration // before the last take
+		lastErr error
+		low     bool
+		lows    int
+	}{
+		{name: "within budget", conf: Conf{Hourly: 10}, takes: 7, low: false},
+		{name: "running low", conf: Conf{Hourly: 10}, takes: 9, low: true, lows: 1},
+		{name: "hour spent", conf: Conf{Hourly: 10}, takes: 11, lastErr: ErrExhausted, low: true, lows: 1},
+		{name: "next hour", conf: Conf{Hourly: 10}, takes: 11, advance: 30 * time.Minute, low: false, lows: 1},
+		{name: "day spent", conf: Conf{Hourly: 10, Daily: 10}, takes: 11, advance: 30 * time.Minute, lastErr: ErrExhausted, low: true, lows: 1},
+		{name: "low ratio", conf: Conf{Daily: 100, LowRatio: 0.5}, takes: 51, low: true, lows: 1},
+	}
+	for _, tc := range tests {
+		clk := testutils.NewFakeClock(time.Date(2025, 3, 10, 9, 40, 0, 0, time.UTC))
+		rec := &lowRecorder{}
+		tc.conf.Clock = clk
+		b := New(tc.conf)
+		b.SetObs(rec)
+		var err error
+		for i := range tc.takes {
+			if i == tc.takes-1 {
+				clk.Advance(tc.advance)
+			}
+			err = b.Take()
+		}
+		if !errors.Is(err, tc.lastErr) {
+			t.Errorf("%s: last Take() = %v, want %v", tc.name, err, tc.lastErr)
+		}
+		if got := b.Low(); got != tc.low {
+			t.Errorf("%s: Low() = %v, want %v", tc.name, got, tc.low)
+		}
+		if rec.lows != tc.lows {
+			t.Errorf("%s: recorded %d lows, want %d", tc.name, rec.lows, tc.lows)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 3, 10, 9, 40, 0, 0, time.UTC))
+	b := New(Conf{Hourly: 2, Daily: 100, Clock: clk})
+	for range 3 {
+		b.Take()
+	}
+	s := b.State()
+	want := State{
+		Hour:   Usage{Used: 2, Limit: 2, Reset: time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)},
+		Day:    Usage{Used: 2, Limit: 100, Reset: time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)},
+		Low:    true,
+		Spent:  true,
+		Denied: 1,
+	}
+	if s != want {
+		t.Errorf("State() = %+v, want %+v", s, want)
+	}
+	clk.Advance(time.Hour)
+	if s := b.State(); s.Hour.Used != 0 || s.Day.Used != 2 || s.Spent || s.Low {
+		t.Errorf("State() after an hour = %+v", s)
+	}
+}
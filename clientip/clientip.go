@@ -0,0 +1,227 @@
+// Package clientip resolves the real client address of an HTTP request.
+//
+// Proxy headers (X-Forwarded-For, Forwarded, X-Real-Ip) are only honoured
+// when the direct peer is a configured trusted proxy. Forwarding chains are
+// walked right to left and the first hop that is not itself a trusted proxy
+// is the client: entries further left were written by the client and cannot
+// be trusted.
+//
+// The address is resolved once per request by Resolver.Middleware and stored
+// in the request context, so logging, hit tracking and rate limiting all see
+// the same value through FromRequest.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Header selects which forwarding header is read from trusted proxies.
+type Header int
+
+const (
+	HeaderXForwardedFor Header = iota // X-Forwarded-For (default, set by traefik)
+	HeaderForwarded                   // RFC 7239 Forwarded
+)
+
+// Resolver extracts client addresses according to a trusted proxy list.
+// A zero Resolver trusts nobody and always returns the peer address.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  Header
+}
+
+// NewResolver returns a Resolver trusting the given networks.
+func NewResolver(trusted []netip.Prefix, header Header) *Resolver {
+	return &Resolver{
+		trusted: trusted,
+		header:  header,
+	}
+}
+
+// ParsePrefixes parses a comma-separated list of CIDRs or bare addresses.
+// Bare addresses are converted to single-host prefixes. Empty items are ignored.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR '%s': %w", item, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address '%s': %w", item, err)
+		}
+		a = a.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ParseHeader converts a cli/env value into a Header.
+func ParseHeader(s string) (Header, error) {
+	switch strings.ToLower(s) {
+	case "", "xff", "x-forwarded-for":
+		return HeaderXForwardedFor, nil
+	case "forwarded":
+		return HeaderForwarded, nil
+	default:
+		return 0, fmt.Errorf("unknown proxy header '%s', want 'xff' or 'forwarded'", s)
+	}
+}
+
+func (h Header) String() string {
+	if h == HeaderForwarded {
+		return "forwarded"
+	}
+	return "xff"
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy network.
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	if r == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that issued req.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer, ok := parseHost(req.RemoteAddr)
+	if !ok {
+		return remoteHost(req.RemoteAddr)
+	}
+	if !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	var hops []string
+	if r.header == HeaderForwarded {
+		hops = forwardedFor(req.Header.Values("Forwarded"))
+	} else {
+		hops = xForwardedFor(req.Header.Values("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		if xri := strings.TrimSpace(req.Header.Get("X-Real-Ip")); xri != "" {
+			if a, ok := parseHost(xri); ok {
+				return a.String()
+			}
+		}
+		return peer.String()
+	}
+
+	// walk the chain from the nearest hop; the first untrusted one is the client
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, ok := parseHost(hops[i])
+		if !ok {
+			// obfuscated or garbage identifier: nothing reliable beyond this point
+			break
+		}
+		client = a
+		if !r.isTrusted(a) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// xForwardedFor flattens possibly repeated X-Forwarded-For headers
+// into an ordered list of hops (client first).
+func xForwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+	return hops
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers.
+// Elements without a for= parameter are kept as empty hops so that
+// the walk stops there instead of skipping a proxy.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			elem = strings.TrimSpace(elem)
+			if elem == "" {
+				continue
+			}
+			var hop string
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(k, "for") {
+					continue
+				}
+				hop = strings.Trim(strings.TrimSpace(val), `"`)
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHost parses an address with optional port and ipv6 brackets:
+// "192.0.2.1", "192.0.2.1:80", "2001:db8::1", "[2001:db8::1]:80"
+func parseHost(s string) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Unmap(), true
+}
+
+func remoteHost(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
+}
+
+type ctxKey struct{}
+
+// Middleware resolves the client address once and stores it in the request
+// context for downstream handlers.
+func (r *Resolver) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), ctxKey{}, r.ClientIP(req))
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// FromRequest returns the client address resolved by Middleware.
+// Without the middleware, it falls back to the peer address and
+// ignores proxy headers.
+func FromRequest(req *http.Request) string {
+	if ip, ok := req.Context().Value(ctxKey{}).(string); ok {
+		return ip
+	}
+	return (*Resolver)(nil).ClientIP(req)
+}
@@ -0,0 +1,122 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func mustPrefixes(t *testing.T, s string) *Resolver {
+	t.Helper()
+	p, err := ParsePrefixes(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewResolver(p, HeaderXForwardedFor)
+}
+
+func TestParsePrefixes(t *testing.T) {
+	p, err := ParsePrefixes(" 10.0.0.0/8, 192.168.1.7 ,,::1,172.16.3.4/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.7/32", "::1/128", "172.16.0.0/12"}
+	if len(p) != len(want) {
+		t.Fatalf("got %d prefixes, want %d", len(p), len(want))
+	}
+	for i := range want {
+		if p[i].String() != want[i] {
+			t.Errorf("prefix[%d] = %s, want %s", i, p[i], want[i])
+		}
+	}
+	for _, bad := range []string{"10.0.0.0/33", "wesh", "1.2.3"} {
+		if _, err := ParsePrefixes(bad); err == nil {
+			t.Errorf("ParsePrefixes(%q): expected error", bad)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := mustPrefixes(t, "10.0.0.0/8,fd00::/8")
+
+	tests := map[string]struct {
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		"no proxy":                  {"203.0.113.9:5555", nil, "203.0.113.9"},
+		"untrusted peer spoofs":     {"203.0.113.9:5555", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.9"},
+		"untrusted peer real-ip":    {"203.0.113.9:5555", map[string]string{"X-Real-Ip": "1.1.1.1"}, "203.0.113.9"},
+		"trusted single hop":        {"10.0.0.2:80", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		"trusted with spoofed left": {"10.0.0.2:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7"}, "198.51.100.7"},
+		"two trusted proxies":       {"10.0.0.2:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.0.0.3"}, "198.51.100.7"},
+		"all trusted":               {"10.0.0.2:80", map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"}, "10.0.0.4"},
+		"garbage hop":               {"10.0.0.2:80", map[string]string{"X-Forwarded-For": "198.51.100.7, nope"}, "10.0.0.2"},
+		"trusted no header":         {"10.0.0.2:80", nil, "10.0.0.2"},
+		"trusted real-ip":           {"10.0.0.2:80", map[string]string{"X-Real-Ip": "198.51.100.7"}, "198.51.100.7"},
+		"ipv6 peer":                 {"[fd00::1]:80", map[string]string{"X-Forwarded-For": "2001:db8::5"}, "2001:db8::5"},
+		"mapped ipv4 peer":          {"[::ffff:10.0.0.2]:80", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remote
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+			if got := r.ClientIP(req); got != test.want {
+				t.Errorf("ClientIP() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClientIPForwarded(t *testing.T) {
+	p, _ := ParsePrefixes("10.0.0.0/8")
+	r := NewResolver(p, HeaderForwarded)
+
+	tests := map[string]struct {
+		forwarded string
+		want      string
+	}{
+		"simple":      {"for=198.51.100.7", "198.51.100.7"},
+		"quoted port": {`for="198.51.100.7:4711";proto=https`, "198.51.100.7"},
+		"ipv6":        {`for="[2001:db8:cafe::17]:4711"`, "2001:db8:cafe::17"},
+		"chain":       {"for=1.1.1.1, for=198.51.100.7;by=10.0.0.9, for=10.0.0.3", "198.51.100.7"},
+		"case":        {"For=198.51.100.7", "198.51.100.7"},
+		"obfuscated":  {"for=_hidden", "10.0.0.2"},
+		"missing for": {"proto=https", "10.0.0.2"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.2:80"
+			req.Header.Set("Forwarded", test.forwarded)
+			// X-Forwarded-For must be ignored in Forwarded mode
+			req.Header.Set("X-Forwarded-For", "9.9.9.9")
+			if got := r.ClientIP(req); got != test.want {
+				t.Errorf("ClientIP() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := mustPrefixes(t, "10.0.0.0/8")
+	var got string
+	h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = FromRequest(req)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:80"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.7" {
+		t.Errorf("FromRequest() behind middleware = %s, want 198.51.100.7", got)
+	}
+
+	// without middleware, proxy headers are ignored
+	if ip := FromRequest(req); ip != "10.0.0.2" {
+		t.Errorf("FromRequest() without middleware = %s, want 10.0.0.2", ip)
+	}
+}
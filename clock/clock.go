@@ -0,0 +1,41 @@
+// Package clock abstracts the current time, so that schedules, retention
+// windows and day boundaries can be tested without sleeping, and the server
+// can run "as of" a past timestamp against a snapshot.
+//
+// A Clock is injected through conf structs (MapConf, ContentConf, ServerConf).
+// A nil Clock means the system clock, see Or.
+package clock
+
+import "time"
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// System is the wall clock.
+var System Clock = systemClock{}
+
+// Or returns c, or System if c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// shiftedClock runs at the pace of the system clock from a fixed origin.
+type shiftedClock struct {
+	offset time.Duration
+}
+
+func (c shiftedClock) Now() time.Time { return time.Now().Add(c.offset) }
+
+// At returns a clock telling t now, and advancing in real time from there.
+func At(t time.Time) Clock {
+	return shiftedClock{offset: time.Until(t)}
+}
@@ -0,0 +1,29 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOr(t *testing.T) {
+	if Or(nil) != System {
+		t.Error("Or(nil) is not the system clock")
+	}
+	c := At(time.Now())
+	if Or(c) != c {
+		t.Error("Or(c) did not return c")
+	}
+}
+
+func TestAt(t *testing.T) {
+	past := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := At(past)
+	if d := c.Now().Sub(past); d < 0 || d > time.Second {
+		t.Errorf("At(%s).Now() got %s", past, c.Now())
+	}
+	first := c.Now()
+	time.Sleep(10 * time.Millisecond)
+	if !c.Now().After(first) {
+		t.Error("At() clock does not advance")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gometeo/geojson"
 	"gometeo/mfmap"
+	"gometeo/svgtools"
 	"log/slog"
 	"os"
 )
@@ -18,10 +19,72 @@ func init() {
 
 // utility type to store a MeteoContent without the ServeMux and exposed fields
 type meteoBlob struct {
-	Maps   []*mfmap.MfMap
+	Maps   []mapBlob
 	Pictos []mfmap.Picto
 }
 
+// mapBlob holds the data fields of a MfMap. Conf and Schedule are runtime
+// state injected again on load, and Conf holds values gob cannot encode.
+type mapBlob struct {
+	OriginalPath string
+	Data         *mfmap.MapData
+	Prevs        geojson.PrevList
+	Graphdata    geojson.Graphdata
+	Pictos       []string
+	SvgMap       []byte
+	SvgCrop      svgtools.CropRatio
+	SvgReport    svgtools.OptimizeReport
+	Geography    geojson.GeoCollection
+	Parent       string
+	Breadcrumb   mfmap.Breadcrumbs
+
+	// HasCrop is false in blobs saved before per-map crops, where SvgMap
+	// was cropped with mfmap.CropRatio. A zero SvgCrop is a valid crop.
+	HasCrop bool
+}
+
+func newMapBlob(m *mfmap.MfMap) mapBlob {
+	return mapBlob{
+		OriginalPath: m.OriginalPath,
+		Data:         m.Data,
+		Prevs:        m.Prevs,
+		Graphdata:    m.Graphdata,
+		Pictos:       m.Pictos,
+		SvgMap:       m.SvgMap,
+		SvgCrop:      m.SvgCrop,
+		SvgReport:    m.SvgReport,
+		Geography:    m.Geography,
+		Parent:       m.Parent,
+		Breadcrumb:   m.Breadcrumb,
+		HasCrop:      true,
+	}
+}
+
+// mfMap rebuilds a MfMap configured with conf
+func (b mapBlob) mfMap(conf mfmap.MapConf) *mfmap.MfMap {
+	m := &mfmap.MfMap{
+		Conf:         conf,
+		OriginalPath: b.OriginalPath,
+		Data:         b.Data,
+		Prevs:        b.Prevs,
+		Graphdata:    b.Graphdata,
+		Pictos:       b.Pictos,
+		SvgMap:       b.SvgMap,
+		SvgCrop:      b.SvgCrop,
+		SvgReport:    b.SvgReport,
+		Geography:    b.Geography,
+		Parent:       b.Parent,
+		Breadcrumb:   b.Breadcrumb,
+	}
+	m.Schedule.Rates = conf.Rates
+	m.Schedule.Clock = conf.Clock
+	m.Schedule.Budget = conf.Budget
+	if len(m.SvgMap) > 0 && !b.HasCrop {
+		m.SvgCrop = mfmap.CropRatio
+	}
+	return m
+}
+
 // LoadBlob and SaveBlob are useful for dev and maintenance
 func LoadBlob(fname string, cconf ContentConf, mconf mfmap.MapConf) *Meteo {
 	// load and decode the whole blob
@@ -38,9 +101,9 @@ func LoadBlob(fname string, cconf ContentConf, mconf mfmap.MapConf) *Meteo {
 		return nil
 	}
 	mc := New(cconf)
-	for _, m := range blob.Maps {
-		m.Conf = mconf
-		mc.maps.update(m, -1000, +1000)
+	for _, b := range blob.Maps {
+		mc.maps.update(b.mfMap(mconf), -1000, +1000)
+		mc.pictos.use(b.Pictos)
 	}
 	for _, p := range blob.Pictos {
 		mc.pictos.update(p)
@@ -60,10 +123,14 @@ func (mc *Meteo) SaveBlob(fname string) error {
 	defer f.Close()
 	enc := gob.NewEncoder(f)
 
+	maps := mc.maps.asSlice()
 	blob := meteoBlob{
-		Maps:   mc.maps.asSlice(),
+		Maps:   make([]mapBlob, 0, len(maps)),
 		Pictos: mc.pictos.asSlice(),
 	}
+	for _, m := range maps {
+		blob.Maps = append(blob.Maps, newMapBlob(m))
+	}
 	err = enc.Encode(blob)
 	if err != nil {
 		return fmt.Errorf("SaveBlob encode: %w", err)
@@ -7,12 +7,19 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"gometeo/budget"
+	"gometeo/clock"
 	"gometeo/mfmap"
 	"gometeo/mfmap/handlers"
+	"gometeo/mfmap/schedule"
+	"gometeo/mfmap/scope"
 	"gometeo/obs"
+	"gometeo/quarantine"
+	"gometeo/schema"
 )
 
 // ContentConf holds runtime configuration injected at construction time.
@@ -21,6 +28,17 @@ type ContentConf struct {
 	DayMax  int
 	CacheId string
 	Obs     *obs.Registry // optional; nil disables observability
+	Clock   clock.Clock   // optional; nil is the system clock
+
+	// DegradedRatio is the share of POIs or echeances of the stored map
+	// below which a refresh is degraded, see MfMap.CheckRefresh. 0 disables.
+	DegradedRatio float64
+
+	Quarantine *quarantine.Store // optional; listed on the status page
+	Schema     *schema.Checker   // optional; inventories listed on the status page
+	Upstream   []Setting         // optional; upstream client settings listed on the status page
+	Budget     *budget.Budget    // optional; usage shown on the status page
+	Pictos     PictoFetcher      // optional; nil serves 404 for pictos missing from the store
 }
 
 // Meteo is a http.Handler holding and serving live maps and pictos
@@ -34,7 +52,7 @@ type Meteo struct {
 // meteoMux is a mutex-protected, hot-swappable wrapper of a standard http.ServeMux
 type meteoMux struct {
 	serveMux *http.ServeMux
-	mutex    sync.Mutex
+	mutex    sync.RWMutex
 }
 
 // mapStore is the collection of donwloaded and parsed maps.
@@ -43,23 +61,32 @@ type meteoMux struct {
 type mapStore struct {
 	store map[string]*mfmap.MfMap
 	mutex sync.Mutex
+	queue *schedule.Queue // update queue, keyed by MfMap.OriginalPath
 }
 
 // pictoStore is the collection of available pictos.
 // Pictos are shared among all maps ( not a member of MfMap)
 // Key is the name of the picto (ex : p1j, p4n, ...)
 type pictoStore struct {
-	store map[string][]byte
-	mutex sync.Mutex
-	obs   *obs.Registry
+	store   map[string][]byte
+	mutex   sync.Mutex
+	obs     *obs.Registry
+	fetcher PictoFetcher         // optional; fetches pictos missing from store
+	clock   clock.Clock          // optional; nil is the system clock
+	flights map[string]bool      // on-demand fetches in progress
+	used    map[string]bool      // names referenced by stored maps, the only ones fetched on demand
+	misses  map[string]time.Time // failed on-demand fetches, until retry
+	cacheId string
+	sprite  []byte // all pictos as symbols, nil when store has changed since
+	hash    string // of sprite, in its url
 }
 
 // New returns an empty Meteo struct
 func New(conf ContentConf) *Meteo {
 	return &Meteo{
 		conf:   conf,
-		maps:   mapStore{store: make(map[string]*mfmap.MfMap)},
-		pictos: pictoStore{store: make(map[string][]byte)},
+		maps:   mapStore{store: make(map[string]*mfmap.MfMap), queue: schedule.NewQueue()},
+		pictos: pictoStore{store: make(map[string][]byte), fetcher: conf.Pictos, clock: conf.Clock},
 	}
 }
 
@@ -67,6 +94,10 @@ func (mc *Meteo) Close() {
 	slog.Info("MeteoContent closed")
 }
 
+func (mc *Meteo) now() time.Time {
+	return clock.Or(mc.conf.Clock).Now()
+}
+
 // Obs returns the observability registry attached at construction, or nil.
 func (mc *Meteo) Obs() *obs.Registry {
 	return mc.conf.Obs
@@ -119,7 +150,11 @@ func (mc *Meteo) ReceiveMaps(ch <-chan *mfmap.MfMap) <-chan struct{} {
 	go func() {
 		defer close(done)
 		for m := range ch {
+			if m = mc.checkRefresh(m); m == nil {
+				continue
+			}
 			mc.maps.update(m, mc.conf.DayMin, mc.conf.DayMax)
+			mc.pictos.use(m.Pictos)
 			mc.rebuildMux()
 		}
 	}()
@@ -145,8 +180,19 @@ func (mc *Meteo) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	mc.mux.ServeHTTP(resp, req)
 }
 
+// Queue returns the update queue of stored maps, keyed by MfMap.OriginalPath.
+func (mc *Meteo) Queue() *schedule.Queue {
+	return mc.maps.queue
+}
+
+// Updatable returns the OriginalPath of the next map to update,
+// or "" if no map is due yet.
 func (mc *Meteo) Updatable() string {
-	return mc.maps.updatable()
+	key, due, ok := mc.maps.queue.Peek()
+	if !ok || due.After(mc.now()) {
+		return ""
+	}
+	return key
 }
 
 // MarkFailure records that a fetch attempt for the given upstream path failed,
@@ -155,12 +201,53 @@ func (mc *Meteo) Updatable() string {
 func (mc *Meteo) MarkFailure(originalPath string) {
 	mc.maps.mutex.Lock()
 	defer mc.maps.mutex.Unlock()
-	for _, m := range mc.maps.store {
-		if m.OriginalPath == originalPath {
-			m.Schedule.MarkFailure()
-			return
+	if m := mc.maps.byOriginalPath(originalPath); m != nil {
+		m.Schedule.MarkFailure()
+	}
+}
+
+// StoredMap returns the stored map fetched from upstream originalPath, or nil.
+func (mc *Meteo) StoredMap(originalPath string) *mfmap.MfMap {
+	mc.maps.mutex.Lock()
+	defer mc.maps.mutex.Unlock()
+	return mc.maps.byOriginalPath(originalPath)
+}
+
+// Ancestors returns the zones above the stored map fetched from
+// originalPath, from the crawl root down, following parent links. Nil when
+// the map is unknown or at the root.
+func (mc *Meteo) Ancestors(originalPath string) []scope.Zone {
+	mc.maps.mutex.Lock()
+	defer mc.maps.mutex.Unlock()
+	m := mc.maps.byOriginalPath(originalPath)
+	if m == nil {
+		return nil
+	}
+	var zones []scope.Zone
+	// bounded by the store size, in case parent links loop
+	for range len(mc.maps.store) {
+		parent, ok := mc.maps.store[m.Parent]
+		if !ok || parent == m {
+			break
 		}
+		zones = append(zones, parent.Zone())
+		m = parent
 	}
+	slices.Reverse(zones)
+	return zones
+}
+
+// FetchDone releases a map popped from the update queue and schedules its
+// next update, after success (the new map is already stored) or failure.
+func (mc *Meteo) FetchDone(originalPath string) {
+	mc.maps.mutex.Lock()
+	defer mc.maps.mutex.Unlock()
+	m := mc.maps.byOriginalPath(originalPath)
+	if m == nil {
+		mc.maps.queue.Remove(originalPath)
+		return
+	}
+	mc.maps.queue.Complete(originalPath, m.Schedule.NextDue())
 }
 
 // StatusReport is the high-level data surfaced by the /statusse page.
@@ -205,9 +292,42 @@ func (mc *Meteo) rebuildMux() {
 	mc.pictos.register(newMux, mc.conf.CacheId, mc.conf.Obs)
 	mc.maps.register(newMux, mc.conf.Obs)
 	newMux.Handle("/statusse", mc.makeStatusHandler())
+	newMux.Handle("/statusse/queue", mc.makeQueueHandler())
 	mc.mux.setMux(newMux) // concurrent-safe accessor
 }
 
+// checkRefresh compares a refreshed map with the stored one, and returns
+// the map to store: m itself, m backfilled from the stored map if degraded,
+// or nil if m is rejected and the stored map is kept.
+func (mc *Meteo) checkRefresh(m *mfmap.MfMap) *mfmap.MfMap {
+	if mc.conf.DegradedRatio <= 0 {
+		return m
+	}
+	mc.maps.mutex.Lock()
+	defer mc.maps.mutex.Unlock()
+	old, ok := mc.maps.store[m.Path()]
+	if !ok {
+		return m
+	}
+	check := m.CheckRefresh(old, mc.conf.DegradedRatio)
+	if check.Verdict == mfmap.RefreshAccepted {
+		return m
+	}
+	reason := strings.Join(check.Reasons, ", ")
+	slog.Warn("degraded refresh", "path", m.Path(), "verdict", check.Verdict, "reason", reason)
+	rejected := check.Verdict == mfmap.RefreshRejected
+	if mc.conf.Obs != nil {
+		mc.conf.Obs.RecordDegradedRefresh(m.Path(), rejected, reason)
+	}
+	if rejected {
+		// retry after the failure backoff, like a failed fetch
+		old.Schedule.MarkFailure()
+		return nil
+	}
+	m.Backfill(old)
+	return m
+}
+
 // update()  adds or replace a map in the store.
 // rebuilds all breadcrumbs in all maps in the store.
 func (ms *mapStore) update(m *mfmap.MfMap, dayMin, dayMax int) {
@@ -223,7 +343,42 @@ func (ms *mapStore) update(m *mfmap.MfMap, dayMin, dayMax int) {
 	// TODO : optimize this quadractic algo
 	for name := range ms.store {
 		ms.buildBreadcrumbs(name)
+		ms.linkParent(name)
+	}
+	ms.schedule(m)
+}
+
+// linkParent points the schedule of a map to its parent's, so that hotness
+// propagates down. Maps must be relinked each time their parent is replaced.
+// NOT SAFE - ms.mutex must be acquired by callers.
+func (ms *mapStore) linkParent(path string) {
+	m := ms.store[path]
+	if parent, ok := ms.store[m.Parent]; ok && parent != m {
+		m.Schedule.SetParent(&parent.Schedule)
+	} else {
+		m.Schedule.SetParent(nil)
+	}
+}
+
+// descendants returns maps up to depth levels below path.
+// NOT SAFE - ms.mutex must be acquired by callers.
+func (ms *mapStore) descendants(path string, depth int) []*mfmap.MfMap {
+	var found []*mfmap.MfMap
+	level := []string{path}
+	for range depth {
+		var next []string
+		for _, m := range ms.store {
+			if slices.Contains(level, m.Parent) && m.Path() != m.Parent {
+				found = append(found, m)
+				next = append(next, m.Path())
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		level = next
 	}
+	return found
 }
 
 // Computes Breadcrumb chain for 'path' from other maps in the store
@@ -262,26 +417,56 @@ func (ms *mapStore) register(mux *http.ServeMux, reg *obs.Registry) {
 	}
 }
 
-// returns map with the highest negative delay to update
-func (ms *mapStore) updatable() (path string) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+// schedule (re)inserts m into the update queue and moves it forward, along
+// with its warmed up descendants, as soon as it turns hot. Maps without
+// OriginalPath (loaded from tests or blobs of older versions) cannot be
+// refetched and are not queued.
+func (ms *mapStore) schedule(m *mfmap.MfMap) {
+	if ms.queue == nil || m.OriginalPath == "" {
+		return
+	}
+	m.Schedule.OnHot(func() {
+		ms.queue.Schedule(m.OriginalPath, m.Schedule.NextDue())
+		ms.mutex.Lock()
+		children := ms.descendants(m.Path(), m.Schedule.Rates.PropagateDepth)
+		ms.mutex.Unlock()
+		for _, c := range children {
+			if c.OriginalPath != "" {
+				ms.queue.Schedule(c.OriginalPath, c.Schedule.NextDue())
+			}
+		}
+	})
+	ms.queue.Schedule(m.OriginalPath, m.Schedule.NextDue())
+}
 
-	var min time.Duration
+// byOriginalPath finds a map from the upstream path used to fetch it.
+// NOT SAFE - ms.mutex must be acquired by callers.
+func (ms *mapStore) byOriginalPath(originalPath string) *mfmap.MfMap {
 	for _, m := range ms.store {
-		d := m.Schedule.DurationToUpdate()
-		if d <= min {
-			min = d
-			path = m.OriginalPath
+		if m.OriginalPath == originalPath {
+			return m
 		}
 	}
-	return
+	return nil
 }
 
 func (ps *pictoStore) update(p mfmap.Picto) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 	ps.store[p.Name] = p.Img
+	ps.sprite = nil
+}
+
+// use marks names as referenced by a stored map
+func (ps *pictoStore) use(names []string) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.used == nil {
+		ps.used = make(map[string]bool)
+	}
+	for _, name := range names {
+		ps.used[name] = true
+	}
 }
 
 func (ps *pictoStore) register(mux *http.ServeMux, cacheId string, reg *obs.Registry) {
@@ -289,24 +474,49 @@ func (ps *pictoStore) register(mux *http.ServeMux, cacheId string, reg *obs.Regi
 	defer ps.mutex.Unlock()
 
 	ps.obs = reg
-	pattern := fmt.Sprintf("/pictos/%s/{pic}", cacheId)
-	mux.Handle(pattern, ps)
+	ps.cacheId = cacheId
+	mux.Handle("/pictos/{key}/{pic}", ps)
+}
+
+func (ps *pictoStore) now() time.Time {
+	return clock.Or(ps.clock).Now()
 }
 
 // ServeHTTP()
-// last segment of the request URL /picto/cacheid/{pic} selects the picto to return
+// last segment of the request URL /picto/cacheid/{pic} selects the picto to return.
+// Pictos missing from the store are fetched from upstream in the background,
+// if a fetcher is set and a stored map references them, and replaced with a
+// placeholder meanwhile, or when upstream does not have them. Other names
+// are not found.
+// /pictos/{hash}/sprite.svg is the sprite sheet of all pictos.
 func (ps *pictoStore) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
 
-	name := req.PathValue("pic")
+	key, name := req.PathValue("key"), req.PathValue("pic")
+	if name == spriteFile {
+		ps.serveSprite(resp, req, key)
+		return
+	}
+	if key != ps.cacheId {
+		resp.WriteHeader(http.StatusNotFound)
+		return
+	}
 	b, ok := ps.store[name]
-	if !ok {
+	switch {
+	case ok:
+		resp.Header().Add("Cache-Control", "max-age=31536000, immutable")
+	case ps.fetch(name):
+		b = unknownPicto
+		resp.Header().Add("Cache-Control", fmt.Sprintf("max-age=%d", int(pictoPendingTTL.Seconds())))
+	case ps.fetchable(name):
+		b = unknownPicto
+		resp.Header().Add("Cache-Control", fmt.Sprintf("max-age=%d", int(pictoMissTTL.Seconds())))
+	default:
 		resp.WriteHeader(http.StatusNotFound)
 		slog.Warn("picto not found", "name", name)
 		return
 	}
-	resp.Header().Add("Cache-Control", "max-age=31536000, immutable")
 	resp.Header().Add("Content-Type", "image/svg+xml")
 	resp.WriteHeader(http.StatusOK)
 	_, err := io.Copy(resp, bytes.NewReader(b))
@@ -322,8 +532,11 @@ func (mux *meteoMux) setMux(newMux *http.ServeMux) {
 	mux.serveMux = newMux
 }
 
+// ServeHTTP serves r with the current mux, without holding the lock, so
+// that slow handlers neither block other requests nor a mux swap
 func (mux *meteoMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	mux.mutex.Lock()
-	defer mux.mutex.Unlock()
-	mux.serveMux.ServeHTTP(w, r)
+	mux.mutex.RLock()
+	serveMux := mux.serveMux
+	mux.mutex.RUnlock()
+	serveMux.ServeHTTP(w, r)
 }
@@ -4,10 +4,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"gometeo/mfmap"
+	"gometeo/mfmap/schedule"
+	"gometeo/svgtools"
 	"gometeo/testutils"
 )
 
@@ -194,6 +198,90 @@ func TestUpdatable(t *testing.T) {
 	}
 }
 
+func TestUpdatableClock(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	conf := testContentConf
+	conf.Clock = clk
+	mc := New(conf)
+
+	rates := schedule.UpdateRates{HotMaxAge: time.Hour, ColdMaxAge: 4 * time.Hour}
+	m := stubMap("france", "", rates)
+	m.Conf.Clock = clk
+	m.Schedule.Clock = clk
+	m.Schedule.MarkUpdate()
+	mc.maps.update(m, -2, 2)
+
+	if got := mc.Updatable(); got != "" {
+		t.Fatalf("Updatable() on fresh map = %q, want empty", got)
+	}
+	clk.Advance(4*time.Hour - time.Second)
+	if got := mc.Updatable(); got != "" {
+		t.Fatalf("Updatable() before ColdMaxAge = %q, want empty", got)
+	}
+	clk.Advance(time.Second)
+	if got := mc.Updatable(); got != m.OriginalPath {
+		t.Fatalf("Updatable() at ColdMaxAge = %q, want %q", got, m.OriginalPath)
+	}
+}
+
+func TestBlobRoundTrip(t *testing.T) {
+	hits, err := schedule.NewHitFilter(schedule.DefaultBotPattern, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mconf := mfmap.MapConf{
+		CacheId: "testcache",
+		Rates:   schedule.UpdateRates{HotMaxAge: time.Hour, ColdMaxAge: 4 * time.Hour},
+		Hits:    hits,
+	}
+	mc := New(testContentConf)
+	m := stubMap("france", "", mconf.Rates)
+	m.Conf = mconf
+	mc.maps.update(m, -2, 2)
+	mc.pictos.update(mfmap.Picto{Name: "p1j", Img: []byte("<svg/>")})
+
+	fname := t.TempDir() + "/cache.gob"
+	if err := mc.SaveBlob(fname); err != nil {
+		t.Fatalf("SaveBlob() error: %v", err)
+	}
+	loaded := LoadBlob(fname, testContentConf, mconf)
+	if loaded == nil {
+		t.Fatal("LoadBlob() returned nil")
+	}
+	got := loaded.StoredMap(m.OriginalPath)
+	if got == nil {
+		t.Fatalf("LoadBlob() lost map %q", m.OriginalPath)
+	}
+	if got.Name() != "france" || got.Conf.Hits != hits || got.Schedule.Rates != mconf.Rates {
+		t.Errorf("LoadBlob() map %q not restored with its conf", got.Name())
+	}
+	if len(loaded.pictos.asSlice()) != 1 {
+		t.Errorf("LoadBlob() got %d pictos, want 1", len(loaded.pictos.asSlice()))
+	}
+}
+
+func TestBlobCrop(t *testing.T) {
+	crop := svgtools.CropRatio{Left: 0.1, Right: 0.1}
+	tests := []struct {
+		name string
+		blob mapBlob
+		want svgtools.CropRatio
+	}{
+		{name: "crop", blob: mapBlob{SvgMap: []byte("<svg/>"), SvgCrop: crop, HasCrop: true}, want: crop},
+		{name: "zero crop", blob: mapBlob{SvgMap: []byte("<svg/>"), HasCrop: true}, want: svgtools.CropRatio{}},
+		{name: "saved before per-map crops", blob: mapBlob{SvgMap: []byte("<svg/>")}, want: mfmap.CropRatio},
+		{name: "no svg", blob: mapBlob{}, want: svgtools.CropRatio{}},
+	}
+	for _, tc := range tests {
+		if got := tc.blob.mfMap(mfmap.MapConf{}).SvgCrop; got != tc.want {
+			t.Errorf("%s: SvgCrop = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if !newMapBlob(&mfmap.MfMap{}).HasCrop {
+		t.Error("newMapBlob() must mark per-map crops")
+	}
+}
+
 func TestServeHTTP(t *testing.T) {
 	mc := New(testContentConf)
 	m := testutils.BuildTestMap(t)
@@ -297,3 +385,93 @@ func TestMergeOnUpdate(t *testing.T) {
 		t.Fatalf("after two updates with same path, expected 1 map, got %d", storedCount)
 	}
 }
+
+// stubMap returns a map without forecasts, enough for scheduling tests
+func stubMap(name, parent string, rates schedule.UpdateRates) *mfmap.MfMap {
+	m := &mfmap.MfMap{
+		OriginalPath: "/previsions-meteo-france/" + name,
+		Parent:       parent,
+		Data:         &mfmap.MapData{Info: mfmap.MapInfo{Name: name, Path: "/previsions-meteo-france/" + name + "/1"}},
+	}
+	m.Schedule.Rates = rates
+	m.Schedule.MarkUpdate()
+	return m
+}
+
+func TestHotPropagation(t *testing.T) {
+	rates := schedule.UpdateRates{
+		HotDuration:     time.Hour,
+		HotMaxAge:       time.Hour,
+		ColdMaxAge:      5 * time.Hour,
+		HotVisitors:     1,
+		PropagateFactor: 0.5,
+		PropagateDepth:  2,
+	}
+	mc := New(testContentConf)
+	france := stubMap("france", "", rates)
+	region := stubMap("region", "france", rates)
+	dept := stubMap("dept", "region", rates)
+	for _, m := range []*mfmap.MfMap{dept, region, france} {
+		mc.maps.update(m, -2, 2)
+	}
+	dueBefore := queueDue(t, mc, dept.OriginalPath)
+
+	france.Schedule.MarkHit("192.0.2.1")
+	if got := region.Schedule.Warmth(); got != 0.5 {
+		t.Errorf("region Warmth() = %v, want 0.5", got)
+	}
+	if got := dept.Schedule.Warmth(); got != 0.25 {
+		t.Errorf("dept Warmth() = %v, want 0.25", got)
+	}
+	if dueAfter := queueDue(t, mc, dept.OriginalPath); !dueAfter.Before(dueBefore) {
+		t.Errorf("dept update not brought forward when its grand-parent turned hot")
+	}
+
+	// replaced parents are relinked
+	newRegion := stubMap("region", "", rates)
+	mc.maps.update(newRegion, -2, 2)
+	if got := dept.Schedule.Warmth(); got != 0.25 {
+		t.Errorf("after parent refresh, dept Warmth() = %v, want 0.25", got)
+	}
+}
+
+func queueDue(t *testing.T, mc *Meteo, key string) time.Time {
+	t.Helper()
+	for _, e := range mc.Queue().Entries() {
+		if e.Key == key {
+			return e.Due
+		}
+	}
+	t.Fatalf("%s not in update queue", key)
+	return time.Time{}
+}
+
+func TestAncestors(t *testing.T) {
+	mc := New(testContentConf)
+	france := stubMap("france", "", schedule.UpdateRates{})
+	region := stubMap("region", "france", schedule.UpdateRates{})
+	dept := stubMap("dept", "region", schedule.UpdateRates{})
+	for _, m := range []*mfmap.MfMap{dept, region, france} {
+		mc.maps.update(m, -2, 2)
+	}
+	tests := []struct {
+		m    *mfmap.MfMap
+		want []string
+	}{
+		{dept, []string{"france", "region"}},
+		{region, []string{"france"}},
+		{france, nil},
+	}
+	for _, tc := range tests {
+		var got []string
+		for _, z := range mc.Ancestors(tc.m.OriginalPath) {
+			got = append(got, z.Path)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Ancestors(%s) = %v, want %v", tc.m.OriginalPath, got, tc.want)
+		}
+	}
+	if got := mc.Ancestors("/unknown"); got != nil {
+		t.Errorf("Ancestors(/unknown) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,143 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"gometeo/svgtools"
+)
+
+// PictoFetcher downloads a picto from upstream. *crawl.Crawler implements it.
+type PictoFetcher interface {
+	FetchPicto(ctx context.Context, name string) ([]byte, error)
+}
+
+// unknownPicto is served for pictos that upstream does not have either
+//
+//go:embed unknown.svg
+var unknownPicto []byte
+
+const (
+	pictoFetchTimeout = 20 * time.Second
+	pictoMissTTL      = 10 * time.Minute // no upstream request for a failed picto meanwhile
+	pictoPendingTTL   = 30 * time.Second // cache of the placeholder served during a fetch
+	maxPictoMisses    = 500              // failed pictos remembered, further names are not fetched
+)
+
+// validPictoName keeps arbitrary request paths from reaching upstream
+var validPictoName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// fetchable reports whether name may be fetched on demand: names no stored
+// map references are refused, so that made-up names do not spend the
+// upstream budget
+func (ps *pictoStore) fetchable(name string) bool {
+	return ps.fetcher != nil && ps.used[name] && validPictoName.MatchString(name)
+}
+
+// fetch starts downloading the picto name in the background, once for all
+// concurrent callers, and returns without waiting for it. Returns true while
+// the download runs, false when it was refused or failed less than
+// pictoMissTTL ago. Must be called with the mutex held.
+func (ps *pictoStore) fetch(name string) bool {
+	if !ps.fetchable(name) {
+		return false
+	}
+	if ps.flights[name] {
+		return true
+	}
+	now := ps.now()
+	if now.Before(ps.misses[name]) {
+		return false
+	}
+	if len(ps.misses) >= maxPictoMisses {
+		ps.pruneMisses(now)
+	}
+	if len(ps.misses) >= maxPictoMisses {
+		slog.Warn("too many missing pictos, not fetched", "name", name)
+		return false
+	}
+	if ps.flights == nil {
+		ps.flights = make(map[string]bool)
+	}
+	ps.flights[name] = true
+	go ps.download(name)
+	return true
+}
+
+// download runs an on-demand fetch, detached from the requests that
+// started it, and stores the result
+func (ps *pictoStore) download(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pictoFetchTimeout)
+	defer cancel()
+	img, err := ps.fetcher.FetchPicto(ctx, name)
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	delete(ps.flights, name)
+	if err != nil {
+		slog.Warn("picto fetch on demand failed", "name", name, "err", err)
+		if ps.misses == nil {
+			ps.misses = make(map[string]time.Time)
+		}
+		ps.misses[name] = ps.now().Add(pictoMissTTL)
+	} else {
+		slog.Info("picto fetched on demand", "name", name)
+		ps.store[name] = img
+		ps.sprite = nil
+		delete(ps.misses, name)
+	}
+}
+
+// pruneMisses forgets failures older than pictoMissTTL
+func (ps *pictoStore) pruneMisses(now time.Time) {
+	for name, until := range ps.misses {
+		if !now.Before(until) {
+			delete(ps.misses, name)
+		}
+	}
+}
+
+// spriteFile is the last segment of the sprite url, /pictos/{hash}/sprite.svg
+const spriteFile = "sprite.svg"
+
+// spritePath returns the url of the current sprite, built if the store has
+// changed since the last one. Must be called with the mutex held.
+func (ps *pictoStore) spritePath() string {
+	if ps.sprite == nil {
+		sprite, err := svgtools.Sprite(ps.store)
+		if err != nil {
+			slog.Warn("pictos missing from sprite", "err", err)
+		}
+		sum := sha256.Sum256(sprite)
+		ps.sprite, ps.hash = sprite, hex.EncodeToString(sum[:6])
+	}
+	return "/pictos/" + ps.hash + "/" + spriteFile
+}
+
+// serveSprite serves the sprite of all pictos if key is its hash, and
+// redirects to it otherwise: /pictos/{cacheId}/sprite.svg is a stable
+// url, and pages referencing an older sprite get the current one.
+// Must be called with the mutex held.
+func (ps *pictoStore) serveSprite(resp http.ResponseWriter, req *http.Request, key string) {
+	path := ps.spritePath()
+	if key != ps.hash {
+		resp.Header().Add("Cache-Control", "no-cache")
+		http.Redirect(resp, req, path, http.StatusFound)
+		return
+	}
+	resp.Header().Add("Cache-Control", "max-age=31536000, immutable")
+	resp.Header().Add("Content-Type", "image/svg+xml")
+	resp.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(resp, bytes.NewReader(ps.sprite)); err != nil {
+		return
+	}
+	ps.obs.RecordPictoServed()
+}
@@ -0,0 +1,185 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gometeo/mfmap"
+	"gometeo/testutils"
+)
+
+// fakePictos serves "<svg>name</svg>" for names in known, once release is
+// closed, and counts the fetches
+type fakePictos struct {
+	known   map[string]bool
+	release chan struct{}
+	fetches atomic.Int64
+}
+
+func (fp *fakePictos) FetchPicto(ctx context.Context, name string) ([]byte, error) {
+	fp.fetches.Add(1)
+	<-fp.release
+	if !fp.known[name] {
+		return nil, errors.New("404 Not Found")
+	}
+	return []byte("<svg>" + name + "</svg>"), nil
+}
+
+func getPicto(t *testing.T, cl *http.Client, url string) (int, string, string) {
+	t.Helper()
+	resp, err := cl.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("Cache-Control"), string(body)
+}
+
+func TestPictoFetch(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC))
+	fp := &fakePictos{known: map[string]bool{"p1j": true, "p2n": true}, release: make(chan struct{})}
+	conf := testContentConf
+	conf.Clock = clk
+	conf.Pictos = fp
+	mc := New(conf)
+	mc.pictos.use([]string{"p1j", "p2n", "p99j"})
+	mc.rebuildMux()
+	srv := httptest.NewServer(mc)
+	defer srv.Close()
+	cl := srv.Client()
+	base := srv.URL + "/pictos/" + conf.CacheId + "/"
+
+	// misses get the placeholder at once, and share a single upstream fetch
+	// that does not hold other requests
+	const clients = 5
+	var wg sync.WaitGroup
+	codes := make([]int, clients)
+	bodies := make([]string, clients)
+	for i := range clients {
+		wg.Go(func() {
+			codes[i], _, bodies[i] = getPicto(t, cl, base+"p1j")
+		})
+	}
+	wg.Wait()
+	for i := range clients {
+		if codes[i] != http.StatusOK || bodies[i] != string(unknownPicto) {
+			t.Errorf("request %d during the fetch: got %d %q, want the placeholder", i, codes[i], bodies[i])
+		}
+	}
+	if code, _, _ := getPicto(t, cl, srv.URL+"/pictos/"+conf.CacheId+"/sprite.svg"); code != http.StatusOK {
+		t.Errorf("sprite during the fetch: status %d", code)
+	}
+	if n := fp.fetches.Load(); n != 1 {
+		t.Errorf("%d upstream fetches for concurrent misses, want 1", n)
+	}
+	close(fp.release)
+	// wait returns once the background fetch of name is over
+	wait := func(name string) {
+		for {
+			mc.pictos.mutex.Lock()
+			pending := mc.pictos.flights[name]
+			mc.pictos.mutex.Unlock()
+			if !pending {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait("p1j")
+
+	tests := []struct {
+		name    string
+		picto   string
+		advance time.Duration
+		code    int
+		body    string
+		fetches int64
+	}{
+		{name: "stored after fetch", picto: "p1j", code: 200, body: "<svg>p1j</svg>", fetches: 0},
+		{name: "fetching", picto: "p2n", code: 200, body: string(unknownPicto), fetches: 1},
+		{name: "fetched", picto: "p2n", code: 200, body: "<svg>p2n</svg>", fetches: 0},
+		{name: "upstream miss", picto: "p99j", code: 200, body: string(unknownPicto), fetches: 1},
+		{name: "negative cache", picto: "p99j", advance: pictoMissTTL / 2, code: 200, body: string(unknownPicto), fetches: 0},
+		{name: "retried after ttl", picto: "p99j", advance: pictoMissTTL, code: 200, body: string(unknownPicto), fetches: 1},
+		{name: "invalid name", picto: "p1j.svg", code: 404, fetches: 0},
+		{name: "unreferenced name", picto: "p42j", code: 404, fetches: 0},
+	}
+	for _, tc := range tests {
+		clk.Advance(tc.advance)
+		before := fp.fetches.Load()
+		code, cacheCtrl, body := getPicto(t, cl, base+tc.picto)
+		if code != tc.code || (tc.body != "" && body != tc.body) {
+			t.Errorf("%s: got %d %q, want %d %q", tc.name, code, body, tc.code, tc.body)
+		}
+		if got := fp.fetches.Load() - before; got != tc.fetches {
+			t.Errorf("%s: %d upstream fetches, want %d", tc.name, got, tc.fetches)
+		}
+		if code == 200 && strings.Contains(cacheCtrl, "immutable") != (tc.body != string(unknownPicto)) {
+			t.Errorf("%s: Cache-Control = %q, immutable for real pictos only", tc.name, cacheCtrl)
+		}
+		wait(tc.picto)
+	}
+}
+
+func TestPictoSprite(t *testing.T) {
+	mc := New(testContentConf)
+	mc.pictos.update(mfmap.Picto{Name: "p1j", Img: []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 32"><circle id="a" r="8"/></svg>`)})
+	mc.rebuildMux()
+	srv := httptest.NewServer(mc)
+	defer srv.Close()
+	cl := srv.Client()
+	cl.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	alias := srv.URL + "/pictos/" + testContentConf.CacheId + "/sprite.svg"
+
+	spriteURL := func() string {
+		t.Helper()
+		resp, err := cl.Get(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		loc := resp.Header.Get("Location")
+		if resp.StatusCode != http.StatusFound || !strings.HasSuffix(loc, "/sprite.svg") {
+			t.Fatalf("GET %s: got %d to %q, want a redirect to the sprite", alias, resp.StatusCode, loc)
+		}
+		return srv.URL + loc
+	}
+	first := spriteURL()
+	code, cacheCtrl, body := getPicto(t, cl, first)
+	if code != http.StatusOK || !strings.Contains(cacheCtrl, "immutable") {
+		t.Fatalf("GET %s: got %d %q", first, code, cacheCtrl)
+	}
+	if !strings.Contains(body, `<symbol id="p1j" viewBox="0 0 32 32">`) || !strings.Contains(body, `id="p1j.a"`) {
+		t.Errorf("sprite does not hold p1j: %s", body)
+	}
+	if again := spriteURL(); again != first {
+		t.Errorf("sprite url changed without new pictos: %s, %s", first, again)
+	}
+
+	// a new picto changes the sprite url, the former one redirects to it
+	mc.pictos.update(mfmap.Picto{Name: "p2n", Img: []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 32"/>`)})
+	second := spriteURL()
+	if second == first {
+		t.Fatal("sprite url must change with the pictos")
+	}
+	if _, _, body := getPicto(t, cl, second); !strings.Contains(body, `<symbol id="p2n"`) {
+		t.Errorf("sprite does not hold p2n: %s", body)
+	}
+	resp, err := cl.Get(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || srv.URL+resp.Header.Get("Location") != second {
+		t.Errorf("GET %s: got %d to %q, want a redirect to %s", first, resp.StatusCode, resp.Header.Get("Location"), second)
+	}
+}
@@ -0,0 +1,151 @@
+package content
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gometeo/mfmap"
+	"gometeo/mfmap/schedule"
+	"gometeo/obs"
+	"gometeo/testutils"
+)
+
+// forecastJSON returns a multiforecast with a daily and an afternoon
+// forecast on 2025-01-15 for each POI
+func forecastJSON(pois ...string) string {
+	feats := make([]string, 0, len(pois))
+	for _, insee := range pois {
+		feats = append(feats, fmt.Sprintf(`{
+	"update_time": "2025-01-15T05:00:00.000Z", "type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [2.35, 48.85]},
+	"properties": {
+		"name": "poi %[1]s", "country": "FR - France", "french_department": "75",
+		"timezone": "Europe/Paris", "insee": "%[1]s", "altitude": 35,
+		"forecast": [{"moment_day": "après-midi", "time": "2025-01-15T13:00:00.000Z", "T": 5, "wind_speed": 3}],
+		"daily_forecast": [{"time": "2025-01-14T23:00:00.000Z", "T_min": 1, "T_max": 6}]
+	}}`, insee))
+	}
+	return `{"type": "FeatureCollection", "features": [` + strings.Join(feats, ",") + `]}`
+}
+
+// refreshedMap returns a map fetched at the time of clk, with forecasts
+// for pois
+func refreshedMap(t *testing.T, clk *testutils.FakeClock, svg string, pois ...string) *mfmap.MfMap {
+	m := stubMap("dept", "", schedule.UpdateRates{FailureBackoff: time.Hour, ColdMaxAge: time.Hour})
+	m.Conf.Clock = clk
+	m.Schedule.Clock = clk
+	m.Schedule.MarkUpdate()
+	m.SvgMap = []byte(svg)
+	if err := m.ParseMultiforecast(strings.NewReader(forecastJSON(pois...))); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// receive stores m as the crawler would
+func receive(mc *Meteo, m *mfmap.MfMap) *mfmap.MfMap {
+	ch := make(chan *mfmap.MfMap, 1)
+	ch <- m
+	close(ch)
+	<-mc.ReceiveMaps(ch)
+	return mc.StoredMap(m.OriginalPath)
+}
+
+func TestDegradedRefresh(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	newMap := func(t *testing.T, svg string, pois ...string) *mfmap.MfMap {
+		return refreshedMap(t, clk, svg, pois...)
+	}
+	allPois := []string{"751010", "751020", "751030", "751040"}
+
+	tests := []struct {
+		name    string
+		svg     string
+		pois    []string
+		stored  bool // new map is stored
+		wantSvg string
+		wantPoi int // POIs served after update
+	}{
+		{"complete", "<svg/>", allPois, true, "<svg/>", 4},
+		{"few pois", "<svg/>", allPois[:1], true, "<svg/>", 4},
+		{"missing svg", "", allPois, true, "<old/>", 4},
+		{"no forecast", "<svg/>", nil, false, "<old/>", 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := obs.NewRegistryWithClock(clk)
+			mc := New(ContentConf{DayMin: -2, DayMax: 2, CacheId: "test", Obs: reg, Clock: clk, DegradedRatio: 0.5})
+			old := newMap(t, "<old/>", allPois...)
+			mc.maps.update(old, -2, 2)
+
+			m := newMap(t, tc.svg, tc.pois...)
+			stored := receive(mc, m)
+			if (stored == m) != tc.stored {
+				t.Fatalf("refreshed map stored=%v, want %v", stored == m, tc.stored)
+			}
+			if string(stored.SvgMap) != tc.wantSvg {
+				t.Errorf("SvgMap = %s, want %s", stored.SvgMap, tc.wantSvg)
+			}
+			if pois, _ := stored.Prevs.Coverage(clk.Now()); pois != tc.wantPoi {
+				t.Errorf("served %d POIs, want %d", pois, tc.wantPoi)
+			}
+			s := reg.Snapshot()
+			degraded := tc.name != "complete"
+			if got := s.RefreshesPartial+s.RefreshesRejected == 1; got != degraded {
+				t.Errorf("degraded refresh recorded=%v, want %v", got, degraded)
+			}
+			if !tc.stored && old.Schedule.NextDue().Before(clk.Now().Add(30*time.Minute)) {
+				t.Errorf("rejected refresh: stored map not backed off, due %v", old.Schedule.NextDue())
+			}
+		})
+	}
+}
+
+// Successive partial refreshes are checked against, and backfilled from,
+// the last complete one only, and not after ReferenceMaxAge.
+func TestDegradedRefreshReference(t *testing.T) {
+	start := time.Date(2025, 1, 15, 6, 0, 0, 0, time.UTC)
+	allPois := []string{"751010", "751020", "751030", "751040"}
+	steps := []struct {
+		at       time.Duration // after start
+		pois     []string
+		wantPoi  int  // POIs served after update
+		wantBack bool // stored map is backfilled
+	}{
+		{time.Hour, allPois[:1], 4, true},
+		{2 * time.Hour, allPois[:1], 4, true}, // still compared with 4 POIs
+		{3 * time.Hour, allPois[:3], 3, false},
+		{4 * time.Hour, allPois[:1], 3, true}, // from the last complete refresh
+	}
+	clk := testutils.NewFakeClock(start)
+	mc := New(ContentConf{DayMin: -2, DayMax: 2, CacheId: "test", Clock: clk, DegradedRatio: 0.5})
+	complete := receive(mc, refreshedMap(t, clk, "<svg/>", allPois...))
+	for _, s := range steps {
+		clk.Set(start.Add(s.at))
+		stored := receive(mc, refreshedMap(t, clk, "<svg/>", s.pois...))
+		if pois, _ := stored.Prevs.Coverage(clk.Now()); pois != s.wantPoi {
+			t.Errorf("at +%v: served %d POIs, want %d", s.at, pois, s.wantPoi)
+		}
+		if got := stored.Reference != nil; got != s.wantBack {
+			t.Errorf("at +%v: backfilled %v, want %v", s.at, got, s.wantBack)
+		}
+		if stored.Reference == nil {
+			complete = stored
+		} else if stored.Reference != complete {
+			t.Errorf("at +%v: backfilled from another refresh than the last complete one", s.at)
+		}
+	}
+
+	// the complete map, fetched the day before, still has forecasts for
+	// today but is too old to backfill from
+	clk.Set(start.Add(-mfmap.ReferenceMaxAge - time.Hour))
+	mc = New(ContentConf{DayMin: -2, DayMax: 2, CacheId: "test", Clock: clk, DegradedRatio: 0.5})
+	receive(mc, refreshedMap(t, clk, "<svg/>", allPois...))
+	clk.Set(start)
+	stored := receive(mc, refreshedMap(t, clk, "<svg/>", allPois[:1]...))
+	if pois, _ := stored.Prevs.Coverage(clk.Now()); pois != 1 || stored.Reference != nil {
+		t.Errorf("after ReferenceMaxAge: served %d POIs, backfilled %v, want 1 POI as is", pois, stored.Reference != nil)
+	}
+}
@@ -3,16 +3,21 @@ package content
 import (
 	"bytes"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gometeo/appconf"
+	"gometeo/budget"
 	"gometeo/mfmap"
+	"gometeo/svgtools"
 )
 
 //go:embed status.html
@@ -39,19 +44,56 @@ type Stats struct {
 	NextUpdate   string
 	UpdateMode   string
 	HitCount     int64
+	Visitors     int
+	DailyVisits  string // last 7 days, oldest first
+	LastRun      string // upstream update time of current data
+	RunCadence   string // learned upstream publication interval
+	SvgSaved     string // bytes saved on the svg map by optimization
 }
 
 // ReportView is a template-friendly (pre-formatted strings) flattening of
 // StatusReport. Keeps the HTML template dumb.
 type ReportView struct {
-	Uptime           string
-	StartTime        string
-	Commit           string
-	NextUpdatable    string
-	UpstreamRequests int64
-	StaticServed     int64
-	Counters         CountersView
-	RecentErrors     []ErrorRow
+	Uptime            string
+	StartTime         string
+	Commit            string
+	NextUpdatable     string
+	UpstreamRequests  int64
+	StaticServed      int64
+	HitsIgnored       int64
+	ProbesUnchanged   int64
+	ProbesChanged     int64
+	MapsApiOnly       int64
+	MapsScraped       int64
+	RefreshesPartial  int64
+	RefreshesRejected int64
+	RateLimited       RateLimitedView
+	Counters          CountersView
+	RecentErrors      []ErrorRow
+	DataIssuesTotal   int64
+	DataIssues        []DataIssueRow
+	QuarantineDir     string
+	Quarantine        []QuarantineRow
+	SchemaChanges     int64
+	Schemas           []SchemaRow
+	Upstream          []Setting
+	UpstreamDenied    int64
+	BudgetLows        int64
+	Budget            *BudgetView // nil if unlimited
+}
+
+// BudgetView is the display form of budget.State
+type BudgetView struct {
+	Hour  BudgetUsageView
+	Day   BudgetUsageView
+	Low   bool
+	Spent bool
+}
+
+type BudgetUsageView struct {
+	Used  int
+	Limit string // "unlimited" for 0
+	Reset string
 }
 
 // CountersView holds the per-resource loaded/failed/served counts
@@ -69,6 +111,14 @@ type CounterRow struct {
 	Served int64
 }
 
+// RateLimitedView holds requests rejected by the ratelimit middleware.
+type RateLimitedView struct {
+	Pages    int64
+	Data     int64
+	Static   int64
+	LoadShed int64
+}
+
 // ErrorRow is the display form of an obs.ErrorEvent.
 type ErrorRow struct {
 	Time   string
@@ -78,6 +128,60 @@ type ErrorRow struct {
 	Err    string
 }
 
+// DataIssueRow is the display form of an obs.DataIssue.
+type DataIssueRow struct {
+	Age    string
+	Map    string
+	Poi    string
+	Kind   string
+	Detail string
+	Count  int64
+}
+
+// QuarantineRow is the display form of a quarantine.Entry.
+type QuarantineRow struct {
+	Name string
+	Age  string
+	Kind string
+	URL  string
+	Err  string
+	Size int64
+}
+
+// SchemaRow is the display form of a schema.Inventory.
+type SchemaRow struct {
+	Endpoint string
+	Payloads int
+	Fields   int
+	Unknown  []string
+	Missing  []string
+	Changes  []SchemaChangeRow
+}
+
+// Setting is a name/value row of configuration shown on the status page
+type Setting struct {
+	Name  string
+	Value string
+}
+
+type SchemaChangeRow struct {
+	Time string
+	Path string
+	Kind string
+}
+
+func budgetUsageView(u budget.Usage) BudgetUsageView {
+	v := BudgetUsageView{Used: u.Used, Limit: "unlimited"}
+	if u.Limit > 0 {
+		v.Limit = strconv.Itoa(u.Limit)
+		v.Reset = u.Reset.In(displayLoc).Format("02/01 15:04")
+	}
+	return v
+}
+
+// maxDataIssueRows caps the data issues table of the status page
+const maxDataIssueRows = 50
+
 func (mc *Meteo) buildReportView() ReportView {
 	r := mc.Report()
 	maps := CounterRow{
@@ -96,12 +200,25 @@ func (mc *Meteo) buildReportView() ReportView {
 		Served: maps.Served + pictos.Served,
 	}
 	rv := ReportView{
-		Uptime:           r.Obs.Uptime.Round(time.Second).String(),
-		StartTime:        r.Obs.StartTime.In(displayLoc).Format("2006-01-02 15:04:05 MST"),
-		Commit:           appconf.Commit(),
-		NextUpdatable:    r.NextUpdatable,
-		UpstreamRequests: r.Obs.UpstreamRequests,
-		StaticServed:     r.Obs.StaticServed,
+		Uptime:            r.Obs.Uptime.Round(time.Second).String(),
+		StartTime:         r.Obs.StartTime.In(displayLoc).Format("2006-01-02 15:04:05 MST"),
+		Commit:            appconf.Commit(),
+		NextUpdatable:     r.NextUpdatable,
+		UpstreamRequests:  r.Obs.UpstreamRequests,
+		StaticServed:      r.Obs.StaticServed,
+		HitsIgnored:       r.Obs.HitsIgnored,
+		ProbesUnchanged:   r.Obs.ProbesUnchanged,
+		ProbesChanged:     r.Obs.ProbesChanged,
+		MapsApiOnly:       r.Obs.MapsApiOnly,
+		MapsScraped:       r.Obs.MapsScraped,
+		RefreshesPartial:  r.Obs.RefreshesPartial,
+		RefreshesRejected: r.Obs.RefreshesRejected,
+		RateLimited: RateLimitedView{
+			Pages:    r.Obs.RateLimitedPages,
+			Data:     r.Obs.RateLimitedData,
+			Static:   r.Obs.RateLimitedStatic,
+			LoadShed: r.Obs.LoadShed,
+		},
 		Counters: CountersView{
 			Maps:   maps,
 			Pictos: pictos,
@@ -111,39 +228,134 @@ func (mc *Meteo) buildReportView() ReportView {
 	for _, e := range r.Obs.RecentErrors {
 		rv.RecentErrors = append(rv.RecentErrors, ErrorRow{
 			Time:   e.Time.Format("15:04:05"),
-			Age:    time.Since(e.Time).Round(time.Second).String(),
+			Age:    mc.now().Sub(e.Time).Round(time.Second).String(),
 			Source: string(e.Source),
 			Target: e.Target,
 			Err:    e.Err,
 		})
 	}
+	rv.DataIssuesTotal = r.Obs.DataIssuesTotal
+	for i, di := range r.Obs.DataIssues {
+		if i == maxDataIssueRows {
+			break
+		}
+		rv.DataIssues = append(rv.DataIssues, DataIssueRow{
+			Age:    mc.now().Sub(di.Last).Round(time.Second).String(),
+			Map:    di.Map,
+			Poi:    di.Poi,
+			Kind:   di.Kind,
+			Detail: di.Detail,
+			Count:  di.Count,
+		})
+	}
+	rv.SchemaChanges = r.Obs.SchemaChanges
+	for _, inv := range mc.conf.Schema.Inventories() {
+		row := SchemaRow{
+			Endpoint: inv.Endpoint,
+			Payloads: inv.Payloads,
+			Fields:   inv.Fields,
+			Unknown:  inv.Unknown,
+			Missing:  inv.Missing,
+		}
+		for _, ch := range inv.Changes {
+			row.Changes = append(row.Changes, SchemaChangeRow{
+				Time: ch.Time.In(displayLoc).Format("02/01 15:04"),
+				Path: ch.Path,
+				Kind: string(ch.Kind),
+			})
+		}
+		rv.Schemas = append(rv.Schemas, row)
+	}
+	rv.Upstream = mc.conf.Upstream
+	rv.UpstreamDenied = r.Obs.UpstreamDenied
+	rv.BudgetLows = r.Obs.BudgetLows
+	if mc.conf.Budget != nil {
+		s := mc.conf.Budget.State()
+		rv.Budget = &BudgetView{
+			Hour:  budgetUsageView(s.Hour),
+			Day:   budgetUsageView(s.Day),
+			Low:   s.Low,
+			Spent: s.Spent,
+		}
+	}
+	rv.QuarantineDir = mc.conf.Quarantine.Dir()
+	entries, err := mc.conf.Quarantine.List()
+	if err != nil {
+		slog.Warn("quarantine list error", "err", err)
+	}
+	for _, e := range entries {
+		rv.Quarantine = append(rv.Quarantine, QuarantineRow{
+			Name: e.Name,
+			Age:  mc.now().Sub(e.Time).Round(time.Second).String(),
+			Kind: e.Kind,
+			URL:  e.URL,
+			Err:  e.Err,
+			Size: e.Size,
+		})
+	}
 	return rv
 }
 
 func getStats(m *mfmap.MfMap) Stats {
+	now := m.Now()
 	s := Stats{
 		Name:         m.Name(),
 		Path:         m.Path(),
 		HitCount:     m.Schedule.HitCount(),
+		Visitors:     m.Schedule.RecentVisitors(),
+		DailyVisits:  dailyVisits(m.Schedule.Histogram()),
 		LastClientIP: m.Schedule.LastClientIP(),
 		UpdateMode:   "-",
 		LastHit:      "-",
 		LastUpdate:   "-",
 		NextUpdate:   "-",
+		LastRun:      "-",
+		RunCadence:   "-",
+		SvgSaved:     svgSaved(m.SvgReport),
+	}
+	if lr := m.Schedule.LastRun(); !lr.IsZero() {
+		s.LastRun = lr.In(displayLoc).Format("02/01 15:04")
+	}
+	if c := m.Schedule.RunCadence(); c > 0 {
+		s.RunCadence = c.Round(time.Minute).String()
 	}
 	if lh := m.Schedule.LastHit(); !lh.IsZero() {
-		s.LastHit = time.Since(lh).Round(time.Second).String()
+		s.LastHit = now.Sub(lh).Round(time.Second).String()
 	}
 	if lu := m.Schedule.LastUpdate(); !lu.IsZero() {
-		s.LastUpdate = time.Since(lu).Round(time.Second).String()
+		s.LastUpdate = now.Sub(lu).Round(time.Second).String()
 		s.NextUpdate = m.Schedule.DurationToUpdate().Round(time.Second).String()
 	}
 	if m.Schedule.IsHot() {
 		s.UpdateMode = "hot"
+	} else if w := m.Schedule.Warmth(); w > 0 {
+		s.UpdateMode = fmt.Sprintf("warm %.0f%%", w*100)
 	}
 	return s
 }
 
+// svgSaved formats the bytes saved by an svg optimization and their share
+func svgSaved(r svgtools.OptimizeReport) string {
+	if r.Before == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f kB (%d%%)", float64(r.Saved())/1000, 100*r.Saved()/r.Before)
+}
+
+// dailyVisits sums an hourly histogram into per-day counts, formatted
+// as a compact space-separated list
+func dailyVisits(hourly []int) string {
+	days := make([]string, 0, len(hourly)/24)
+	for i := 0; i+24 <= len(hourly); i += 24 {
+		n := 0
+		for _, c := range hourly[i : i+24] {
+			n += c
+		}
+		days = append(days, strconv.Itoa(n))
+	}
+	return strings.Join(days, " ")
+}
+
 func (s Stats) String() string {
 	return fmt.Sprintf("%s mode:%s lastUpdate:%v lastHit:%v hitCount:%d\n",
 		s.Name, s.UpdateMode, s.LastUpdate, s.LastHit, s.HitCount)
@@ -199,3 +411,53 @@ func (mc *Meteo) makeStatusHandler() http.HandlerFunc {
 		}
 	}
 }
+
+// QueueRow is one entry of the update queue, as served by /statusse/queue.
+type QueueRow struct {
+	Path     string    `json:"path"`
+	Due      time.Time `json:"due"`
+	In       string    `json:"in"`
+	Hot      bool      `json:"hot"`
+	InFlight bool      `json:"inFlight"`
+}
+
+// queueRows lists the update queue, in-flight first, then by due time.
+func (mc *Meteo) queueRows() []QueueRow {
+	hot := make(map[string]bool)
+	mc.maps.mutex.Lock()
+	for _, m := range mc.maps.store {
+		hot[m.OriginalPath] = m.Schedule.IsHot()
+	}
+	mc.maps.mutex.Unlock()
+
+	now := mc.now()
+	entries := mc.maps.queue.Entries()
+	rows := make([]QueueRow, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, QueueRow{
+			Path:     e.Key,
+			Due:      e.Due.In(displayLoc),
+			In:       e.Due.Sub(now).Round(time.Second).String(),
+			Hot:      hot[e.Key],
+			InFlight: e.InFlight,
+		})
+	}
+	return rows
+}
+
+func (mc *Meteo) makeQueueHandler() http.HandlerFunc {
+	return func(resp http.ResponseWriter, _ *http.Request) {
+		b, err := json.MarshalIndent(mc.queueRows(), "", "  ")
+		if err != nil {
+			slog.Error("queueHandler error", "err", err)
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp.Header().Add("Content-Type", "application/json")
+		resp.Header().Add("X-Robots-Tag", "noindex, nofollow")
+		resp.WriteHeader(http.StatusOK)
+		if _, err = resp.Write(b); err != nil {
+			slog.Error("send error", "err", err)
+		}
+	}
+}
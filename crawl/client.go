@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"sync"
 
+	"gometeo/budget"
 	"gometeo/obs"
 )
 
@@ -17,7 +18,8 @@ type Client struct {
 	token           atomicToken
 	client          *http.Client
 	cache           *Cache
-	obs             *obs.Registry // optional; nil disables upstream-request counting
+	obs             *obs.Registry  // optional; nil disables upstream-request counting
+	budget          *budget.Budget // optional; nil is unlimited
 }
 
 // SetObs attaches an obs registry so that each outgoing upstream request
@@ -26,6 +28,12 @@ func (cl *Client) SetObs(r *obs.Registry) {
 	cl.obs = r
 }
 
+// SetBudget attaches the upstream request budget, consumed by each
+// outgoing upstream request. Nil is unlimited.
+func (cl *Client) SetBudget(b *budget.Budget) {
+	cl.budget = b
+}
+
 type atomicToken struct {
 	mutex sync.Mutex
 	token string
@@ -53,6 +61,20 @@ func NewClient(baseUrl string, transport http.RoundTripper) *Client {
 	}
 }
 
+// session returns a client sharing cl's transport, cache and obs registry,
+// with its own auth token. Concurrent map refreshes each use a session
+// so that one crawl never sends the token minted for another.
+func (cl *Client) session() *Client {
+	return &Client{
+		baseUrl:         cl.baseUrl,
+		noSessionCookie: cl.noSessionCookie,
+		client:          cl.client,
+		cache:           cl.cache,
+		obs:             cl.obs,
+		budget:          cl.budget,
+	}
+}
+
 // custom error for MfClient
 type MissingCookieError string
 
@@ -60,6 +82,17 @@ func (e MissingCookieError) Error() string {
 	return "MissingCookieError: " + string(e)
 }
 
+// StatusError is returned for upstream responses other than 200 OK
+type StatusError struct {
+	Status string
+	Code   int
+	URL    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s on '%s'", e.Status, e.URL)
+}
+
 func (t *atomicToken) Get() string {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -119,28 +152,35 @@ func (cl *Client) addUrlBase(path string) (string, error) {
 // Get issues a GET request to path, prefixed with 'baseUrl' constant.
 // implement a basic cache, controlled with policy parameter.
 func (cl *Client) Get(ctx context.Context, path string, policy CachePolicy) (io.ReadCloser, error) {
+	body, _, err := cl.GetWithHeader(ctx, path, policy)
+	return body, err
+}
+
+// GetWithHeader is Get, also returning the response headers.
+// Headers are nil for responses served from the cache.
+func (cl *Client) GetWithHeader(ctx context.Context, path string, policy CachePolicy) (io.ReadCloser, http.Header, error) {
 	// commence par chercher dans le cache avant de lancer la requete
 	// le cache est ignoré avec CacheDisabled et CacheUpdate
 	if policy == CacheDefault || policy == CacheOnly {
 		body, ok := cl.cache.Lookup(path)
 		if ok {
-			return body, nil
+			return body, nil, nil
 		}
 	}
 	// arrete ici en mode CacheOnly
 	if policy == CacheOnly {
 		msg := fmt.Sprint("ressource non disponible dans le cache ", path)
-		return nil, errors.New(msg)
+		return nil, nil, errors.New(msg)
 	}
 	// cree une requete GET sur path
 	url, err := cl.addUrlBase(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		msg := fmt.Sprintf("erreur de création de la requête http pour %s", path)
-		return nil, errors.New(msg)
+		return nil, nil, errors.New(msg)
 	}
 	// execute la requête avec le token d'authentification et un user agent courant
 	token := cl.token.Get()
@@ -149,23 +189,28 @@ func (cl *Client) Get(ctx context.Context, path string, policy CachePolicy) (io.
 	}
 	req.Header.Add("user-agent", userAgentFirefox)
 
+	if err := cl.budget.Take(); err != nil {
+		cl.obs.RecordUpstreamDenied()
+		return nil, nil, fmt.Errorf("%w, not sent: %s", err, url)
+	}
 	cl.obs.RecordUpstreamRequest()
 	resp, err := cl.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s on '%s'", resp.Status, resp.Request.URL)
+		resp.Body.Close()
+		return nil, nil, &StatusError{Status: resp.Status, Code: resp.StatusCode, URL: resp.Request.URL.String()}
 	}
 	// log.Printf("request '%s' %d", resp.Request.URL, resp.StatusCode)
 	// met à jour le token de session
 	err = cl.updateAuthToken(resp)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// met à jour le cache
 	if policy == CacheDefault || policy == CacheUpdate {
-		return cl.cache.NewUpdater(path, resp.Body), nil
+		return cl.cache.NewUpdater(path, resp.Body), resp.Header, nil
 	}
-	return resp.Body, nil
+	return resp.Body, resp.Header, nil
 }
@@ -3,12 +3,16 @@ package crawl
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+
+	"gometeo/budget"
+	"gometeo/obs"
 )
 
 const assets_dir = "../test_data/"
@@ -359,3 +363,40 @@ func TestHttpErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestBudget(t *testing.T) {
+	var cnt int
+	srv := setupServerCustom(t, "", &cnt, &http.Cookie{Name: sessionCookie, Value: "token"})
+	defer srv.Close()
+	reg := obs.NewRegistry()
+	client := NewClient(srv.URL, nil)
+	client.SetObs(reg)
+	client.SetBudget(budget.New(budget.Conf{Hourly: 2}))
+	sess := client.session()
+
+	tests := []struct {
+		path   string
+		policy CachePolicy
+		err    error
+	}{
+		{"/a", CacheDefault, nil},
+		{"/a", CacheDefault, nil}, // cache hit, not counted
+		{"/b", CacheDisabled, nil},
+		{"/c", CacheDisabled, budget.ErrExhausted},
+		{"/a", CacheDefault, nil},
+	}
+	for _, tc := range tests {
+		body, err := sess.Get(context.Background(), tc.path, tc.policy)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Get(%s) error = %v, want %v", tc.path, err, tc.err)
+		}
+		if err == nil {
+			io.Copy(io.Discard, body)
+			body.Close()
+		}
+	}
+	s := reg.Snapshot()
+	if cnt != 2 || s.UpstreamRequests != 2 || s.UpstreamDenied != 1 {
+		t.Errorf("sent %d requests, obs %d sent %d denied, want 2, 2, 1", cnt, s.UpstreamRequests, s.UpstreamDenied)
+	}
+}
@@ -1,18 +1,27 @@
 package crawl
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
+	"gometeo/budget"
+	gj "gometeo/geojson"
 	"gometeo/mfmap"
+	"gometeo/mfmap/scope"
 	"gometeo/mfmap/urls"
 	"gometeo/obs"
+	"gometeo/quarantine"
+	svt "gometeo/svgtools"
 )
 
 const (
@@ -20,25 +29,40 @@ const (
 )
 
 type CrawlConf struct {
-	Upstream  string
-	MapConf   mfmap.MapConf
-	Transport http.RoundTripper // optional; nil uses http.DefaultTransport
-	Obs       *obs.Registry     // optional; nil disables observability recording
+	Upstream   string
+	MapConf    mfmap.MapConf
+	Transport  http.RoundTripper // optional; nil uses http.DefaultTransport
+	Obs        *obs.Registry     // optional; nil disables observability recording
+	Quarantine *quarantine.Store // optional; nil disables the quarantine of unparsable payloads
+	PageTTL    time.Duration     // optional; max age of page data reused by api-only refreshes, 0 scrapes every refresh
+	Budget     *budget.Budget    // optional; nil sends upstream requests without limit
 }
 
 type Crawler struct {
-	conf       CrawlConf
-	mainClient *Client
+	conf        CrawlConf
+	mainClient  *Client
+	pictoClient *Client     // mainClient, unless pictos are rewritten to another host
+	apiToken    atomicToken // token of the last successful crawl, reused by Probe()
+	pages       pageCache   // last scrape of each map, for api-only refreshes
 }
 
 // NewCrawler allocates a Crawler with a pre-configured client
 func NewCrawler(conf CrawlConf) *Crawler {
 	cl := NewClient(conf.Upstream, conf.Transport)
 	cl.SetObs(conf.Obs)
-	return &Crawler{
-		conf:       conf,
-		mainClient: cl,
+	cl.SetBudget(conf.Budget)
+	cr := &Crawler{
+		conf:        conf,
+		mainClient:  cl,
+		pictoClient: cl,
 	}
+	// clients only send requests under their base url
+	if u, err := cr.pictoURL(""); err == nil && !strings.HasPrefix(u.String(), conf.Upstream+"/") {
+		cr.pictoClient = NewClient(u.Scheme+"://"+u.Host, conf.Transport)
+		cr.pictoClient.SetObs(conf.Obs)
+		cr.pictoClient.SetBudget(conf.Budget)
+	}
+	return cr
 }
 
 // Fetch() crawl upstream map tree with a recursion limit.
@@ -46,6 +70,44 @@ func NewCrawler(conf CrawlConf) *Crawler {
 func (cr *Crawler) Fetch(ctx context.Context, startPath string, limit int) (
 	chMap chan *mfmap.MfMap,
 	chPicto chan mfmap.Picto,
+) {
+	return cr.FetchRoots(ctx, []string{startPath}, limit)
+}
+
+// FetchFrom() crawls the upstream map tree at path, below ancestors (the
+// zones above it, from the crawl root down) against which scope rules are
+// checked. Used to refresh a map alone as it was filtered in the full crawl.
+func (cr *Crawler) FetchFrom(ctx context.Context, path string, ancestors []scope.Zone, limit int) (
+	chMap chan *mfmap.MfMap,
+	chPicto chan mfmap.Picto,
+) {
+	return cr.fetch(ctx, []queueItem{{path: path, ancestors: ancestors}}, limit)
+}
+
+// FetchRoots() crawls several upstream map trees, in order, with a global
+// recursion limit. Maps reachable from several roots are fetched once.
+func (cr *Crawler) FetchRoots(ctx context.Context, roots []string, limit int) (
+	chMap chan *mfmap.MfMap,
+	chPicto chan mfmap.Picto,
+) {
+	items := make([]queueItem, len(roots))
+	for i, root := range roots {
+		items[i] = queueItem{path: root}
+	}
+	return cr.fetch(ctx, items, limit)
+}
+
+// queueItem is a map waiting to be crawled
+type queueItem struct {
+	path      string
+	parent    string       // Path() of the parent map
+	ancestors []scope.Zone // zones of the parent map and above, root first
+}
+
+// fetch crawls maps from roots, in order, with a global recursion limit.
+func (cr *Crawler) fetch(ctx context.Context, roots []queueItem, limit int) (
+	chMap chan *mfmap.MfMap,
+	chPicto chan mfmap.Picto,
 ) {
 	chMap = make(chan (*mfmap.MfMap))
 	chPicto = make(chan (mfmap.Picto))
@@ -57,16 +119,19 @@ func (cr *Crawler) Fetch(ctx context.Context, startPath string, limit int) (
 			close(chPicto)
 		}()
 
-		type QueueItem struct {
-			path   string
-			parent string
-		}
-
 		var (
 			cnt      int
 			wgPictos sync.WaitGroup
-			queue    = []QueueItem{{startPath, ""}}
+			queue    = make([]queueItem, 0, len(roots))
+			seen     = make(map[string]bool)
+			paths    = make([]string, len(roots))
 		)
+		// queue is LIFO: push roots in reverse order to crawl them in order
+		for i := len(roots) - 1; i >= 0; i-- {
+			queue = append(queue, roots[i])
+			paths[i] = roots[i].path
+		}
+		startPath := strings.Join(paths, ",")
 
 		for {
 			// stop when queue is empty, max count reached, or context expired
@@ -79,11 +144,15 @@ func (cr *Crawler) Fetch(ctx context.Context, startPath string, limit int) (
 				cr.recordCrawlError(startPath, err)
 				break
 			}
-			cnt++
 			// pop next map from queue
 			next := queue[i]
 			queue = queue[0:i]
-			m, err := cr.getMap(ctx, next.path)
+			if seen[next.path] {
+				continue
+			}
+			seen[next.path] = true
+			cnt++
+			m, err := cr.getMap(ctx, next.path, next.ancestors)
 			if err != nil {
 				slog.Error("getMap error", "path", next.path, "err", err)
 				cr.recordMapFailed(next.path, err)
@@ -92,9 +161,10 @@ func (cr *Crawler) Fetch(ctx context.Context, startPath string, limit int) (
 			// add parent path
 			m.Parent = next.parent
 
-			// enqueue children maps
+			// enqueue children maps, already filtered by MapConf.Scope
+			ancestors := append(slices.Clip(next.ancestors), m.Zone())
 			for _, sz := range m.Data.Subzones {
-				queue = append(queue, QueueItem{sz.Path, m.Path()})
+				queue = append(queue, queueItem{sz.Path, m.Path(), ancestors})
 			}
 			// donwload pictos
 			// cache will avoid multiple downloads of same a picto
@@ -111,18 +181,34 @@ func (cr *Crawler) Fetch(ctx context.Context, startPath string, limit int) (
 	return chMap, chPicto
 }
 
-// getMap gets https://mf.com/zone html page and related data like
+// getMap refreshes the map at path with forecasts only when its page was
+// scraped less than PageTTL ago, and scrapes it otherwise, or when the api
+// rejects the token.
+func (cr *Crawler) getMap(ctx context.Context, path string, ancestors []scope.Zone) (*mfmap.MfMap, error) {
+	if p := cr.freshPage(path); p != nil {
+		m, err := cr.getForecasts(ctx, path, p, ancestors)
+		if !errors.Is(err, errTokenRejected) {
+			return m, err
+		}
+		slog.Warn("api token rejected, scraping page", "path", path, "err", err)
+		cr.pages.drop(path)
+	}
+	return cr.scrapeMap(ctx, path, ancestors)
+}
+
+// scrapeMap gets https://mf.com/zone html page and related data like
 // svg map, pictos, forecasts and list of subzones
 // related data is stored into MfMap fields
-func (cr *Crawler) getMap(ctx context.Context, path string) (*mfmap.MfMap, error) {
+// Safe for concurrent use: each call runs its own client session.
+func (cr *Crawler) scrapeMap(ctx context.Context, path string, ancestors []scope.Zone) (*mfmap.MfMap, error) {
 	slog.Info("getMap", "path", path)
 
-	// Clear any previous token so the HTML page request goes out unauthenticated.
+	// A fresh session has no token, so the HTML page request goes out unauthenticated.
 	// The HTML endpoint is public and its Set-Cookie response re-mints a fresh
 	// mfsession token for the subsequent authenticated API calls. This avoids
 	// stale-token loops on long-running instances when upstream expires sessions.
-	cr.mainClient.token.Set("")
-	body, err := cr.mainClient.Get(ctx, path, CacheDisabled)
+	sess := cr.mainClient.session()
+	body, header, err := sess.GetWithHeader(ctx, path, CacheDisabled)
 	if err != nil {
 		return nil, err
 	}
@@ -132,43 +218,97 @@ func (cr *Crawler) getMap(ctx context.Context, path string) (*mfmap.MfMap, error
 	m := &mfmap.MfMap{
 		OriginalPath: path,
 		Conf:         cr.conf.MapConf,
+		Ancestors:    ancestors,
 	}
 	m.Schedule.Rates = cr.conf.MapConf.Rates
-	err = m.ParseHtml(body)
+	m.Schedule.Clock = cr.conf.MapConf.Clock
+	m.Schedule.Budget = cr.conf.MapConf.Budget
+	err = cr.parse(KindHtml, path, header, body, m.ParseHtml)
 	if err != nil {
 		return nil, err
 	}
 
 	// apiClient is a closure returning a preconfigured api client
 	apiClient := func() (*Client, error) {
-		apiBaseUrl, err := urls.ApiUrl(m.Data, "", nil)
-		if err != nil {
-			return nil, err
-		}
-		cl := NewClient(apiBaseUrl.String(), cr.conf.Transport)
-		cl.SetObs(cr.conf.Obs)
-		cl.token.Set(cr.mainClient.token.Get())
-		cl.noSessionCookie = true // api server do not send auth tokens so dont expect any
-		return cl, nil
+		return cr.newApiClient(m.Data, sess.token.Get())
 	}
 
-	// subqueries to retreive SVG, geographical subzones and actual forecasts
-	if err = cr.getAsset(ctx, func() (*url.URL, error) { return urls.SvgUrl(m.Conf.Upstream, m.Data) }, m.ParseSvgMap, nil); err != nil {
+	// subqueries to retreive geographical subzones, SVG cropped to them,
+	// and actual forecasts
+	sessClient := func() (*Client, error) { return sess, nil }
+	if err = cr.getAsset(ctx, KindGeography, func() (*url.URL, error) { return urls.GeographyUrl(m.Conf.Upstream, m.Data) }, m.ParseGeography, sessClient); err != nil {
 		return nil, err
 	}
-	if err = cr.getAsset(ctx, func() (*url.URL, error) { return urls.GeographyUrl(m.Conf.Upstream, m.Data) }, m.ParseGeography, nil); err != nil {
+	if err = cr.getAsset(ctx, KindSvg, func() (*url.URL, error) { return urls.SvgUrl(m.Conf.Upstream, m.Data) }, m.ParseSvgMap, sessClient); err != nil {
 		return nil, err
 	}
-	if err = cr.getAsset(ctx, func() (*url.URL, error) { return urls.ForecastUrl(m.Data) }, m.ParseMultiforecast, apiClient); err != nil {
+	if err = cr.getAsset(ctx, KindMultiforecast, func() (*url.URL, error) { return urls.ForecastUrl(m.Conf.Hosts, m.Data) }, m.ParseMultiforecast, apiClient); err != nil {
 		return nil, err
 	}
+	cr.recordDataIssues(m)
+	cr.conf.Obs.RecordMapFetch(false)
 	m.Schedule.MarkUpdate() // record update time
+	cr.apiToken.Set(sess.token.Get())
+	cr.storePage(m)
 	return m, nil
 }
 
+// newApiClient returns a client for the forecast api of a map
+func (cr *Crawler) newApiClient(data *mfmap.MapData, token string) (*Client, error) {
+	apiBaseUrl, err := urls.ApiUrl(cr.conf.MapConf.Hosts, data, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	cl := NewClient(apiBaseUrl.String(), cr.conf.Transport)
+	cl.SetObs(cr.conf.Obs)
+	cl.SetBudget(cr.conf.Budget)
+	cl.token.Set(token)
+	cl.noSessionCookie = true // api server do not send auth tokens so dont expect any
+	return cl, nil
+}
+
+// Probe tells whether upstream published a new forecast run since m was
+// fetched, with a single-POI api request instead of a full crawl. The update
+// time of the first POI is compared with its own at the last fetch, since
+// POIs of a map may come from different runs.
+// Returns true when unsure (no run recorded yet, or no api token available);
+// errors mean the probe failed and a full crawl should be done anyway.
+func (cr *Crawler) Probe(ctx context.Context, m *mfmap.MfMap) (bool, error) {
+	lastRun := m.ProbeRun
+	token := cr.apiToken.Get()
+	if lastRun.IsZero() || token == "" || m.Data == nil || len(m.Data.Children) == 0 {
+		return true, nil
+	}
+	u, err := urls.ForecastProbeUrl(m.Conf.Hosts, m.Data)
+	if err != nil {
+		return true, err
+	}
+	cl, err := cr.newApiClient(m.Data, token)
+	if err != nil {
+		return true, err
+	}
+	body, err := cl.Get(ctx, u.String(), CacheDisabled)
+	if err != nil {
+		return true, err
+	}
+	defer body.Close()
+	fc, err := gj.ParseMultiforecast(body)
+	if err != nil {
+		return true, err
+	}
+	run := fc.Features.UpdateTimeOf(m.Data.Children[0].Insee)
+	if run.IsZero() {
+		return true, fmt.Errorf("probe response for '%s' has no update_time", m.OriginalPath)
+	}
+	changed := run.After(lastRun)
+	cr.conf.Obs.RecordProbe(changed)
+	return changed, nil
+}
+
 // getAsset downloads a map asset and feeds result into MfMap via parser
 func (cr *Crawler) getAsset(
 	ctx context.Context,
+	kind string, // payload kind, for the quarantine
 	urlGetter func() (*url.URL, error), // closure (over a mfmap.MfMap) returning asset url
 	parser func(io.Reader) error, // closure (over a mfmap.MfMap) parsing the content
 	clientGetter func() (*Client, error),
@@ -184,20 +324,40 @@ func (cr *Crawler) getAsset(
 			return err
 		}
 	}
-	body, err := cl.Get(ctx, u.String(), CacheDefault)
+	body, header, err := cl.GetWithHeader(ctx, u.String(), CacheDefault)
 	if err != nil {
 		return err
 	}
 	defer body.Close()
-	err = parser(body)
+	err = cr.parse(kind, u.String(), header, body, parser)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// parse feeds body to parser. When parsing fails, the raw body is saved
+// into the quarantine, if enabled, with its url, headers and error.
+func (cr *Crawler) parse(kind, url string, header http.Header, body io.Reader, parser func(io.Reader) error) error {
+	if cr.conf.Quarantine == nil {
+		return parser(body)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	err = parser(bytes.NewReader(b))
+	if err != nil {
+		e := quarantine.Entry{Kind: kind, URL: url, Header: header, Err: err.Error()}
+		if qerr := cr.conf.Quarantine.Save(e, b); qerr != nil {
+			slog.Error("quarantine save error", "url", url, "err", qerr)
+		}
+	}
+	return err
+}
+
 // fetchPictos retrieves pictos from upstream
-// cr.mainCient has a cache to avoid multiple downloads
+// cr.pictoClient has a cache to avoid multiple downloads
 func (cr *Crawler) fetchPictos(ctx context.Context, names []string, wg *sync.WaitGroup, out chan<- mfmap.Picto) {
 	wg.Add(1)
 	go func() {
@@ -214,12 +374,23 @@ func (cr *Crawler) fetchPictos(ctx context.Context, names []string, wg *sync.Wai
 	}()
 }
 
+// FetchPicto retrieves a single picto from upstream, out of a crawl.
+// Used by content for pictos missing from its store.
+func (cr *Crawler) FetchPicto(ctx context.Context, name string) ([]byte, error) {
+	p, err := cr.getPicto(ctx, name)
+	if err != nil {
+		cr.recordPictoFailed(name, err)
+		return nil, err
+	}
+	return p, nil
+}
+
 func (cr *Crawler) getPicto(ctx context.Context, name string) ([]byte, error) {
 	url, err := cr.pictoURL(name)
 	if err != nil {
 		return nil, err
 	}
-	body, err := cr.mainClient.Get(ctx, url.String(), CacheDefault)
+	body, err := cr.pictoClient.Get(ctx, url.String(), CacheDefault)
 	if err != nil {
 		return nil, err
 	}
@@ -228,6 +399,15 @@ func (cr *Crawler) getPicto(ctx context.Context, name string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if conf := cr.conf.MapConf.Svg; conf != nil {
+		opt, _, err := svt.OptimizeBytes(b, *conf)
+		if err != nil {
+			// served as downloaded, browsers may still render it
+			slog.Warn("picto not optimized", "name", name, "err", err)
+			return b, nil
+		}
+		b = opt
+	}
 	return b, nil
 }
 
@@ -250,7 +430,21 @@ func (cr *Crawler) recordCrawlError(target string, err error) {
 	}
 }
 
+func (cr *Crawler) recordDataIssues(m *mfmap.MfMap) {
+	if len(m.Issues) == 0 {
+		return
+	}
+	slog.Warn("forecasts repaired", "path", m.OriginalPath, "issues", len(m.Issues), "first", m.Issues[0].String())
+	if cr.conf.Obs == nil {
+		return
+	}
+	for _, issue := range m.Issues {
+		cr.conf.Obs.RecordDataIssue(m.OriginalPath, issue.Insee, string(issue.Kind), issue.Detail)
+	}
+}
+
 // exemple https://meteofrance.com/modules/custom/mf_tools_common_theme_public/svg/weather/p3j.svg
+// rewritten by MapConf.Hosts rules
 func (cr *Crawler) pictoURL(name string) (*url.URL, error) {
 	elems := []string{
 		cr.conf.Upstream,
@@ -265,5 +459,5 @@ func (cr *Crawler) pictoURL(name string) (*url.URL, error) {
 	if err != nil {
 		return nil, fmt.Errorf("pictoURL() error: %w", err)
 	}
-	return u, nil
+	return cr.conf.MapConf.Hosts.Rewrite(u), nil
 }
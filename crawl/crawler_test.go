@@ -2,6 +2,8 @@ package crawl
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"sync"
 	"testing"
@@ -9,6 +11,7 @@ import (
 
 	"gometeo/mfmap"
 	"gometeo/mfmap/schedule"
+	"gometeo/rewrite"
 )
 
 var testCrawlConf = CrawlConf{
@@ -41,6 +44,33 @@ func TestPictoUrl(t *testing.T) {
 	}
 }
 
+func TestPictoRewrite(t *testing.T) {
+	const picto = `<svg xmlns="http://www.w3.org/2000/svg"/>`
+	pages := httptest.NewServer(http.NotFoundHandler())
+	defer pages.Close()
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pictos/svg/weather/p1j.svg" {
+			http.NotFound(w, r)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "token"})
+		w.Write([]byte(picto))
+	}))
+	defer cdn.Close()
+
+	rules, err := rewrite.ParseRules(pages.URL + "/modules/custom/mf_tools_common_theme_public=" + cdn.URL + "/pictos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testCrawlConf
+	conf.Upstream = pages.URL
+	conf.MapConf.Hosts.Rules = rules
+	got, err := NewCrawler(conf).getPicto(context.Background(), "p1j")
+	if err != nil || string(got) != picto {
+		t.Errorf("getPicto() got %q, %v", got, err)
+	}
+}
+
 func TestFetch(t *testing.T) {
 	var wantN int = 5
 	maps, pictos := NewCrawler(testCrawlConf).Fetch(context.Background(), "/", wantN)
@@ -82,7 +112,7 @@ func TestGetMap(t *testing.T) {
 
 func getMapTest(t *testing.T, path string) *mfmap.MfMap {
 	cr := NewCrawler(testCrawlConf)
-	m, err := cr.getMap(context.Background(), path)
+	m, err := cr.getMap(context.Background(), path, nil)
 	if err != nil {
 		t.Fatalf("getmap('%s') error: %s", path, err)
 	}
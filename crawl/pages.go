@@ -0,0 +1,128 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"gometeo/clock"
+	gj "gometeo/geojson"
+	"gometeo/mfmap"
+	"gometeo/mfmap/scope"
+	"gometeo/mfmap/urls"
+	svt "gometeo/svgtools"
+)
+
+// errTokenRejected tells an api-only refresh to scrape the page again,
+// which mints a new token
+var errTokenRejected = errors.New("api token rejected")
+
+// page is what a scrape fetches besides forecasts: page data, svg and
+// geography. Shared read-only by the maps refreshed from it.
+type page struct {
+	data      *mfmap.MapData
+	svg       []byte
+	svgCrop   svt.CropRatio
+	svgReport svt.OptimizeReport
+	geography gj.GeoCollection
+	scraped   time.Time
+}
+
+// pageCache keeps the last scrape of each map path. Safe for concurrent use.
+type pageCache struct {
+	mutex sync.Mutex
+	pages map[string]*page
+}
+
+func (pc *pageCache) get(path string) *page {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	return pc.pages[path]
+}
+
+func (pc *pageCache) set(path string, p *page) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if pc.pages == nil {
+		pc.pages = make(map[string]*page)
+	}
+	pc.pages[path] = p
+}
+
+func (pc *pageCache) drop(path string) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	delete(pc.pages, path)
+}
+
+// storePage records the scrape of m, when api-only refreshes are enabled
+func (cr *Crawler) storePage(m *mfmap.MfMap) {
+	if cr.conf.PageTTL <= 0 {
+		return
+	}
+	cr.pages.set(m.OriginalPath, &page{
+		data:      m.Data,
+		svg:       m.SvgMap,
+		svgCrop:   m.SvgCrop,
+		svgReport: m.SvgReport,
+		geography: m.Geography,
+		scraped:   m.Now(),
+	})
+}
+
+// freshPage returns the scrape of path if it is younger than PageTTL and
+// an api token is available, nil otherwise
+func (cr *Crawler) freshPage(path string) *page {
+	if cr.conf.PageTTL <= 0 || cr.apiToken.Get() == "" {
+		return nil
+	}
+	p := cr.pages.get(path)
+	if p == nil {
+		return nil
+	}
+	if clock.Or(cr.conf.MapConf.Clock).Now().Sub(p.scraped) >= cr.conf.PageTTL {
+		return nil
+	}
+	return p
+}
+
+// getForecasts refreshes the map at path from its scraped page with a
+// single multiforecast request, and the token of the last scrape.
+// Returns errTokenRejected when the api answers 401 or 403.
+func (cr *Crawler) getForecasts(ctx context.Context, path string, p *page, ancestors []scope.Zone) (*mfmap.MfMap, error) {
+	slog.Info("getMap api only", "path", path, "scraped", p.scraped)
+	m := &mfmap.MfMap{
+		OriginalPath: path,
+		Conf:         cr.conf.MapConf,
+		Data:         p.data,
+		SvgMap:       p.svg,
+		SvgCrop:      p.svgCrop,
+		SvgReport:    p.svgReport,
+		Geography:    p.geography,
+		Ancestors:    ancestors,
+	}
+	m.Schedule.Rates = cr.conf.MapConf.Rates
+	m.Schedule.Clock = cr.conf.MapConf.Clock
+	m.Schedule.Budget = cr.conf.MapConf.Budget
+	token := cr.apiToken.Get()
+	apiClient := func() (*Client, error) {
+		return cr.newApiClient(m.Data, token)
+	}
+	err := cr.getAsset(ctx, KindMultiforecast, func() (*url.URL, error) { return urls.ForecastUrl(m.Conf.Hosts, m.Data) }, m.ParseMultiforecast, apiClient)
+	var se *StatusError
+	if errors.As(err, &se) && (se.Code == http.StatusUnauthorized || se.Code == http.StatusForbidden) {
+		return nil, fmt.Errorf("%w: %w", errTokenRejected, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr.recordDataIssues(m)
+	cr.conf.Obs.RecordMapFetch(true)
+	m.Schedule.MarkUpdate()
+	return m, nil
+}
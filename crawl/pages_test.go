@@ -0,0 +1,109 @@
+package crawl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gometeo/fakeupstream"
+	"gometeo/obs"
+	"gometeo/testutils"
+)
+
+// countingUpstream counts page and api requests to a fake upstream, and
+// rejects api tokens while reject is set
+type countingUpstream struct {
+	next   http.Handler
+	pages  atomic.Int64
+	api    atomic.Int64
+	reject atomic.Bool
+}
+
+func (cu *countingUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, fakeupstream.ApiPath):
+		cu.api.Add(1)
+		if cu.reject.Load() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	case !strings.HasPrefix(r.URL.Path, "/modules/"):
+		cu.pages.Add(1)
+	}
+	cu.next.ServeHTTP(w, r)
+}
+
+func TestApiOnlyRefresh(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC))
+	up := &countingUpstream{next: fakeupstream.New(fakeupstream.Conf{Clock: clk})}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	reg := obs.NewRegistryWithClock(clk)
+	conf := testCrawlConf
+	conf.Upstream = srv.URL
+	conf.MapConf.Upstream = srv.URL
+	conf.MapConf.Hosts.ApiBase = srv.URL + fakeupstream.ApiPath
+	conf.MapConf.Clock = clk
+	conf.PageTTL = time.Hour
+	conf.Obs = reg
+	cr := NewCrawler(conf)
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		reject   bool
+		pages    int64 // page requests of the refresh
+		api      int64
+		scraped  int64 // totals of obs counters
+		apiOnly  int64
+		mapsSent int
+	}{
+		{name: "first fetch scrapes", pages: 1, api: 1, scraped: 1, mapsSent: 1},
+		{name: "fresh page", advance: 30 * time.Minute, pages: 0, api: 1, scraped: 1, apiOnly: 1, mapsSent: 1},
+		{name: "token rejected", reject: true, pages: 1, api: 2, scraped: 1, apiOnly: 1, mapsSent: 0},
+		{name: "rescraped after rejection", pages: 1, api: 1, scraped: 2, apiOnly: 1, mapsSent: 1},
+		{name: "expired page", advance: time.Hour, pages: 1, api: 1, scraped: 3, apiOnly: 1, mapsSent: 1},
+	}
+	for _, tc := range tests {
+		clk.Advance(tc.advance)
+		up.reject.Store(tc.reject)
+		pages, api := up.pages.Load(), up.api.Load()
+
+		chMap, chPicto := cr.Fetch(context.Background(), "/", 1)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			for range chPicto {
+			}
+			wg.Done()
+		}()
+		var sent int
+		for m := range chMap {
+			sent++
+			if len(m.Prevs) == 0 || len(m.SvgMap) == 0 || m.Data == nil {
+				t.Errorf("%s: map is incomplete", tc.name)
+			}
+		}
+		wg.Wait()
+
+		if got := up.pages.Load() - pages; got != tc.pages {
+			t.Errorf("%s: %d page requests, want %d", tc.name, got, tc.pages)
+		}
+		if got := up.api.Load() - api; got != tc.api {
+			t.Errorf("%s: %d api requests, want %d", tc.name, got, tc.api)
+		}
+		if sent != tc.mapsSent {
+			t.Errorf("%s: %d maps, want %d", tc.name, sent, tc.mapsSent)
+		}
+		s := reg.Snapshot()
+		if s.MapsScraped != tc.scraped || s.MapsApiOnly != tc.apiOnly {
+			t.Errorf("%s: obs got %d scraped, %d api only, want %d, %d", tc.name, s.MapsScraped, s.MapsApiOnly, tc.scraped, tc.apiOnly)
+		}
+	}
+}
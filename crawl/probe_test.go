@@ -0,0 +1,75 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gometeo/mfmap"
+)
+
+// probeFeature is a multiforecast feature of POI insee updated at update
+func probeFeature(insee, update string) string {
+	return fmt.Sprintf(`{
+	"update_time": "%s", "type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [2.35, 48.85]},
+	"properties": {
+		"name": "%s", "country": "FR - France", "french_department": "75",
+		"timezone": "Europe/Paris", "insee": "%s", "altitude": 35,
+		"forecast": [{"moment_day": "matin", "time": "2025-03-10T08:00:00.000Z", "T": 8, "wind_speed": 10}],
+		"daily_forecast": [{"time": "2025-03-09T23:00:00.000Z", "T_min": 5, "T_max": 12}]
+	}}`, update, insee, insee)
+}
+
+func probeCollection(features ...string) string {
+	return `{"type": "FeatureCollection", "features": [` + strings.Join(features, ",") + `]}`
+}
+
+func TestProbe(t *testing.T) {
+	var probed string // update time of the first POI served by the api
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("liste_id") != "750010" {
+			t.Errorf("probe requested POIs %q, want the first one", r.URL.Query().Get("liste_id"))
+		}
+		fmt.Fprint(w, probeCollection(probeFeature("750010", probed)))
+	}))
+	defer srv.Close()
+	conf := testCrawlConf
+	conf.MapConf.Hosts.ApiBase = srv.URL
+	cr := NewCrawler(conf)
+	cr.apiToken.Set("token")
+
+	// the first POI is from an older run than the second one
+	m := &mfmap.MfMap{Conf: conf.MapConf, Data: &mfmap.MapData{Children: []mfmap.Poi{{Insee: "750010"}, {Insee: "750020"}}}}
+	stored := probeCollection(probeFeature("750010", "2025-03-10T03:00:00.000Z"), probeFeature("750020", "2025-03-10T06:00:00.000Z"))
+	if err := m.ParseMultiforecast(strings.NewReader(stored)); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 3, 10, 3, 0, 0, 0, time.UTC); !m.ProbeRun.Equal(want) {
+		t.Fatalf("ProbeRun = %s, want %s", m.ProbeRun, want)
+	}
+
+	tests := []struct {
+		name    string
+		probed  string
+		changed bool
+	}{
+		{"same run", "2025-03-10T03:00:00.000Z", false},
+		// older than the latest run of the map, newer for this POI
+		{"new run of the first poi", "2025-03-10T04:00:00.000Z", true},
+	}
+	for _, tc := range tests {
+		probed = tc.probed
+		changed, err := cr.Probe(context.Background(), m)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if changed != tc.changed {
+			t.Errorf("%s: Probe() = %v, want %v", tc.name, changed, tc.changed)
+		}
+	}
+}
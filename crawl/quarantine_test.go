@@ -0,0 +1,72 @@
+package crawl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gometeo/quarantine"
+)
+
+func TestQuarantine(t *testing.T) {
+	const page = "<html><body>maintenance</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "token"})
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	q := quarantine.New(quarantine.Conf{Dir: t.TempDir()})
+	conf := testCrawlConf
+	conf.Upstream = srv.URL
+	conf.Quarantine = q
+	cr := NewCrawler(conf)
+	if _, err := cr.getMap(context.Background(), "/", nil); err == nil {
+		t.Fatal("getMap() on a page without json data: expected error")
+	}
+
+	entries, err := q.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("quarantine has %d entries, want 1", len(entries))
+	}
+	e, body, err := q.Load(entries[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Kind != KindHtml || e.URL != "/" || e.Err == "" || e.Header.Get("Content-Type") != "text/html" {
+		t.Errorf("quarantined entry got %+v", e)
+	}
+	if string(body) != page {
+		t.Errorf("quarantined body got %q", body)
+	}
+	// still fails on replay
+	if err := Replay(e.Kind, strings.NewReader(string(body))); err == nil {
+		t.Error("Replay() of a bad payload: expected error")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		kind    string
+		payload string
+		ok      bool
+	}{
+		{KindMultiforecast, `{"type": "FeatureCollection", "features": []}`, true},
+		{KindMultiforecast, `{"type": "Nope"}`, false},
+		{KindGeography, `{"type": "FeatureCollection", "bbox": [0, 40, 10, 50], "features": []}`, true},
+		{KindSvg, `<svg width="100px" height="100px" viewBox="0 0 100 100"></svg>`, true},
+		{"nope", ``, false},
+	}
+	for _, tc := range tests {
+		err := Replay(tc.kind, strings.NewReader(tc.payload))
+		if (err == nil) != tc.ok {
+			t.Errorf("Replay(%s, %s) got %v", tc.kind, tc.payload, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package crawl
+
+import (
+	"fmt"
+	"io"
+
+	"gometeo/mfmap"
+)
+
+// kinds of upstream payloads, named after their parser
+const (
+	KindHtml          = "html"
+	KindSvg           = "svg"
+	KindGeography     = "geography"
+	KindMultiforecast = "multiforecast"
+)
+
+// Replay feeds a payload of kind through the parser used by the crawler,
+// typically a quarantined one after a parser fix. Geography is parsed
+// without subzones, so all its features are dropped.
+func Replay(kind string, r io.Reader) error {
+	m := &mfmap.MfMap{Data: &mfmap.MapData{}}
+	switch kind {
+	case KindHtml:
+		return m.ParseHtml(r)
+	case KindSvg:
+		return m.ParseSvgMap(r)
+	case KindGeography:
+		return m.ParseGeography(r)
+	case KindMultiforecast:
+		return m.ParseMultiforecast(r)
+	}
+	return fmt.Errorf("unknown payload kind '%s'", kind)
+}
@@ -0,0 +1,217 @@
+package crawl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A tape is a directory of recorded upstream exchanges, one per request
+// key: a JSON file with the URL, status and response headers, and a raw
+// body file. Set-Cookie headers are kept so that replayed sessions get
+// their auth token, tapes must not be published.
+
+const (
+	tapeMetaExt = ".json"
+	tapeBodyExt = ".body"
+)
+
+// ErrNotRecorded is returned by ReplayTransport for requests missing from the tape
+var ErrNotRecorded = errors.New("request not recorded")
+
+// tapeEntry is the metadata file of a recorded exchange
+type tapeEntry struct {
+	Key    string      `json:"key"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// TapeKey normalizes a request into the key of its recorded exchange:
+// method, lowercase scheme and host without default port, path and sorted
+// query. Fragments, request headers and auth tokens are not part of it.
+func TapeKey(req *http.Request) string {
+	u := *req.URL
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	u.RawQuery = u.Query().Encode()
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method + " " + u.String()
+}
+
+// tapeName is the file name, without extension, of a request key
+func tapeName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:12])
+}
+
+// RecordTransport forwards requests to the upstream transport and records
+// every response into a tape directory, a newer response replacing an
+// older one with the same key. Error responses are recorded only for keys
+// not recorded yet, so that a transient upstream failure does not replace
+// a good exchange.
+type RecordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+// NewRecordTransport returns a transport recording into dir, created on the
+// first response. next is optional; nil uses http.DefaultTransport.
+func NewRecordTransport(dir string, next http.RoundTripper) *RecordTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RecordTransport{dir: dir, next: next}
+}
+
+// Dir returns the tape directory
+func (rt *RecordTransport) Dir() string {
+	return rt.dir
+}
+
+func (rt *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("record %s: %w", req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	entry := tapeEntry{
+		Key:    TapeKey(req),
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+	}
+	if resp.StatusCode >= http.StatusBadRequest && rt.recorded(entry.Key) {
+		return resp, nil
+	}
+	if err := rt.write(entry, body); err != nil {
+		return nil, fmt.Errorf("record %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
+
+// recorded tells whether the tape already has an exchange for key
+func (rt *RecordTransport) recorded(key string) bool {
+	_, err := os.Stat(filepath.Join(rt.dir, tapeName(key)+tapeMetaExt))
+	return err == nil
+}
+
+// write stores an exchange, through temp files renamed in place so that
+// a concurrent replay never reads a partial entry
+func (rt *RecordTransport) write(entry tapeEntry, body []byte) error {
+	if err := os.MkdirAll(rt.dir, 0o755); err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(rt.dir, tapeName(entry.Key))
+	for _, f := range []struct {
+		ext  string
+		data []byte
+	}{
+		{tapeBodyExt, body},
+		{tapeMetaExt, meta},
+	} {
+		tmp, err := os.CreateTemp(rt.dir, ".tape-*")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Write(f.data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), name+f.ext)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayTransport serves responses from a tape directory, without any
+// network access. Requests missing from the tape fail with ErrNotRecorded.
+type ReplayTransport struct {
+	dir string
+}
+
+// NewReplayTransport returns a transport replaying the tape in dir, which
+// must exist.
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &ReplayTransport{dir: dir}, nil
+}
+
+// Dir returns the tape directory
+func (rt *ReplayTransport) Dir() string {
+	return rt.dir
+}
+
+func (rt *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := TapeKey(req)
+	name := filepath.Join(rt.dir, tapeName(key))
+	meta, err := os.ReadFile(name + tapeMetaExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("replay %s: %w", key, ErrNotRecorded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", key, err)
+	}
+	var entry tapeEntry
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		return nil, fmt.Errorf("replay %s: %w", key, err)
+	}
+	body, err := os.ReadFile(name + tapeBodyExt)
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", key, err)
+	}
+	if entry.Header == nil {
+		entry.Header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
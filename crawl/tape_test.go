@@ -0,0 +1,145 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTapeKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"https://rpcache-aa.meteofrance.com/a?x=1&y=2", "https://RPCACHE-AA.meteofrance.com:443/a?y=2&x=1", true},
+		{"http://localhost:80/a", "http://localhost/a", true},
+		{"https://meteofrance.com/a?x=1", "https://meteofrance.com/a?x=2", false},
+		{"https://meteofrance.com/a", "https://meteofrance.com/b", false},
+	}
+	for _, tc := range tests {
+		ka := TapeKey(httptest.NewRequest(http.MethodGet, tc.a, nil))
+		kb := TapeKey(httptest.NewRequest(http.MethodGet, tc.b, nil))
+		if (ka == kb) != tc.same {
+			t.Errorf("TapeKey(%s)=%s, TapeKey(%s)=%s, want same=%v", tc.a, ka, tc.b, kb, tc.same)
+		}
+	}
+}
+
+func TestTapeRecordReplay(t *testing.T) {
+	const page = "<html>recorded</html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "gbxra"})
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	dir := t.TempDir()
+
+	get := func(cl *Client, path string) (string, error) {
+		body, err := cl.Get(context.Background(), path, CacheDisabled)
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		b, err := io.ReadAll(body)
+		return string(b), err
+	}
+
+	// record a session, with a 404
+	rec := NewClient(srv.URL, NewRecordTransport(dir, nil))
+	if got, err := get(rec, "/page?b=2&a=1"); err != nil || got != page {
+		t.Fatalf("recording got %q, %v", got, err)
+	}
+	if _, err := get(rec, "/missing"); err == nil {
+		t.Fatal("recording /missing: expected error")
+	}
+	srv.Close()
+
+	// replay it offline, token included
+	rt, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	play := NewClient(srv.URL, rt)
+	if got, err := get(play, "/page?a=1&b=2"); err != nil || got != page {
+		t.Errorf("replay got %q, %v", got, err)
+	}
+	if tok := play.token.Get(); tok != "token" {
+		t.Errorf("replayed token is %q, want %q", tok, "token")
+	}
+	if _, err := get(play, "/missing"); err == nil {
+		t.Error("replay of a recorded 404: expected error")
+	}
+	if _, err := get(play, "/other"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("replay of an unrecorded request got %v, want ErrNotRecorded", err)
+	}
+
+	if _, err := NewReplayTransport(dir + "/nowhere"); err == nil {
+		t.Error("NewReplayTransport() on a missing dir: expected error")
+	}
+}
+
+func TestTapeKeepsGoodExchange(t *testing.T) {
+	// upstream answers each path with the statuses listed, in turn
+	statuses := map[string][]int{
+		"/flaky":     {http.StatusOK, http.StatusServiceUnavailable},
+		"/recovered": {http.StatusServiceUnavailable, http.StatusOK},
+		"/updated":   {http.StatusOK, http.StatusOK},
+	}
+	var mutex sync.Mutex
+	calls := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		n := calls[r.URL.Path]
+		calls[r.URL.Path]++
+		mutex.Unlock()
+		w.WriteHeader(statuses[r.URL.Path][n])
+		fmt.Fprintf(w, "call %d", n)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	rec := &http.Client{Transport: NewRecordTransport(dir, nil)}
+	for range 2 {
+		for path := range statuses {
+			resp, err := rec.Get(srv.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	}
+
+	rt, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	play := &http.Client{Transport: rt}
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/flaky", http.StatusOK, "call 0"}, // the error did not replace it
+		{"/recovered", http.StatusOK, "call 1"},
+		{"/updated", http.StatusOK, "call 1"},
+	}
+	for _, tc := range tests {
+		resp, err := play.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || string(b) != tc.body {
+			t.Errorf("replay %s got %d %q, want %d %q", tc.path, resp.StatusCode, b, tc.status, tc.body)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package crawl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TransportConf holds the network settings of the upstream client.
+// Zero values keep the defaults of http.DefaultTransport.
+type TransportConf struct {
+	Proxy    string // http, https or socks5 proxy url; empty uses HTTP_PROXY/HTTPS_PROXY
+	BindAddr string // local source address of outgoing connections; empty lets the OS choose
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+
+	CAFile string // PEM root certificates trusted besides the system pool
+}
+
+// keepAlive is the TCP keep-alive period of upstream connections,
+// the one of http.DefaultTransport
+const keepAlive = 30 * time.Second
+
+// NewTransport returns a transport to upstream built from conf, or an
+// error if the proxy url, bind address or CA file is invalid.
+func NewTransport(conf TransportConf) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	if conf.Proxy != "" {
+		u, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url '%s': %w", conf.Proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy url '%s': scheme must be http, https, socks5 or socks5h", conf.Proxy)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url '%s': missing host", conf.Proxy)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: keepAlive}
+	if conf.DialTimeout > 0 {
+		dialer.Timeout = conf.DialTimeout
+	}
+	if conf.BindAddr != "" {
+		ip, err := netip.ParseAddr(conf.BindAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bind address '%s': %w", conf.BindAddr, err)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	}
+	tr.DialContext = dialer.DialContext
+
+	if conf.TLSHandshakeTimeout > 0 {
+		tr.TLSHandshakeTimeout = conf.TLSHandshakeTimeout
+	}
+	if conf.ResponseHeaderTimeout > 0 {
+		tr.ResponseHeaderTimeout = conf.ResponseHeaderTimeout
+	}
+	if conf.MaxConnsPerHost > 0 {
+		tr.MaxConnsPerHost = conf.MaxConnsPerHost
+	}
+	if conf.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = conf.MaxIdleConnsPerHost
+	}
+
+	if conf.CAFile != "" {
+		pool, err := loadCAFile(conf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return tr, nil
+}
+
+// loadCAFile returns the system cert pool extended with the PEM
+// certificates of path, an error if it holds none
+func loadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("invalid CA file '%s': no PEM certificate", path)
+	}
+	return pool, nil
+}
+
+// Settings returns the non-default settings of conf as name/value pairs,
+// in a stable order, for display
+func (conf TransportConf) Settings() [][2]string {
+	var s [][2]string
+	add := func(name, value string) {
+		s = append(s, [2]string{name, value})
+	}
+	if conf.Proxy != "" {
+		add("proxy", redactURL(conf.Proxy))
+	}
+	if conf.BindAddr != "" {
+		add("bind address", conf.BindAddr)
+	}
+	if conf.DialTimeout > 0 {
+		add("dial timeout", conf.DialTimeout.String())
+	}
+	if conf.TLSHandshakeTimeout > 0 {
+		add("tls handshake timeout", conf.TLSHandshakeTimeout.String())
+	}
+	if conf.ResponseHeaderTimeout > 0 {
+		add("response header timeout", conf.ResponseHeaderTimeout.String())
+	}
+	if conf.MaxConnsPerHost > 0 {
+		add("max conns per host", fmt.Sprint(conf.MaxConnsPerHost))
+	}
+	if conf.MaxIdleConnsPerHost > 0 {
+		add("max idle conns per host", fmt.Sprint(conf.MaxIdleConnsPerHost))
+	}
+	if conf.CAFile != "" {
+		add("CA file", conf.CAFile)
+	}
+	return s
+}
+
+// redactURL hides the password of a proxy url
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"gometeo/fakeupstream"
+)
+
+// fakeUpstream is the 'fakeupstream' subcommand. It serves a synthetic
+// meteofrance.com for local development:
+//
+//	gometeo fakeupstream [-addr :1052] [-latency 2s] [-errors 0.1] ...
+//	gometeo -upstream http://localhost:1052 -apiurl http://localhost:1052/internet2018client/2.0
+//
+// Returns the exit code when the server stops.
+func fakeUpstream(args []string) int {
+	f := flag.NewFlagSet("fakeupstream", flag.ContinueOnError)
+	addr := f.String("addr", ":1052", "listening address")
+	var conf fakeupstream.Conf
+	f.DurationVar(&conf.Latency, "latency", 0, "delay before each response")
+	f.Float64Var(&conf.ErrorRate, "errors", 0, "share of 503 responses")
+	f.Float64Var(&conf.NoCookieRate, "nocookie", 0, "share of responses without session cookie")
+	f.Float64Var(&conf.MalformedRate, "malformed", 0, "share of truncated JSON payloads")
+	f.BoolVar(&conf.SchemaChange, "schemachange", false, "rename and add fields of multiforecast payloads")
+	f.Uint64Var(&conf.Seed, "seed", 1, "seed of generated forecasts and injected failures")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+	for name, rate := range map[string]float64{"errors": conf.ErrorRate, "nocookie": conf.NoCookieRate, "malformed": conf.MalformedRate} {
+		if rate < 0 || rate > 1 {
+			fmt.Fprintf(os.Stderr, "fakeupstream: invalid flag -%s '%g', want in [0,1]\n", name, rate)
+			return 2
+		}
+	}
+
+	slog.Info("fake upstream", "addr", *addr, "apiPath", fakeupstream.ApiPath, "latency", conf.Latency, "errors", conf.ErrorRate, "nocookie", conf.NoCookieRate, "malformed", conf.MalformedRate, "schemachange", conf.SchemaChange, "seed", conf.Seed)
+	if err := http.ListenAndServe(*addr, fakeupstream.New(conf)); err != nil {
+		slog.Error("fake upstream error", "err", err)
+		return 1
+	}
+	return 0
+}
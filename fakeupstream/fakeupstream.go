@@ -0,0 +1,208 @@
+// Package fakeupstream serves a synthetic meteofrance.com, for local
+// development and integration tests without the real upstream.
+//
+// The site is a small metropolitan tree (France, 2 regions, 4 departments)
+// with html pages embedding drupal settings, SVG maps, geography, pictos
+// and a multiforecast api. Forecasts are generated, deterministic for a
+// seed and a forecast run. Failures can be injected: latency, 5xx
+// responses, missing session cookies, malformed JSON and a changed
+// multiforecast schema.
+//
+// Pages and api share a single host: the api base of the drupal settings
+// is the real one, point gometeo -apiurl at ApiPath instead.
+package fakeupstream
+
+import (
+	"bytes"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gometeo/clock"
+)
+
+const (
+	// ApiPath is the base path of the forecast api
+	ApiPath = "/internet2018client/2.0"
+
+	sessionCookie = "mfsession"
+	// the cookie holds the rot13 of the bearer token expected by the api
+	cookieValue = "snxr-hcfgernz"
+	bearerToken = "fake-upstream"
+
+	assetsPath = "/modules/custom/mf_map_layers_v2/maps/desktop/" + pathAssets + "/"
+	pictosPath = "/modules/custom/mf_tools_common_theme_public/svg/weather/"
+	svgSize    = 600
+)
+
+// Conf holds the failures injected into responses. Rates are in [0,1].
+type Conf struct {
+	Latency       time.Duration // delay before each response
+	ErrorRate     float64       // share of 503 responses
+	NoCookieRate  float64       // share of responses without session cookie
+	MalformedRate float64       // share of truncated JSON payloads
+	SchemaChange  bool          // multiforecast renames "T" and adds a field
+	Seed          uint64        // forecasts and failures are stable for a seed
+	Clock         clock.Clock   // optional; nil is the system clock
+}
+
+// Server is the fake upstream http.Handler. Safe for concurrent use.
+type Server struct {
+	conf  Conf
+	clock clock.Clock
+	site  *site
+	mux   *http.ServeMux
+
+	mutex sync.Mutex
+	rand  *rand.Rand // failure injection
+}
+
+// New returns a fake upstream injecting the failures of conf
+func New(conf Conf) *Server {
+	s := &Server{
+		conf:  conf,
+		clock: clock.Or(conf.Clock),
+		site:  newSite(),
+		mux:   http.NewServeMux(),
+		rand:  rand.New(rand.NewPCG(conf.Seed, 0)),
+	}
+	s.mux.HandleFunc("GET "+ApiPath+"/multiforecast", s.handleMultiforecast)
+	s.mux.HandleFunc("GET "+assetsPath+"geo_json/{file}", s.handleGeography)
+	s.mux.HandleFunc("GET "+assetsPath+"{file}", s.handleSvg)
+	s.mux.HandleFunc("GET "+pictosPath+"{file}", s.handlePicto)
+	s.mux.HandleFunc("GET /", s.handlePage)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.conf.Latency > 0 {
+		select {
+		case <-time.After(s.conf.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if s.chance(s.conf.ErrorRate) {
+		slog.Debug("fakeupstream: injected error", "path", r.URL.Path)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// chance returns true with probability rate
+func (s *Server) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rand.Float64() < rate
+}
+
+// write sends a response, with a session cookie unless injected otherwise.
+// JSON payloads may be truncated.
+func (s *Server) write(w http.ResponseWriter, contentType string, body []byte, cookie, isJson bool) {
+	if cookie && !s.chance(s.conf.NoCookieRate) {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: cookieValue, Path: "/"})
+	}
+	if isJson && s.chance(s.conf.MalformedRate) {
+		body = body[:len(body)/2]
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	z, ok := s.site.byPath[strings.TrimSuffix(r.URL.Path, "/")]
+	if r.URL.Path == "/" {
+		z, ok = s.site.byPath["/"]
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	settings, err := s.site.drupalSettings(z)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s.chance(s.conf.MalformedRate) {
+		settings = settings[:len(settings)/2]
+	}
+	var buf bytes.Buffer
+	err = pageTemplate.Execute(&buf, struct {
+		Name     string
+		Settings string
+	}{z.name, string(settings)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.write(w, "text/html; charset=UTF-8", buf.Bytes(), true, false)
+}
+
+func (s *Server) handleSvg(w http.ResponseWriter, r *http.Request) {
+	z, ok := s.site.byFile[strings.TrimSuffix(r.PathValue("file"), ".svg")]
+	if !ok || !strings.HasSuffix(r.PathValue("file"), ".svg") {
+		http.NotFound(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	err := svgTemplate.Execute(&buf, struct {
+		Name string
+		Size int
+	}{z.name, svgSize})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.write(w, "image/svg+xml", buf.Bytes(), true, false)
+}
+
+func (s *Server) handleGeography(w http.ResponseWriter, r *http.Request) {
+	z, ok := s.site.byFile[strings.TrimSuffix(r.PathValue("file"), "-aggrege.json")]
+	if !ok || !strings.HasSuffix(r.PathValue("file"), "-aggrege.json") {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := s.site.geography(z)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.write(w, "application/json", body, true, true)
+}
+
+func (s *Server) handlePicto(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".svg")
+	if !ok || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	if err := pictoTemplate.Execute(&buf, name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.write(w, "image/svg+xml", buf.Bytes(), true, false)
+}
+
+// handleMultiforecast checks the bearer token minted by the session
+// cookie, like upstream. Api responses have no cookie.
+func (s *Server) handleMultiforecast(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+bearerToken {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ids := strings.Split(r.URL.Query().Get("liste_id"), ",")
+	body, err := s.multiforecast(ids, s.clock.Now(), s.conf.SchemaChange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.write(w, "application/json", body, false, true)
+}
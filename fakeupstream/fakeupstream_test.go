@@ -0,0 +1,196 @@
+package fakeupstream_test
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gometeo/clock"
+	"gometeo/crawl"
+	"gometeo/fakeupstream"
+	gj "gometeo/geojson"
+	"gometeo/mfmap"
+	"gometeo/schema"
+)
+
+// crawlFake crawls a fake upstream from "/" and returns the names of the
+// maps and the number of pictos received
+func crawlFake(t *testing.T, conf fakeupstream.Conf, mconf mfmap.MapConf) ([]string, int) {
+	t.Helper()
+	maps, pictos := crawlRoots(t, conf, mconf, []string{"/"})
+	var names []string
+	for _, m := range maps {
+		names = append(names, m.Name())
+	}
+	slices.Sort(names)
+	return names, pictos
+}
+
+// crawlRoots crawls a fake upstream from roots and returns the maps and
+// the number of pictos received
+func crawlRoots(t *testing.T, conf fakeupstream.Conf, mconf mfmap.MapConf, roots []string) ([]*mfmap.MfMap, int) {
+	t.Helper()
+	srv := httptest.NewServer(fakeupstream.New(conf))
+	defer srv.Close()
+
+	mconf.Upstream = srv.URL
+	mconf.Hosts.ApiBase = srv.URL + fakeupstream.ApiPath
+	mconf.Clock = conf.Clock
+	cr := crawl.NewCrawler(crawl.CrawlConf{Upstream: srv.URL, MapConf: mconf})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	chMap, chPicto := cr.FetchRoots(ctx, roots, 0)
+
+	var maps []*mfmap.MfMap
+	var pictos int
+	for chMap != nil || chPicto != nil {
+		select {
+		case m, ok := <-chMap:
+			if !ok {
+				chMap = nil
+				continue
+			}
+			if len(m.Prevs) == 0 || len(m.SvgMap) == 0 {
+				t.Errorf("map %s has no forecasts or svg", m.Name())
+			}
+			maps = append(maps, m)
+		case _, ok := <-chPicto:
+			if !ok {
+				chPicto = nil
+				continue
+			}
+			pictos++
+		}
+	}
+	return maps, pictos
+}
+
+func TestCrawl(t *testing.T) {
+	now := clock.At(time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC))
+	names, pictos := crawlFake(t, fakeupstream.Conf{Seed: 1, Clock: now}, mfmap.MapConf{})
+	want := []string{"Alpes-Maritimes", "Bouches-du-Rhône", "France", "Hauts-de-Seine", "Paris", "Provence-Alpes-Côte d'Azur", "Île-de-France"}
+	if !slices.Equal(names, want) {
+		t.Errorf("crawl got maps %v, want %v", names, want)
+	}
+	if pictos == 0 {
+		t.Error("crawl got no pictos")
+	}
+}
+
+func TestCrawlZones(t *testing.T) {
+	now := clock.At(time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC))
+	// one root of each family
+	roots := make(map[string]string)
+	for _, k := range mfmap.ZoneKinds {
+		for _, root := range k.Roots {
+			if k.Name != "outremer" || strings.HasSuffix(root, "/974") {
+				roots[k.Name] = root
+			}
+		}
+	}
+	crawled, _ := crawlRoots(t, fakeupstream.Conf{Seed: 1, Clock: now}, mfmap.MapConf{}, []string{roots["outremer"], roots["montagne"], roots["marine"]})
+
+	tests := []struct {
+		path     string
+		bounds   gj.Bounds
+		subzones []string // customPath of geography features
+		overview bool
+	}{
+		{path: "la-reunion", bounds: gj.BoundsOf("974")},
+		{path: "meteo-montagne", bounds: gj.Metropole, subzones: []string{"meteo-montagne/chablais"}, overview: true},
+		{path: "meteo-montagne/chablais", bounds: gj.Metropole},
+		{path: "meteo-marine", bounds: gj.Metropole, subzones: []string{"meteo-marine/cote-d-azur"}, overview: true},
+		{path: "meteo-marine/cote-d-azur", bounds: gj.Metropole},
+	}
+	byPath := make(map[string]*mfmap.MfMap)
+	for _, m := range crawled {
+		byPath[m.Path()] = m
+	}
+	if len(byPath) != len(tests) {
+		t.Errorf("crawl got maps %v, want %d", slices.Sorted(maps.Keys(byPath)), len(tests))
+	}
+	for _, tc := range tests {
+		m, ok := byPath[tc.path]
+		if !ok {
+			t.Errorf("map %s not crawled", tc.path)
+			continue
+		}
+		if got := m.Bounds(); got != tc.bounds {
+			t.Errorf("%s: Bounds() = %v, want %v", tc.path, got, tc.bounds)
+		}
+		if err := m.Geography.Check(tc.bounds); err != nil {
+			t.Errorf("%s: geography %v", tc.path, err)
+		}
+		var subzones []string
+		for _, f := range m.Geography.Features {
+			subzones = append(subzones, f.Properties.CustomPath)
+		}
+		if !slices.Equal(subzones, tc.subzones) {
+			t.Errorf("%s: subzones %v, want %v", tc.path, subzones, tc.subzones)
+		}
+		if m.IsOverview() != tc.overview {
+			t.Errorf("%s: IsOverview() = %v", tc.path, m.IsOverview())
+		}
+	}
+	// Réunion POIs keep their own timezone
+	if m := byPath["la-reunion"]; m != nil {
+		for _, f := range m.Data.Children {
+			if f.Timezone != "Indian/Reunion" {
+				t.Errorf("la-reunion: POI %s timezone %s", f.Insee, f.Timezone)
+			}
+		}
+	}
+}
+
+func TestFailures(t *testing.T) {
+	now := clock.At(time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC))
+	tests := map[string]fakeupstream.Conf{
+		"errors":    {ErrorRate: 1},
+		"no cookie": {NoCookieRate: 1},
+		"malformed": {MalformedRate: 1},
+	}
+	for name, conf := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.Clock = now
+			if names, _ := crawlFake(t, conf, mfmap.MapConf{}); len(names) != 0 {
+				t.Errorf("crawl got maps %v, want none", names)
+			}
+		})
+	}
+
+	t.Run("schema change", func(t *testing.T) {
+		checker := schema.New(now)
+		// first crawl is the baseline
+		crawlFake(t, fakeupstream.Conf{Clock: now}, mfmap.MapConf{Schema: checker})
+		crawlFake(t, fakeupstream.Conf{Clock: now, SchemaChange: true}, mfmap.MapConf{Schema: checker})
+		var changes []string
+		for _, inv := range checker.Inventories() {
+			for _, ch := range inv.Changes {
+				changes = append(changes, string(ch.Kind)+" "+ch.Path)
+			}
+		}
+		for _, want := range []string{"added features[].properties.forecast[].temperature", "removed features[].properties.forecast[].T"} {
+			if !slices.Contains(changes, want) {
+				t.Errorf("schema changes %v, missing %s", changes, want)
+			}
+		}
+	})
+}
+
+func TestApiToken(t *testing.T) {
+	srv := httptest.NewServer(fakeupstream.New(fakeupstream.Conf{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + fakeupstream.ApiPath + "/multiforecast?liste_id=751010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("api without token got %s, want 401", resp.Status)
+	}
+}
@@ -0,0 +1,156 @@
+package fakeupstream
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	shortTermDays = 4  // days with forecasts per moment, from today
+	dailyDays     = 14 // days with a daily forecast, from today
+	runInterval   = 6 * time.Hour
+)
+
+// moments of a day, with the local hour of their forecast and a
+// temperature offset. Night is after midnight, on the next day.
+var moments = []struct {
+	name   string
+	hour   int
+	offset float64
+	night  bool
+}{
+	{"matin", 8, -3, false},
+	{"après-midi", 14, 4, false},
+	{"soirée", 20, 1, false},
+	{"nuit", 26, -5, true},
+}
+
+var (
+	windIcons = []string{"N", "NE", "E", "SE", "S", "SO", "O", "NO"}
+	weathers  = []struct{ icon, desc string }{
+		{"p1", "Ensoleillé"},
+		{"p2", "Peu nuageux"},
+		{"p3", "Eclaircies"},
+		{"p5", "Très nuageux"},
+		{"p12", "Averses"},
+		{"p14", "Pluie"},
+		{"p16", "Orages"},
+	}
+)
+
+// run returns the time of the forecast run current at now
+func run(now time.Time) time.Time {
+	return now.UTC().Truncate(runInterval)
+}
+
+// rng returns a random source for the forecasts of p on day d of a run,
+// stable for a seed
+func (s *Server) rng(p *poi, run time.Time, d time.Time) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(p.insee))
+	h.Write([]byte(d.Format(time.DateOnly)))
+	return rand.New(rand.NewPCG(s.conf.Seed^h.Sum64(), uint64(run.Unix())))
+}
+
+// multiforecast returns the forecasts of the POIs of ids, unknown ones are
+// skipped. With schemaChange, "T" is renamed and a field is added.
+func (s *Server) multiforecast(ids []string, now time.Time, schemaChange bool) ([]byte, error) {
+	r := run(now)
+	features := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		p, ok := s.site.pois[id]
+		if !ok {
+			continue
+		}
+		local := p.locality()
+		loc, err := time.LoadLocation(local.timezone)
+		if err != nil {
+			return nil, err
+		}
+		y, m, d := now.In(loc).Date()
+		today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		// climate: cooler in the north and in altitude, tropical overseas
+		lat := p.lat
+		if _, ok := overseas[p.dept]; ok {
+			lat = 30
+		}
+		base := 20 - (lat-43)*1.2 - float64(p.altitude)/150
+		forecasts := make([]map[string]any, 0, shortTermDays*len(moments))
+		dailies := make([]map[string]any, 0, dailyDays)
+		for i := range dailyDays {
+			day := today.AddDate(0, 0, i)
+			rnd := s.rng(p, r, day)
+			drift := rnd.Float64()*6 - 3
+			w := weathers[rnd.IntN(len(weathers))]
+			tmin, tmax := math.Inf(1), math.Inf(-1)
+			for _, mo := range moments {
+				t := math.Round((base+drift+mo.offset+rnd.Float64()*2-1)*10) / 10
+				tmin, tmax = math.Min(tmin, t), math.Max(tmax, t)
+				if i >= shortTermDays {
+					continue
+				}
+				speed := 5 + rnd.IntN(35)
+				dir := rnd.IntN(36) * 10
+				icon := w.icon + "j"
+				if mo.night {
+					icon = w.icon + "n"
+				}
+				f := map[string]any{
+					"moment_day":               mo.name,
+					"time":                     day.Add(time.Duration(mo.hour) * time.Hour).UTC(),
+					"T":                        t,
+					"T_windchill":              math.Round((t-float64(speed)/10)*10) / 10,
+					"wind_speed":               speed,
+					"wind_speed_gust":          speed + 10 + rnd.IntN(30),
+					"wind_direction":           dir,
+					"wind_icon":                windIcons[(dir+22)%360/45],
+					"iso0":                     1500 + rnd.IntN(2000),
+					"total_cloud_cover":        rnd.IntN(101),
+					"weather_icon":             icon,
+					"weather_description":      w.desc,
+					"relative_humidity":        40 + rnd.IntN(55),
+					"P_sea":                    math.Round((1015+rnd.Float64()*20-10)*10) / 10,
+					"weather_confidence_index": 1 + rnd.IntN(4),
+				}
+				if schemaChange {
+					f["temperature"] = f["T"]
+					delete(f, "T")
+					f["T_sea"] = math.Round((base-4)*10) / 10
+				}
+				forecasts = append(forecasts, f)
+			}
+			dailies = append(dailies, map[string]any{
+				"time":                      day.UTC(),
+				"T_min":                     tmin,
+				"T_max":                     tmax,
+				"relative_humidity_min":     30 + rnd.IntN(30),
+				"relative_humidity_max":     65 + rnd.IntN(35),
+				"uv_index":                  1 + rnd.IntN(8),
+				"daily_weather_icon":        w.icon + "j",
+				"daily_weather_description": w.desc,
+			})
+		}
+		features = append(features, map[string]any{
+			"update_time": r,
+			"type":        "Feature",
+			"geometry":    map[string]any{"type": "Point", "coordinates": []float64{p.lng, p.lat}},
+			"properties": map[string]any{
+				"name":              p.name,
+				"country":           local.country,
+				"french_department": p.dept,
+				"timezone":          local.timezone,
+				"insee":             p.insee,
+				"altitude":          p.altitude,
+				"forecast":          forecasts,
+				"daily_forecast":    dailies,
+			},
+		})
+	}
+	return json.Marshal(map[string]any{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
@@ -0,0 +1,245 @@
+package fakeupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+)
+
+// zone is a map page of the synthetic site
+type zone struct {
+	id       string // field_id_technique
+	name     string
+	path     string
+	taxonomy string
+	subzones []string // ids of child zones
+	pois     []string // insee codes of the points of interest
+}
+
+// poi is a city with forecasts
+type poi struct {
+	insee      string
+	name       string
+	dept       string
+	codePostal string
+	lat, lng   float64
+	altitude   int
+}
+
+const (
+	pathAssets = "METROPOLE"
+	apiSite    = "rpcache-aa"
+	apiBaseUrl = "meteofrance.com/internet2018client/2.0"
+	timezone   = "Europe/Paris"
+	country    = "FR - France"
+)
+
+// locality is the timezone and country of POIs out of metropolitan France
+type locality struct {
+	timezone, country string
+}
+
+// overseas localities by department
+var overseas = map[string]locality{
+	"974": {"Indian/Reunion", "RE - Réunion"},
+}
+
+// locality returns the timezone and country of p
+func (p *poi) locality() locality {
+	if l, ok := overseas[p.dept]; ok {
+		return l
+	}
+	return locality{timezone, country}
+}
+
+// a small metropolitan tree: France, 2 regions, 4 departments, and one
+// map of each zone family: an overseas department, a massif of the
+// mountain root and a coastal zone of the marine root
+var zones = []zone{
+	{"PAYS007", "France", "/", "PAYS", []string{"REGIN11", "REGIN93"}, []string{"751010", "130550", "060880"}},
+	{"REGIN11", "Île-de-France", "/previsions-meteo-france/ile-de-france/7", "REGION", []string{"DEPT75", "DEPT92"}, []string{"751010", "920120", "920500"}},
+	{"REGIN93", "Provence-Alpes-Côte d'Azur", "/previsions-meteo-france/provence-alpes-cote-d-azur/12", "REGION", []string{"DEPT13", "DEPT06"}, []string{"130550", "130010", "060880", "060290"}},
+	{"DEPT75", "Paris", "/previsions-meteo-france/paris/75", "DEPARTEMENT", nil, []string{"751010"}},
+	{"DEPT92", "Hauts-de-Seine", "/previsions-meteo-france/hauts-de-seine/92", "DEPARTEMENT", nil, []string{"920120", "920500"}},
+	{"DEPT13", "Bouches-du-Rhône", "/previsions-meteo-france/bouches-du-rhone/13", "DEPARTEMENT", nil, []string{"130550", "130010"}},
+	{"DEPT06", "Alpes-Maritimes", "/previsions-meteo-france/alpes-maritimes/06", "DEPARTEMENT", nil, []string{"060880", "060290"}},
+	{"DEPT974", "La Réunion", "/previsions-meteo-france/la-reunion/974", "DEPARTEMENT", nil, []string{"974110", "974160"}},
+	{"MONTAGNE001", "Montagne", "/meteo-montagne", "MONTAGNE", []string{"MASSIF01"}, []string{"741910"}},
+	{"MASSIF01", "Chablais", "/meteo-montagne/chablais/1", "MASSIF", nil, []string{"741910", "740010"}},
+	{"MARINE001", "Marine", "/meteo-marine", "MARINE", []string{"COTE01"}, []string{"060040"}},
+	{"COTE01", "Côte d'Azur", "/meteo-marine/cote-d-azur/1", "COTE", nil, []string{"060040", "060880"}},
+}
+
+var pois = []poi{
+	{"751010", "Paris", "75", "75000", 48.8566, 2.3522, 35},
+	{"920120", "Boulogne-Billancourt", "92", "92100", 48.8352, 2.2410, 35},
+	{"920500", "Nanterre", "92", "92000", 48.8924, 2.2071, 40},
+	{"130550", "Marseille", "13", "13000", 43.2965, 5.3698, 12},
+	{"130010", "Aix-en-Provence", "13", "13100", 43.5297, 5.4474, 173},
+	{"060880", "Nice", "06", "06000", 43.7102, 7.2620, 10},
+	{"060290", "Cannes", "06", "06400", 43.5528, 7.0174, 2},
+	{"060040", "Antibes", "06", "06600", 43.5808, 7.1239, 5},
+	{"741910", "Morzine", "74", "74110", 46.1792, 6.7089, 1000},
+	{"740010", "Abondance", "74", "74360", 46.2790, 6.7213, 930},
+	{"974110", "Saint-Denis", "974", "97400", -20.8823, 55.4504, 30},
+	{"974160", "Saint-Pierre", "974", "97410", -21.3393, 55.4781, 10},
+}
+
+// site indexes the synthetic zones and POIs
+type site struct {
+	byPath map[string]*zone // by page path
+	byId   map[string]*zone
+	byFile map[string]*zone // by lowercase id, the base name of svg and geography files
+	pois   map[string]*poi  // by insee
+}
+
+func newSite() *site {
+	s := &site{
+		byPath: make(map[string]*zone),
+		byId:   make(map[string]*zone),
+		byFile: make(map[string]*zone),
+		pois:   make(map[string]*poi),
+	}
+	for i := range zones {
+		z := &zones[i]
+		s.byPath[z.path] = z
+		s.byId[z.id] = z
+		s.byFile[strings.ToLower(z.id)] = z
+	}
+	for i := range pois {
+		s.pois[pois[i].insee] = &pois[i]
+	}
+	return s
+}
+
+// drupalSettings returns the json embedded in the html page of z
+func (s *site) drupalSettings(z *zone) ([]byte, error) {
+	children := make([]map[string]any, 0, len(z.pois))
+	for _, insee := range z.pois {
+		p := s.pois[insee]
+		children = append(children, map[string]any{
+			"title": p.name,
+			// upstream mixes string and numeric coordinates
+			"lat":         fmt.Sprintf("%.4f", p.lat),
+			"lng":         p.lng,
+			"path":        fmt.Sprintf("/previsions-meteo-france/%s/%s", slug(p.name), p.codePostal),
+			"insee":       p.insee,
+			"taxonomy":    "VILLE_FRANCE",
+			"code_postal": p.codePostal,
+			"timezone":    p.locality().timezone,
+		})
+	}
+	// upstream sends an empty array instead of an empty object
+	var subzones any = []string{}
+	if len(z.subzones) > 0 {
+		m := make(map[string]any)
+		for _, id := range z.subzones {
+			sz := s.byId[id]
+			m[id] = map[string]any{"path": sz.path, "name": sz.name}
+		}
+		subzones = m
+	}
+	return json.Marshal(map[string]any{
+		"path": map[string]any{"baseUrl": "/", "currentPath": strings.TrimPrefix(z.path, "/")},
+		"mf_map_layers_v2": map[string]any{
+			"nid":                fmt.Sprint(1000 + len(z.id)*7 + len(z.name)),
+			"name":               z.name,
+			"path":               z.path,
+			"taxonomy":           z.taxonomy,
+			"path_assets":        pathAssets,
+			"field_id_technique": z.id,
+		},
+		"mf_map_layers_v2_children_poi": children,
+		"mf_map_layers_v2_sub_zone":     subzones,
+		"mf_tools_common": map[string]any{
+			"alias": strings.TrimPrefix(z.path, "/"),
+			"config": map[string]any{
+				"base_url": apiBaseUrl,
+				"site":     apiSite,
+				"domain":   "meteofrance.com",
+			},
+		},
+	})
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="fr" dir="ltr">
+<head>
+<meta charset="utf-8">
+<title>Prévisions météo {{.Name}} | Météo-France</title>
+</head>
+<body>
+<h1>Météo {{.Name}}</h1>
+<div id="map"></div>
+<script type="application/json" data-drupal-selector="drupal-settings-json">{{.Settings}}</script>
+</body>
+</html>
+`))
+
+// bbox is w, n, e, s like upstream geojson
+type bbox [4]float64
+
+// bounds returns the bbox around the POIs of z, with a margin
+func (s *site) bounds(z *zone) bbox {
+	b := bbox{math.Inf(1), math.Inf(-1), math.Inf(-1), math.Inf(1)}
+	for _, insee := range z.pois {
+		p := s.pois[insee]
+		b[0] = math.Min(b[0], p.lng-0.3)
+		b[1] = math.Max(b[1], p.lat+0.3)
+		b[2] = math.Max(b[2], p.lng+0.3)
+		b[3] = math.Min(b[3], p.lat-0.3)
+	}
+	return b
+}
+
+// geography returns the geojson of the subzones of z, as rectangles
+func (s *site) geography(z *zone) ([]byte, error) {
+	features := make([]map[string]any, 0, len(z.subzones))
+	for _, id := range z.subzones {
+		sz := s.byId[id]
+		b := s.bounds(sz)
+		features = append(features, map[string]any{
+			"type": "Feature",
+			"bbox": b,
+			"properties": map[string]any{
+				"prop0": map[string]any{
+					"nom":   sz.name,
+					"cible": sz.id,
+					"paths": map[string]any{"fr": sz.path, "en": sz.path, "es": sz.path},
+				},
+			},
+			"geometry": map[string]any{
+				"type": "Polygon",
+				"coordinates": [][][2]float64{{
+					{b[0], b[1]}, {b[2], b[1]}, {b[2], b[3]}, {b[0], b[3]}, {b[0], b[1]},
+				}},
+			},
+		})
+	}
+	return json.Marshal(map[string]any{
+		"type":     "FeatureCollection",
+		"bbox":     s.bounds(z),
+		"features": features,
+	})
+}
+
+var svgTemplate = template.Must(template.New("svg").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Size}}px" height="{{.Size}}px" viewBox="0 0 {{.Size}} {{.Size}}">
+<rect x="0" y="0" width="{{.Size}}" height="{{.Size}}" fill="#e8eef2"/>
+<text x="20" y="40" font-size="24">{{.Name}}</text>
+</svg>
+`))
+
+var pictoTemplate = template.Must(template.New("picto").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64" viewBox="0 0 64 64">
+<circle cx="32" cy="32" r="24" fill="#f5c542"/>
+<text x="32" y="38" font-size="14" text-anchor="middle">{{.}}</text>
+</svg>
+`))
+
+// slug turns a name into a lowercase url path element
+func slug(name string) string {
+	r := strings.NewReplacer(" ", "-", "'", "-", "é", "e", "è", "e", "ô", "o", "Î", "i", "î", "i")
+	return strings.ToLower(r.Replace(name))
+}
@@ -3,6 +3,7 @@ package geojson_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"gometeo/testutils"
 
@@ -63,7 +64,7 @@ func inspectGraphdata(t *testing.T, g gj.Graphdata) {
 
 func TestBuildChroniques(t *testing.T) {
 	mf := makeMultiforecast(t)
-	g, err := mf.BuildChroniques()
+	g, err := mf.BuildChroniques(time.Now())
 	if err != nil {
 		t.Fatalf("toChronique() error: %s", err)
 	}
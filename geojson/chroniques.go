@@ -8,7 +8,10 @@ import (
 	"log/slog"
 	"math"
 	"slices"
+	"strconv"
 	"time"
+
+	"gometeo/nullable"
 )
 
 type (
@@ -37,24 +40,24 @@ type (
 
 	FloatTs struct {
 		ts  time.Time
-		val float64
+		val nullable.Float
 	}
 
 	FloatRangeTs struct {
 		ts  time.Time
-		min float64
-		max float64
+		min nullable.Float
+		max nullable.Float
 	}
 
 	IntTs struct {
 		ts  time.Time
-		val int
+		val nullable.Int
 	}
 
 	IntRangeTs struct {
 		ts  time.Time
-		min int
-		max int
+		min nullable.Int
+		max nullable.Int
 	}
 )
 
@@ -100,15 +103,15 @@ var ErrNoSuchData = fmt.Errorf("no such data")
 const chroniqueMaxDays = 11
 
 // toChroniques() formats Multiforecastdata into Graphdata
-// for client-side charts
-func (mf MultiforecastData) BuildChroniques() (Graphdata, error) {
+// for client-side charts, up to chroniqueMaxDays after now
+func (mf MultiforecastData) BuildChroniques(now time.Time) (Graphdata, error) {
 	g := Graphdata{}
 
 	for i := range mf {
 		codeInsee := mf[i].Properties.Insee
 
 		forecasts := mf[i].Properties.Forecasts
-		g1, err := getChroniquesPoi(forecasts, forecastsChroniques)
+		g1, err := getChroniquesPoi(forecasts, forecastsChroniques, now)
 		if err != nil {
 			return nil, err
 		}
@@ -122,7 +125,7 @@ func (mf MultiforecastData) BuildChroniques() (Graphdata, error) {
 		}
 
 		dailies := mf[i].Properties.Dailies
-		g2, err := getChroniquesPoi(dailies, dailiesChroniques)
+		g2, err := getChroniquesPoi(dailies, dailiesChroniques, now)
 		if err != nil {
 			return nil, err
 		}
@@ -146,7 +149,8 @@ func (c Chroniques) MarshalJSON() ([]byte, error) {
 	return json.Marshal(tmp)
 }
 
-func (g Graphdata) Merge(old Graphdata, dayMin, dayMax int) {
+// Merge recovers values from old aged within [dayMin, dayMax] days at instant now
+func (g Graphdata) Merge(old Graphdata, dayMin, dayMax int, now time.Time) {
 
 	for nom := range g {
 		// skip series not present in old
@@ -162,20 +166,45 @@ func (g Graphdata) Merge(old Graphdata, dayMin, dayMax int) {
 				continue
 			}
 			newChro := serie[insee]
-			serie[insee] = mergeChronique(newChro, oldChro, dayMin, dayMax)
+			serie[insee] = mergeChronique(newChro, oldChro, dayMin, dayMax, now)
 		}
 		g[nom] = serie
 	}
 }
 
-func mergeChronique(new, old Chronique, dayMin, dayMax int) Chronique {
+// Backfill copies from old the series and POIs missing in g, with their
+// values from instant since on. Older values are recovered by Merge,
+// within its age limits.
+func (g Graphdata) Backfill(old Graphdata, since time.Time) {
+	for nom, oldSerie := range old {
+		serie, ok := g[nom]
+		if !ok {
+			serie = make(Chroniques, len(oldSerie))
+		}
+		for insee, chro := range oldSerie {
+			if _, ok := serie[insee]; ok {
+				continue
+			}
+			// old chroniques are shared with the previous MfMap, do not mutate
+			chro = slices.DeleteFunc(slices.Clone(chro), func(v ValueTs) bool { return v.Ts().Before(since) })
+			if len(chro) > 0 {
+				serie[insee] = chro
+			}
+		}
+		if len(serie) > 0 {
+			g[nom] = serie
+		}
+	}
+}
+
+func mergeChronique(new, old Chronique, dayMin, dayMax int, now time.Time) Chronique {
 
 	// use a temp map keyed by unix timestamp to merge old into new
 	merged := make(map[int64]ValueTs)
 
 	// fill with old data, filtered by dayMin, dayMax
 	for _, v := range old {
-		age := time.Since(v.Ts()) / time.Hour
+		age := now.Sub(v.Ts()) / time.Hour
 
 		if int(age) < 24*dayMin || int(age) > 24*dayMax {
 			continue
@@ -206,7 +235,8 @@ func mergeChronique(new, old Chronique, dayMin, dayMax int) Chronique {
 // getChroniques POI reshapes data for client-side highchart
 // * forecasts: list of forecasts (either regular or daily) of a given POI
 // * series: names of fields to extract from input forecast data
-func getChroniquesPoi[T timeStamper](forecasts []T, series []NomSerie) (map[NomSerie]Chronique, error) {
+// * now: values beyond chroniqueMaxDays after now are dropped
+func getChroniquesPoi[T timeStamper](forecasts []T, series []NomSerie, now time.Time) (map[NomSerie]Chronique, error) {
 	ret := map[NomSerie]Chronique{}
 seriesLoop:
 	// iterate over series names ( T, Tmax, etc... )
@@ -229,7 +259,7 @@ seriesLoop:
 				continue
 			}
 			// ignore data after configured limit
-			if v.Sub(time.Now()) > chroniqueMaxDays*24*time.Hour {
+			if v.Sub(now) > chroniqueMaxDays*24*time.Hour {
 				continue
 			}
 			chro = append(chro, v)
@@ -284,28 +314,47 @@ func timeToJs(t time.Time) int64 {
 	return int64(t.Sub(jsEpoch) / time.Millisecond)
 }
 
+// jsPoint formats a Highchart point [ts, values...].
+// Missing values are null, which Highchart draws as a gap.
+func jsPoint(ts time.Time, values ...json.Marshaler) ([]byte, error) {
+	b := []byte("[" + strconv.FormatInt(timeToJs(ts), 10))
+	for _, v := range values {
+		j, err := v.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, ", "...)
+		b = append(b, j...)
+	}
+	return append(b, ']'), nil
+}
+
 // MarshalJSON outputs a timestamped float as an array [ts, val]
 func (v FloatTs) MarshalJSON() ([]byte, error) {
-	s := fmt.Sprintf("[%d, %f]", timeToJs(v.ts), v.val)
-	return []byte(s), nil
+	return jsPoint(v.ts, v.val)
 }
 
-// MarshalJSON outputs a timestamped float as an array [ts, min, max]
+// MarshalJSON outputs a timestamped float as an array [ts, min, max].
+// A range missing either bound is a gap.
 func (v FloatRangeTs) MarshalJSON() ([]byte, error) {
-	s := fmt.Sprintf("[%d, %f, %f]", timeToJs(v.ts), v.min, v.max)
-	return []byte(s), nil
+	if !v.min.Valid() || !v.max.Valid() {
+		return jsPoint(v.ts, nullable.NullFloat, nullable.NullFloat)
+	}
+	return jsPoint(v.ts, v.min, v.max)
 }
 
 // MarshalJSON outputs a timestamped int as an array [ts, val]
 func (v IntTs) MarshalJSON() ([]byte, error) {
-	s := fmt.Sprintf("[%d, %d]", timeToJs(v.ts), v.val)
-	return []byte(s), nil
+	return jsPoint(v.ts, v.val)
 }
 
-// MarshalJSON outputs a timestamped float as an array [ts, min, max]
+// MarshalJSON outputs a timestamped int as an array [ts, min, max].
+// A range missing either bound is a gap.
 func (v IntRangeTs) MarshalJSON() ([]byte, error) {
-	s := fmt.Sprintf("[%d, %d, %d]", timeToJs(v.ts), v.min, v.max)
-	return []byte(s), nil
+	if !v.min.Valid() || !v.max.Valid() {
+		return jsPoint(v.ts, nullable.NullInt, nullable.NullInt)
+	}
+	return jsPoint(v.ts, v.min, v.max)
 }
 
 func (v IntTs) Sub(t time.Time) time.Duration        { return v.ts.Sub(t) }
@@ -328,7 +377,7 @@ func (v FloatTs) GobEncode() ([]byte, error) {
 	buf := make([]byte, 2+len(ts)+8)
 	binary.LittleEndian.PutUint16(buf, uint16(len(ts)))
 	copy(buf[2:], ts)
-	binary.LittleEndian.PutUint64(buf[2+len(ts):], math.Float64bits(v.val))
+	binary.LittleEndian.PutUint64(buf[2+len(ts):], math.Float64bits(float64(v.val)))
 	return buf, nil
 }
 
@@ -337,7 +386,7 @@ func (v *FloatTs) GobDecode(data []byte) error {
 	if err := v.ts.UnmarshalBinary(data[2 : 2+tsLen]); err != nil {
 		return err
 	}
-	v.val = math.Float64frombits(binary.LittleEndian.Uint64(data[2+tsLen:]))
+	v.val = nullable.Float(math.Float64frombits(binary.LittleEndian.Uint64(data[2+tsLen:])))
 	return nil
 }
 
@@ -358,7 +407,7 @@ func (v *IntTs) GobDecode(data []byte) error {
 	if err := v.ts.UnmarshalBinary(data[2 : 2+tsLen]); err != nil {
 		return err
 	}
-	v.val = int(binary.LittleEndian.Uint64(data[2+tsLen:]))
+	v.val = nullable.Int(binary.LittleEndian.Uint64(data[2+tsLen:]))
 	return nil
 }
 
@@ -371,8 +420,8 @@ func (v FloatRangeTs) GobEncode() ([]byte, error) {
 	binary.LittleEndian.PutUint16(buf, uint16(len(ts)))
 	copy(buf[2:], ts)
 	off := 2 + len(ts)
-	binary.LittleEndian.PutUint64(buf[off:], math.Float64bits(v.min))
-	binary.LittleEndian.PutUint64(buf[off+8:], math.Float64bits(v.max))
+	binary.LittleEndian.PutUint64(buf[off:], math.Float64bits(float64(v.min)))
+	binary.LittleEndian.PutUint64(buf[off+8:], math.Float64bits(float64(v.max)))
 	return buf, nil
 }
 
@@ -382,8 +431,8 @@ func (v *FloatRangeTs) GobDecode(data []byte) error {
 		return err
 	}
 	off := 2 + tsLen
-	v.min = math.Float64frombits(binary.LittleEndian.Uint64(data[off:]))
-	v.max = math.Float64frombits(binary.LittleEndian.Uint64(data[off+8:]))
+	v.min = nullable.Float(math.Float64frombits(binary.LittleEndian.Uint64(data[off:])))
+	v.max = nullable.Float(math.Float64frombits(binary.LittleEndian.Uint64(data[off+8:])))
 	return nil
 }
 
@@ -407,7 +456,7 @@ func (v *IntRangeTs) GobDecode(data []byte) error {
 		return err
 	}
 	off := 2 + tsLen
-	v.min = int(binary.LittleEndian.Uint64(data[off:]))
-	v.max = int(binary.LittleEndian.Uint64(data[off+8:]))
+	v.min = nullable.Int(binary.LittleEndian.Uint64(data[off:]))
+	v.max = nullable.Int(binary.LittleEndian.Uint64(data[off+8:]))
 	return nil
 }
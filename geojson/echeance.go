@@ -34,19 +34,28 @@ const (
 // momentsStr is an alias for the 4 moments, not including 'daily'
 var momentsStr = []MomentName{Matin, Apresmidi, Soir, Nuit}
 
-// determines Echeance of a Daily
+// determines Echeance of a Daily in the timezone of d.Time
 func (d Daily) Echeance() Echeance {
-	year, month, day := d.Time.Date()
+	return d.EcheanceIn(d.Time.Location())
+}
+
+// EcheanceIn determines Echeance of a Daily on the wall clock of loc
+func (d Daily) EcheanceIn(loc *time.Location) Echeance {
 	return Echeance{
 		Moment: "daily",
-		Date:   Date{Day: day, Month: month, Year: year},
+		Date:   NewDate(d.Time.In(loc)),
 	}
 }
 
-// determines Echeance of a Forecast
-// "night" is after midnight, but displayed with previous day
+// determines Echeance of a Forecast in the timezone of f.Time
 func (f Forecast) Echeance() Echeance {
-	year, month, day := f.Time.Date()
+	return f.EcheanceIn(f.Time.Location())
+}
+
+// EcheanceIn determines Echeance of a Forecast on the wall clock of loc.
+// "night" is after local midnight, but displayed with previous day
+func (f Forecast) EcheanceIn(loc *time.Location) Echeance {
+	year, month, day := f.Time.In(loc).Date()
 	if f.Moment == Nuit {
 		day -= 1
 	}
@@ -110,18 +119,11 @@ func NewDate(t time.Time) Date {
 	return Date{Year: t.Year(), Month: t.Month(), Day: t.Day()}
 }
 
-// dayPivotUTC is the UTC offset at which the displayed J+0 row advances.
-// Sitting halfway between the nominal nuit (00:00Z) and matin (06:00Z)
-// slots, it gives ±3h of headroom on each side: a matin tile may drift
-// anywhere in (03:00Z, 08:59Z) and still be bucketed as the leftmost tile
-// of the right row; a nuit tile may drift in (21:00Z prev day, 02:59Z) and
-// still land on the correct row via the day -= 1 shift in Forecast.Echeance.
-// UTC-anchored, so DST-immune by construction — no Paris zone, no wall-clock
-// arithmetic, no lookup into forecast timestamps.
-const dayPivotUTC = 3 * time.Hour
-
-// nowFunc is indirected for tests.
-var nowFunc = time.Now
+// dayPivotHour is the local hour at which the displayed J+0 row advances.
+// Until then, night owls still see the row holding the night they are in
+// (nuit forecasts are displayed with the previous day). Evaluated on the
+// wall clock of the forecast timezone, so DST changes do not move it.
+const dayPivotHour = 3
 
 // Sub() returns duration in calendar days from Date ref
 // used to decide on which row the map will be displayed
@@ -132,18 +134,21 @@ func (d Date) Sub(ref Date) int {
 	return int(math.Round(diff))
 }
 
-// todayDate returns the Date that J+0 currently points at. Rollover happens
-// at dayPivotUTC each UTC day — e.g. at 03:00Z, the row advances from the
-// previous UTC date to the current one. The returned Date matches how
-// upstream keys its daily/forecast data (UTC midnight).
-func todayDate() Date {
-	t := nowFunc().UTC().Add(-dayPivotUTC)
-	y, m, d := t.Date()
-	return Date{Year: y, Month: m, Day: d}
+// todayDate returns the Date that J+0 points at in loc, at instant now.
+// Rollover happens at dayPivotHour local time, e.g. at 03:00 in Paris the
+// row advances from the previous date to the current one.
+func todayDate(now time.Time, loc *time.Location) Date {
+	local := now.In(loc)
+	y, m, d := local.Date()
+	if local.Hour() < dayPivotHour {
+		d--
+	}
+	return NewDate(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
 }
 
-func (d Date) DaysFromNow() int {
-	return d.Sub(todayDate())
+// DaysFrom returns the row of d relative to the J+0 of instant now in loc
+func (d Date) DaysFrom(now time.Time, loc *time.Location) int {
+	return d.Sub(todayDate(now, loc))
 }
 
 func (m *MomentName) UnmarshalJSON(b []byte) error {
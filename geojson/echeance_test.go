@@ -126,41 +126,89 @@ func TestDateSub(t *testing.T) {
 }
 
 func TestTodayDatePivot(t *testing.T) {
-	// Pivot is 03:00Z. Row J+0 advances at that instant, every UTC day.
-	// DST plays no role (pivot is UTC-anchored).
+	// Pivot is 03:00 on the local wall clock of the forecasts. The server
+	// clock is UTC, so the pivot instant moves with DST: 02:00Z in winter
+	// and 01:00Z in summer for Paris, 23:00Z the day before for Réunion.
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reunion, err := time.LoadLocation("Indian/Reunion")
+	if err != nil {
+		t.Fatal(err)
+	}
 	tests := []struct {
 		name    string
+		loc     *time.Location
 		nowUTC  time.Time
 		wantYMD [3]int
 	}{
-		{"just-before-pivot", time.Date(2026, 1, 15, 2, 59, 59, 0, time.UTC), [3]int{2026, 1, 14}},
-		{"at-pivot", time.Date(2026, 1, 15, 3, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
-		{"just-after-pivot", time.Date(2026, 1, 15, 3, 0, 1, 0, time.UTC), [3]int{2026, 1, 15}},
-		{"mid-morning", time.Date(2026, 1, 15, 8, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
-		{"late-evening", time.Date(2026, 1, 15, 23, 59, 0, 0, time.UTC), [3]int{2026, 1, 15}},
-		{"next-midnight", time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
-		{"next-02h59", time.Date(2026, 1, 16, 2, 59, 0, 0, time.UTC), [3]int{2026, 1, 15}},
-		// DST transitions — should behave identically to any other day
-		// because the pivot is in UTC.
-		{"spring-forward-before-pivot", time.Date(2026, 3, 29, 2, 59, 0, 0, time.UTC), [3]int{2026, 3, 28}},
-		{"spring-forward-after-pivot", time.Date(2026, 3, 29, 3, 0, 0, 0, time.UTC), [3]int{2026, 3, 29}},
-		{"fall-back-before-pivot", time.Date(2026, 10, 25, 2, 59, 0, 0, time.UTC), [3]int{2026, 10, 24}},
-		{"fall-back-after-pivot", time.Date(2026, 10, 25, 3, 0, 0, 0, time.UTC), [3]int{2026, 10, 25}},
+		{"just-before-pivot", paris, time.Date(2026, 1, 15, 1, 59, 59, 0, time.UTC), [3]int{2026, 1, 14}},
+		{"at-pivot", paris, time.Date(2026, 1, 15, 2, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
+		{"mid-morning", paris, time.Date(2026, 1, 15, 8, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
+		{"late-evening", paris, time.Date(2026, 1, 15, 22, 59, 0, 0, time.UTC), [3]int{2026, 1, 15}},
+		{"local-midnight", paris, time.Date(2026, 1, 15, 23, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
+		{"summer-before-pivot", paris, time.Date(2026, 7, 15, 0, 59, 0, 0, time.UTC), [3]int{2026, 7, 14}},
+		{"summer-at-pivot", paris, time.Date(2026, 7, 15, 1, 0, 0, 0, time.UTC), [3]int{2026, 7, 15}},
+		// spring forward: 02:00 CET jumps to 03:00 CEST at 01:00Z
+		{"spring-forward-before-pivot", paris, time.Date(2026, 3, 29, 0, 59, 0, 0, time.UTC), [3]int{2026, 3, 28}},
+		{"spring-forward-at-pivot", paris, time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC), [3]int{2026, 3, 29}},
+		// fall back: 03:00 CEST goes back to 02:00 CET at 01:00Z, the
+		// row advances on the second 03:00
+		{"fall-back-first-2h", paris, time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC), [3]int{2026, 10, 24}},
+		{"fall-back-second-2h", paris, time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC), [3]int{2026, 10, 24}},
+		{"fall-back-at-pivot", paris, time.Date(2026, 10, 25, 2, 0, 0, 0, time.UTC), [3]int{2026, 10, 25}},
 		// Month / year rollover across the pivot.
-		{"month-rollover", time.Date(2026, 2, 1, 2, 0, 0, 0, time.UTC), [3]int{2026, 1, 31}},
-		{"year-rollover", time.Date(2027, 1, 1, 2, 0, 0, 0, time.UTC), [3]int{2026, 12, 31}},
+		{"month-rollover", paris, time.Date(2026, 2, 1, 1, 0, 0, 0, time.UTC), [3]int{2026, 1, 31}},
+		{"year-rollover", paris, time.Date(2027, 1, 1, 1, 0, 0, 0, time.UTC), [3]int{2026, 12, 31}},
+		// UTC+4, the local day starts on the previous UTC day
+		{"reunion-before-pivot", reunion, time.Date(2026, 1, 14, 22, 59, 0, 0, time.UTC), [3]int{2026, 1, 14}},
+		{"reunion-at-pivot", reunion, time.Date(2026, 1, 14, 23, 0, 0, 0, time.UTC), [3]int{2026, 1, 15}},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			restore := gj.SetNowForTest(func() time.Time { return tc.nowUTC })
-			defer restore()
-			got := gj.TodayDateForTest()
+			got := gj.TodayDateForTest(tc.nowUTC, tc.loc)
 			want := gj.Date{Year: tc.wantYMD[0], Month: time.Month(tc.wantYMD[1]), Day: tc.wantYMD[2]}
 			if got != want {
-				t.Errorf("todayDate() at %s got %v want %v", tc.nowUTC, got, want)
+				t.Errorf("todayDate(%s) at %s got %v want %v", tc.loc, tc.nowUTC, got, want)
+			}
+		})
+	}
+}
+
+func TestEcheanceInDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		moment gj.MomentName
+		utc    time.Time
+		want   gj.Date
+	}{
+		// 00:30 CEST on Oct 25th, last night of summer time
+		{"fall-back-night", nuit, time.Date(2026, 10, 24, 22, 30, 0, 0, time.UTC), gj.Date{Year: 2026, Month: 10, Day: 24}},
+		// 23:30 CET on Oct 25th, still Oct 25th locally
+		{"fall-back-evening", soir, time.Date(2026, 10, 25, 22, 30, 0, 0, time.UTC), gj.Date{Year: 2026, Month: 10, Day: 25}},
+		// 03:00 CEST right after spring forward
+		{"spring-forward-night", nuit, time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC), gj.Date{Year: 2026, Month: 3, Day: 28}},
+		// 00:30 CET on Mar 29th, UTC date is still Mar 28th
+		{"spring-forward-morning", matin, time.Date(2026, 3, 28, 23, 30, 0, 0, time.UTC), gj.Date{Year: 2026, Month: 3, Day: 29}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := gj.Forecast{Moment: tc.moment, Time: tc.utc}
+			if got := f.EcheanceIn(paris).Date; got != tc.want {
+				t.Errorf("EcheanceIn(%s) at %s got %v want %v", paris, tc.utc, got, tc.want)
 			}
 		})
 	}
+	// midnight CEST, the daily of Oct 25th
+	d := gj.Daily{Time: time.Date(2026, 10, 24, 22, 0, 0, 0, time.UTC)}
+	if got, want := d.EcheanceIn(paris).Date, (gj.Date{Year: 2026, Month: 10, Day: 25}); got != want {
+		t.Errorf("Daily.EcheanceIn(%s) got %v want %v", paris, got, want)
+	}
 }
 
 func TestEcheanceNight(t *testing.T) {
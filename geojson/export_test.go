@@ -2,12 +2,6 @@ package geojson
 
 import "time"
 
-func SetNowForTest(f func() time.Time) func() {
-	prev := nowFunc
-	nowFunc = f
-	return func() { nowFunc = prev }
-}
-
-func TodayDateForTest() Date {
-	return todayDate()
+func TodayDateForTest(now time.Time, loc *time.Location) Date {
+	return todayDate(now, loc)
 }
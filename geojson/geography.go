@@ -36,7 +36,7 @@ type GeoProperty struct {
 
 	// subzones path is not provided in geography object
 	// needs to be derived from prop0.cible (IdTechnique)
-	CustomPath string `json:"customPath"`
+	CustomPath string `json:"customPath" schema:"computed"`
 }
 
 type GeoGeometry struct {
@@ -62,13 +62,46 @@ type Paths struct {
 
 type PolygonType string
 
-// for coordinates sanity checks
-const (
-	minLat = 35.0
-	maxLat = 55.0
-	minLng = -12.0
-	maxLng = 15.0
-)
+// Bounds is a lat/lng rectangle for coordinates sanity checks
+type Bounds struct {
+	MinLat, MaxLat, MinLng, MaxLng float64
+}
+
+// Metropole bounds metropolitan France and Corsica, with its mountain and
+// coastal zones
+var Metropole = Bounds{MinLat: 35, MaxLat: 55, MinLng: -12, MaxLng: 15}
+
+// wgs84 is checked while unmarshalling, before the zone is known
+var wgs84 = Bounds{MinLat: -90, MaxLat: 90, MinLng: -180, MaxLng: 180}
+
+// overseasBounds of overseas departments by code, with a sea margin for
+// geography bboxes
+var overseasBounds = map[string]Bounds{
+	"971": {MinLat: 15.3, MaxLat: 18.6, MinLng: -63.6, MaxLng: -60.6}, // Guadeloupe, St-Martin, St-Barth
+	"972": {MinLat: 13.9, MaxLat: 15.3, MinLng: -61.7, MaxLng: -60.4}, // Martinique
+	"973": {MinLat: 1.5, MaxLat: 6.5, MinLng: -55, MaxLng: -51},       // Guyane
+	"974": {MinLat: -22, MaxLat: -20.5, MinLng: 54.8, MaxLng: 56.2},   // La Réunion
+	"976": {MinLat: -13.5, MaxLat: -12.2, MinLng: 44.6, MaxLng: 45.7}, // Mayotte
+}
+
+// BoundsOf returns the bounds of department dept, of its POIs and maps
+func BoundsOf(dept string) Bounds {
+	if b, ok := overseasBounds[dept]; ok {
+		return b
+	}
+	return Metropole
+}
+
+// Check returns an error when c lies out of b
+func (b Bounds) Check(c Coordinates) error {
+	if c.Lng < b.MinLng || c.Lng > b.MaxLng {
+		return fmt.Errorf("longitude %f out of bounds [%f, %f]", c.Lng, b.MinLng, b.MaxLng)
+	}
+	if c.Lat < b.MinLat || c.Lat > b.MaxLat {
+		return fmt.Errorf("latitude %f out of bounds [%f, %f]", c.Lat, b.MinLat, b.MaxLat)
+	}
+	return nil
+}
 
 // ParseGeograpy parses a geojson object into a GeoCollection.
 // subzones maps "geoFeature.feat.Properties.Prop0.Cible" to a CustomPath.
@@ -100,28 +133,40 @@ func ParseGeography(r io.Reader, subzones map[string]string) (*GeoCollection, er
 	return &gc, nil
 }
 
+// Check returns an error when bboxes or polygons of gc lie out of b
+func (gc *GeoCollection) Check(b Bounds) error {
+	if err := gc.Bbox.check(b); err != nil {
+		return err
+	}
+	for _, feat := range gc.Features {
+		if err := feat.Bbox.check(b); err != nil {
+			return err
+		}
+		for _, ring := range feat.Geometry.Coords {
+			for _, c := range ring {
+				if err := b.Check(c); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (bbox *Bbox) UnmarshalJSON(b []byte) error {
 	var a [4]float64
 	if err := json.Unmarshal(b, &a); err != nil {
 		return fmt.Errorf("bbox unmarshal error: %w. Want a [4]float64 array", err)
 	}
-	if err := checkLng(a[0]); err != nil {
-		return err
-	}
-	bbox.LngW = a[0]
-	if err := checkLat(a[1]); err != nil {
-		return err
-	}
-	bbox.LatN = a[1]
-	if err := checkLng(a[2]); err != nil {
-		return err
-	}
-	bbox.LngE = a[2]
-	if err := checkLat(a[3]); err != nil {
+	bbox.LngW, bbox.LatN, bbox.LngE, bbox.LatS = a[0], a[1], a[2], a[3]
+	return bbox.check(wgs84)
+}
+
+func (bbox Bbox) check(b Bounds) error {
+	if err := b.Check(Coordinates{Lat: bbox.LatN, Lng: bbox.LngW}); err != nil {
 		return err
 	}
-	bbox.LatS = a[3]
-	return nil
+	return b.Check(Coordinates{Lat: bbox.LatS, Lng: bbox.LngE})
 }
 
 func (b Bbox) Crop(left, right, top, bottom float64) Bbox {
@@ -149,14 +194,8 @@ func (c *Coordinates) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &a); err != nil {
 		return fmt.Errorf("coordinates unmarshal error: %w. Want a [2]float64 array", err)
 	}
-	if err := checkLng(a[0]); err != nil {
-		return err
-	}
-	if err := checkLat(a[1]); err != nil {
-		return err
-	}
 	c.Lng, c.Lat = a[0], a[1]
-	return nil
+	return wgs84.Check(*c)
 }
 
 // MarshalJSON outputs lng/lat as [float, float]
@@ -165,17 +204,3 @@ func (c *Coordinates) UnmarshalJSON(b []byte) error {
 func (c *Coordinates) MarshalJSON() ([]byte, error) {
 	return json.Marshal([]float64{c.Lng, c.Lat})
 }
-
-func checkLng(lng float64) error {
-	if lng < minLng || lng > maxLng {
-		return fmt.Errorf("longitude %f out of bounds [%f, %f]", lng, minLng, maxLng)
-	}
-	return nil
-}
-
-func checkLat(lat float64) error {
-	if lat < minLat || lat > maxLat {
-		return fmt.Errorf("latitude %f out of bounds [%f, %f]", lat, minLat, maxLat)
-	}
-	return nil
-}
@@ -1,6 +1,7 @@
 package geojson_test
 
 import (
+	"strings"
 	"testing"
 
 	gj "gometeo/geojson"
@@ -51,3 +52,43 @@ func TestParseGeographyEmpty(t *testing.T) {
 		t.Errorf("got %d features, want 0", len(gc.Features))
 	}
 }
+
+func TestGeographyBounds(t *testing.T) {
+	const (
+		metro     = "[2, 44], [6, 48], [6, 44], [2, 44]"
+		metroBox  = "[0, 50, 10, 40]"
+		reunion   = "[55.2, -20.9], [55.8, -20.9], [55.8, -21.4], [55.2, -20.9]"
+		reunionBx = "[55.1, -20.7, 55.9, -21.5]"
+	)
+	tests := []struct {
+		name   string
+		bbox   string
+		coords string
+		bounds gj.Bounds
+		parsed bool // ParseGeography checks WGS84 only
+		ok     bool
+	}{
+		{name: "metropole", bbox: metroBox, coords: metro, bounds: gj.Metropole, parsed: true, ok: true},
+		{name: "overseas", bbox: reunionBx, coords: reunion, bounds: gj.BoundsOf("974"), parsed: true, ok: true},
+		{name: "overseas bbox on a metropolitan map", bbox: reunionBx, coords: metro, bounds: gj.Metropole, parsed: true},
+		{name: "metropolitan polygon on an overseas map", bbox: reunionBx, coords: metro, bounds: gj.BoundsOf("974"), parsed: true},
+		{name: "polygon out of metropole", bbox: metroBox, coords: "[2, 44], [55.5, -21], [6, 44], [2, 44]", bounds: gj.Metropole, parsed: true},
+		{name: "invalid latitude", bbox: "[0, 95, 10, 40]", coords: metro, bounds: gj.Metropole},
+	}
+	for _, tc := range tests {
+		j := `{"type": "FeatureCollection", "bbox": ` + tc.bbox + `, "features": [{
+			"type": "Feature", "bbox": ` + tc.bbox + `,
+			"properties": {"prop0": {"nom": "zone", "cible": "Z1"}},
+			"geometry": {"type": "Polygon", "coordinates": [[` + tc.coords + `]]}}]}`
+		gc, err := gj.ParseGeography(strings.NewReader(j), map[string]string{"Z1": "zone"})
+		if (err == nil) != tc.parsed {
+			t.Errorf("%s: ParseGeography() error = %v, want parsed=%v", tc.name, err, tc.parsed)
+		}
+		if err != nil {
+			continue
+		}
+		if err = gc.Check(tc.bounds); (err == nil) != tc.ok {
+			t.Errorf("%s: Check() error = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package geojson
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeChroniqueRetention(t *testing.T) {
+	now := time.Date(2026, 3, 29, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	old := Chronique{
+		FloatTs{now.Add(-3 * day), 1},
+		FloatTs{now.Add(-day), 2},
+		FloatTs{now.Add(day), 3},
+		FloatTs{now.Add(3 * day), 4},
+	}
+	new := Chronique{FloatTs{now.Add(day), 30}}
+
+	got := mergeChronique(new, old, -2, 2, now)
+	want := Chronique{FloatTs{now.Add(-day), 2}, FloatTs{now.Add(day), 30}}
+	if len(got) != len(want) {
+		t.Fatalf("mergeChronique() got %d values, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mergeChronique()[%d] got %v want %v", i, got[i], want[i])
+		}
+	}
+
+	// same data seen two days later, the past value has aged out
+	got = mergeChronique(new, old, -2, 2, now.Add(2*day))
+	if len(got) != 2 || got[0] != (FloatTs{now.Add(day), 30}) || got[1] != (FloatTs{now.Add(3 * day), 4}) {
+		t.Errorf("mergeChronique() two days later got %v", got)
+	}
+}
+
+func TestGraphdataBackfill(t *testing.T) {
+	now := time.Date(2026, 3, 29, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	old := Graphdata{
+		"T": Chroniques{
+			"751010": {FloatTs{now.Add(-day), 1}, FloatTs{now.Add(day), 2}},
+			"751020": {FloatTs{now.Add(-day), 3}},
+		},
+	}
+	g := Graphdata{"T": Chroniques{"751030": {FloatTs{now, 4}}}}
+	g.Backfill(old, now)
+
+	serie := g["T"]
+	if got := serie["751010"]; len(got) != 1 || got[0] != (FloatTs{now.Add(day), 2}) {
+		t.Errorf("Backfill() got %v, want values from now on", got)
+	}
+	if _, ok := serie["751020"]; ok {
+		t.Error("Backfill() kept a POI with past values only")
+	}
+	if len(old["T"]["751010"]) != 2 {
+		t.Error("Backfill() mutated old")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"gometeo/testutils"
 	"reflect"
 	"testing"
+	"time"
 
 	gj "gometeo/geojson"
 )
@@ -29,7 +30,7 @@ func TestMergePrevList(t *testing.T) {
 	new[oldest] = pad
 
 	// merge with original
-	new.Merge(old, -1000, 1000)
+	new.Merge(old, -1000, 1000, time.Now())
 
 	// check new has old map restored
 	pad = new[oldest]
@@ -64,7 +65,7 @@ func TestMergeChroniques(t *testing.T) {
 	}
 
 	// call method under test
-	new.Merge(old, -1000, +1000)
+	new.Merge(old, -1000, +1000, time.Now())
 	if !reflect.DeepEqual(new, old) {
 		t.Error("prevlists should be equal after merge")
 	}
@@ -1,11 +1,15 @@
 package geojson_test
 
 import (
+	"encoding/json"
 	"fmt"
 	gj "gometeo/geojson"
 	"gometeo/testutils"
+	"maps"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseMultiforecast(t *testing.T) {
@@ -47,3 +51,242 @@ func TestPictoNames(t *testing.T) {
 		t.Errorf("picto list contains an empty string : %v", pics)
 	}
 }
+
+// overseasForecast is a minimal multiforecast for a POI in Réunion (UTC+4)
+const overseasForecast = `{"type": "FeatureCollection", "features": [{
+	"update_time": "2025-01-01T12:00:00.000Z",
+	"type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [55.45, -20.88]},
+	"properties": {
+		"name": "Saint-Denis", "country": "RE - Réunion", "french_department": "974",
+		"timezone": "Indian/Reunion", "insee": "974110", "altitude": 10,
+		"forecast": [{"moment_day": "nuit", "time": "2025-01-01T22:00:00.000Z", "T": 24, "wind_speed": 10}],
+		"daily_forecast": [
+			{"time": "2025-01-01T20:00:00.000Z", "T_min": 22, "T_max": 30},
+			{"time": "2024-12-31T20:00:00.000Z", "T_min": 23, "T_max": 31}
+		]
+	}
+}]}`
+
+func TestParseMultiforecastOverseas(t *testing.T) {
+	fc, err := gj.ParseMultiforecast(strings.NewReader(overseasForecast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := fc.Features[0].Properties
+	// local midnight on Jan 2nd is 20:00Z on Jan 1st
+	if got, want := props.Dailies[0].Echeance().Date, (gj.Date{Year: 2025, Month: time.January, Day: 2}); got != want {
+		t.Errorf("daily Echeance() = %v, want %v", got, want)
+	}
+	// 02:00 local on Jan 2nd is the night following Jan 1st
+	if got, want := props.Forecasts[0].Echeance().Date, (gj.Date{Year: 2025, Month: time.January, Day: 1}); got != want {
+		t.Errorf("night Echeance() = %v, want %v", got, want)
+	}
+	if got := fc.Features.UpdateTime(); !got.Equal(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("UpdateTime() = %v", got)
+	}
+}
+
+func TestParseMultiforecastBounds(t *testing.T) {
+	// Réunion coordinates are only valid for a Réunion POI
+	j := strings.Replace(overseasForecast, `"french_department": "974"`, `"french_department": "75"`, 1)
+	if _, err := gj.ParseMultiforecast(strings.NewReader(j)); err == nil {
+		t.Error("overseas coordinates must be rejected on a metropolitan POI")
+	}
+	j = strings.Replace(overseasForecast, "[55.45, -20.88]", "[2.35, 48.85]", 1)
+	if _, err := gj.ParseMultiforecast(strings.NewReader(j)); err == nil {
+		t.Error("metropolitan coordinates must be rejected on a Réunion POI")
+	}
+}
+
+func TestParseMultiforecastBadTimezone(t *testing.T) {
+	j := strings.Replace(overseasForecast, "Indian/Reunion", "Mars/Olympus", 1)
+	if _, err := gj.ParseMultiforecast(strings.NewReader(j)); err == nil {
+		t.Error("unknown timezone must be rejected")
+	}
+}
+
+func TestBuildPrevsOverseas(t *testing.T) {
+	// 09:00 local on Jan 2nd, with the daily of Jan 2nd
+	j := strings.Replace(overseasForecast, `"moment_day": "nuit", "time": "2025-01-01T22:00:00.000Z"`, `"moment_day": "matin", "time": "2025-01-02T05:00:00.000Z"`, 1)
+	fc, err := gj.ParseMultiforecast(strings.NewReader(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := fc.Features.BuildPrevs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := pl[gj.Date{Year: 2025, Month: time.January, Day: 2}]
+	if len(day[gj.Matin].Prevs) != 1 || len(day[gj.Journalier].Prevs) != 1 {
+		t.Errorf("local daily not matched: %d morning and %d daily prevs, want 1 each", len(day[gj.Matin].Prevs), len(day[gj.Journalier].Prevs))
+	}
+}
+
+// parisDSTForecast is a Paris POI over the October DST change, with UTC
+// timestamps not matching local dates
+const parisDSTForecast = `{"type": "FeatureCollection", "features": [{
+	"update_time": "2026-10-24T12:00:00.000Z",
+	"type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [2.35, 48.85]},
+	"properties": {
+		"name": "Paris", "country": "FR - France", "french_department": "75",
+		"timezone": "Europe/Paris", "insee": "751010", "altitude": 35,
+		"forecast": [
+			{"moment_day": "soirée", "time": "2026-10-24T19:00:00.000Z", "T": 12, "wind_speed": 10},
+			{"moment_day": "nuit", "time": "2026-10-24T23:00:00.000Z", "T": 9, "wind_speed": 10},
+			{"moment_day": "matin", "time": "2026-10-25T08:00:00.000Z", "T": 8, "wind_speed": 10}
+		],
+		"daily_forecast": [
+			{"time": "2026-10-23T22:00:00.000Z", "T_min": 8, "T_max": 15},
+			{"time": "2026-10-24T22:00:00.000Z", "T_min": 7, "T_max": 14}
+		]
+	}
+}]}`
+
+func TestBuildPrevsTimezone(t *testing.T) {
+	// server clock in UTC, like the production container
+	prevLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = prevLocal }()
+
+	tests := []struct {
+		name    string
+		json    string
+		now     time.Time
+		moments map[gj.Date]int // forecasts + daily, per day
+		keys    []int           // rows of the JSON output
+	}{
+		{
+			name: "reunion",
+			json: overseasForecast,
+			// 02:30 local on Jan 2nd, still showing Jan 1st as J+0
+			now:     time.Date(2025, 1, 1, 22, 30, 0, 0, time.UTC),
+			moments: map[gj.Date]int{{Year: 2025, Month: 1, Day: 1}: 2},
+			keys:    []int{0},
+		},
+		{
+			name: "paris-fall-back",
+			json: parisDSTForecast,
+			// 03:00 CET on Oct 25th, past the pivot
+			now: time.Date(2026, 10, 25, 2, 0, 0, 0, time.UTC),
+			moments: map[gj.Date]int{
+				{Year: 2026, Month: 10, Day: 24}: 3,
+				{Year: 2026, Month: 10, Day: 25}: 2,
+			},
+			keys: []int{-1, 0},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fc, err := gj.ParseMultiforecast(strings.NewReader(tc.json))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pl, err := fc.Features.BuildPrevs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pl) != len(tc.moments) {
+				t.Errorf("BuildPrevs() got %d days, want %d", len(pl), len(tc.moments))
+			}
+			for d, n := range tc.moments {
+				// a missing daily drops the forecasts of the day
+				if got := len(pl[d]); got != n {
+					t.Errorf("BuildPrevs() day %v got %d moments, want %d", d, got, n)
+				}
+			}
+			b, err := json.Marshal(pl.Rows(tc.now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rows map[int]json.RawMessage
+			if err := json.Unmarshal(b, &rows); err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range tc.keys {
+				if _, ok := rows[k]; !ok {
+					t.Errorf("Rows() missing row %d in %v", k, slices.Collect(maps.Keys(rows)))
+				}
+			}
+		})
+	}
+}
+
+// nullForecast has null and missing values, upstream sends both
+const nullForecast = `{"type": "FeatureCollection", "features": [{
+	"update_time": "2025-01-01T12:00:00.000Z",
+	"type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [2.35, 48.85]},
+	"properties": {
+		"name": "Paris", "country": "FR - France", "french_department": "75",
+		"timezone": "Europe/Paris", "insee": "751010", "altitude": 35,
+		"forecast": [
+			{"moment_day": "matin", "time": "2025-01-01T08:00:00.000Z", "T": 0, "wind_speed": 0, "P_sea": null},
+			{"moment_day": "après-midi", "time": "2025-01-02T14:00:00.000Z", "T": null, "wind_speed": 10}
+		],
+		"daily_forecast": [
+			{"time": "2024-12-31T23:00:00.000Z", "T_min": -2, "T_max": null, "uv_index": null}
+		]
+	}
+}]}`
+
+func TestNullableFields(t *testing.T) {
+	fc, err := gj.ParseMultiforecast(strings.NewReader(nullForecast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := fc.Features[0].Properties
+	matin, aprem, daily := props.Forecasts[0], props.Forecasts[1], props.Dailies[0]
+	if !matin.T.Valid() || matin.T != 0 || matin.LongTerme {
+		t.Errorf("T=0 got %v valid=%v longTerme=%v", matin.T, matin.T.Valid(), matin.LongTerme)
+	}
+	if matin.Pression.Valid() || matin.Hrel.Valid() {
+		t.Errorf("null P_sea or missing relative_humidity got %v, %v", matin.Pression, matin.Hrel)
+	}
+	if !aprem.LongTerme {
+		t.Error("forecast with null T is not long-term")
+	}
+	if !daily.Tmin.Valid() || daily.Tmax.Valid() || daily.Uv.Valid() || daily.Hmin.Valid() {
+		t.Errorf("daily got %+v", daily)
+	}
+
+	// prevs: missing values are null, not 0
+	pl, err := fc.Features.BuildPrevs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(pl.Rows(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"T":0,`, `"P_sea":null`, `"T_max":null`, `"uv_index":null`, `"relative_humidity":null`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("prevs json missing %s in %s", want, b)
+		}
+	}
+
+	// chroniques: missing values are highchart gaps
+	g, err := fc.Features.BuildChroniques(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		serie gj.NomSerie
+		want  string
+	}{
+		{gj.Temperature, `[[[1735718400000,0]]]`},
+		{gj.Psea, `[[[1735718400000,null]]]`},
+		{gj.Trange, `[[[1735686000000,null,null]]]`},
+		{gj.Uv, `[[[1735686000000,null]]]`},
+	}
+	for _, tc := range tests {
+		b, err := json.Marshal(g[tc.serie])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("chronique %s got %s, want %s", tc.serie, b, tc.want)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"slices"
 	"time"
+
+	"gometeo/nullable"
 )
 
 // mfCollection is root element of a multiforecast api response
@@ -31,45 +33,47 @@ type MfGeometry struct {
 
 type MfProperties struct {
 	Name      string     `json:"name"`
-	Country   countryFr  `json:"country"`
+	Country   country    `json:"country"`
 	Dept      string     `json:"french_department"`
-	Timezone  tzParis    `json:"timezone"`
+	Timezone  Timezone   `json:"timezone"`
 	Insee     codeInsee  `json:"insee"`
 	Altitude  int        `json:"altitude"`
 	Forecasts []Forecast `json:"forecast"`
 	Dailies   []Daily    `json:"daily_forecast"`
 }
 
+// Forecast and Daily numeric fields are nullable: upstream sends null,
+// or omits them, when a value is not available
 type Forecast struct {
-	Moment        MomentName `json:"moment_day"`
-	Time          time.Time  `json:"time"`
-	T             float64    `json:"T"`
-	TWindchill    float64    `json:"T_windchill"`
-	WindSpeed     int        `json:"wind_speed"`
-	WindSpeedGust int        `json:"wind_speed_gust"`
-	WindDirection int        `json:"wind_direction"`
-	WindIcon      string     `json:"wind_icon"`
-	Iso0          int        `json:"iso0"`
-	CloudCover    int        `json:"total_cloud_cover"`
-	WeatherIcon   string     `json:"weather_icon"`
-	WeatherDesc   string     `json:"weather_description"`
-	Hrel          int        `json:"relative_humidity"`
-	Pression      float64    `json:"P_sea"`
-	Confiance     int        `json:"weather_confidence_index"`
+	Moment        MomentName     `json:"moment_day"`
+	Time          time.Time      `json:"time"`
+	T             nullable.Float `json:"T"`
+	TWindchill    nullable.Float `json:"T_windchill"`
+	WindSpeed     nullable.Int   `json:"wind_speed"`
+	WindSpeedGust nullable.Int   `json:"wind_speed_gust"`
+	WindDirection nullable.Int   `json:"wind_direction"`
+	WindIcon      string         `json:"wind_icon"`
+	Iso0          nullable.Int   `json:"iso0"`
+	CloudCover    nullable.Int   `json:"total_cloud_cover"`
+	WeatherIcon   string         `json:"weather_icon"`
+	WeatherDesc   string         `json:"weather_description"`
+	Hrel          nullable.Int   `json:"relative_humidity"`
+	Pression      nullable.Float `json:"P_sea"`
+	Confiance     nullable.Int   `json:"weather_confidence_index"`
 
 	// Calculated field
-	LongTerme bool `json:"long_terme"`
+	LongTerme bool `json:"long_terme" schema:"computed"`
 }
 
 type Daily struct {
-	Time        time.Time `json:"time"`
-	Tmin        float64   `json:"T_min"`
-	Tmax        float64   `json:"T_max"`
-	Hmin        int       `json:"relative_humidity_min"`
-	Hmax        int       `json:"relative_humidity_max"`
-	Uv          int       `json:"uv_index"`
-	WeatherIcon string    `json:"daily_weather_icon"`
-	WeatherDesc string    `json:"daily_weather_description"`
+	Time        time.Time      `json:"time"`
+	Tmin        nullable.Float `json:"T_min"`
+	Tmax        nullable.Float `json:"T_max"`
+	Hmin        nullable.Int   `json:"relative_humidity_min"`
+	Hmax        nullable.Int   `json:"relative_humidity_max"`
+	Uv          nullable.Int   `json:"uv_index"`
+	WeatherIcon string         `json:"daily_weather_icon"`
+	WeatherDesc string         `json:"daily_weather_description"`
 }
 
 // custom types with runtime validation on unmarshalled data
@@ -77,8 +81,8 @@ type (
 	FeatureCollectionType string
 	FeatureType           string
 	PointType             string
-	tzParis               string
-	countryFr             string
+	Timezone              string
+	country               string
 	MomentName            string
 	codeInsee             string
 )
@@ -87,8 +91,7 @@ var (
 	featureCollectionStr = regexp.MustCompile(`FeatureCollection`)
 	featureStr           = regexp.MustCompile(`Feature`)
 	pointStr             = regexp.MustCompile(`Point`)
-	tzStr                = regexp.MustCompile(`Europe/(Paris)|(Rome)|(Zurich)|(Madrid)|(Brussels)`)
-	countryFrStr         = regexp.MustCompile(`FR - France`)
+	countryStr           = regexp.MustCompile(`^[A-Z]{2} - `)
 )
 
 const (
@@ -105,30 +108,73 @@ func ParseMultiforecast(r io.Reader) (*mfCollection, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid multiforecast: %w", err)
 	}
+	for _, feat := range fc.Features {
+		if err = BoundsOf(feat.Properties.Dept).Check(feat.Geometry.Coords); err != nil {
+			return nil, fmt.Errorf("invalid multiforecast: %s: %w", feat.Properties.Name, err)
+		}
+	}
+	fc.Features.localize()
 	return &fc, nil
 }
 
-// Unmarshall into a Forecast struct. Sets f.OnlyLT true
-// if incoming json fields T or wind_speed are null
+// localize converts forecast times into the timezone of their POI, so that
+// Echeance dates are local calendar days, also on overseas territories.
+func (multi MultiforecastData) localize() {
+	for i := range multi {
+		loc := multi[i].Properties.Timezone.Location()
+		for j := range multi[i].Properties.Forecasts {
+			f := &multi[i].Properties.Forecasts[j]
+			f.Time = f.Time.In(loc)
+		}
+		for j := range multi[i].Properties.Dailies {
+			d := &multi[i].Properties.Dailies[j]
+			d.Time = d.Time.In(loc)
+		}
+	}
+}
+
+// Unmarshall into a Forecast struct. Sets f.LongTerme true
+// if incoming json fields T or wind_speed are null or missing
 func (f *Forecast) UnmarshalJSON(data []byte) error {
 	// unmarshall into a temp var of diffent type to avoid infinite recursion
 	type RawForecast Forecast
-	rf := RawForecast{}
+	// fields missing from json data stay null
+	rf := RawForecast{
+		T:             nullable.NullFloat,
+		TWindchill:    nullable.NullFloat,
+		WindSpeed:     nullable.NullInt,
+		WindSpeedGust: nullable.NullInt,
+		WindDirection: nullable.NullInt,
+		Iso0:          nullable.NullInt,
+		CloudCover:    nullable.NullInt,
+		Hrel:          nullable.NullInt,
+		Pression:      nullable.NullFloat,
+		Confiance:     nullable.NullInt,
+	}
 	if err := json.Unmarshal(data, &rf); err != nil {
 		return err
 	}
 	*f = Forecast(rf)
 
-	// unmarshall sentinel fields as pointers to detect 'null' json values
-	testNull := struct {
-		Temp      *float64 `json:"T"`
-		WindSpeed *float64 `json:"wind_speed"`
-	}{}
-	if err := json.Unmarshal(data, &testNull); err != nil {
+	// mark forecast as long-term only if basic data is mssing
+	f.LongTerme = !f.T.Valid() || !f.WindSpeed.Valid()
+	return nil
+}
+
+// Unmarshall into a Daily struct, with null values for missing fields
+func (d *Daily) UnmarshalJSON(data []byte) error {
+	type RawDaily Daily
+	rd := RawDaily{
+		Tmin: nullable.NullFloat,
+		Tmax: nullable.NullFloat,
+		Hmin: nullable.NullInt,
+		Hmax: nullable.NullInt,
+		Uv:   nullable.NullInt,
+	}
+	if err := json.Unmarshal(data, &rd); err != nil {
 		return err
 	}
-	// mark forecast as long-term only if basic data is mssing
-	f.LongTerme = (testNull.Temp == nil) || (testNull.WindSpeed == nil)
+	*d = Daily(rd)
 	return nil
 }
 
@@ -170,21 +216,50 @@ func (pt *PointType) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (tz *tzParis) UnmarshalJSON(b []byte) error {
-	s, err := unmarshalStringValidate(b, tzStr, "MfProperty.Timezone")
-	if err != nil {
-		return err
+// UnmarshalJSON accepts any IANA timezone known to the time package
+func (tz *Timezone) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("MfProperty.Timezone unmarshal error: %w", err)
+	}
+	if _, err := time.LoadLocation(s); err != nil || s == "" {
+		return fmt.Errorf("MfProperty.Timezone '%s' is not a known timezone", s)
 	}
-	*tz = tzParis(s)
+	*tz = Timezone(s)
 	return nil
 }
 
-func (ctry *countryFr) UnmarshalJSON(b []byte) error {
-	s, err := unmarshalStringValidate(b, countryFrStr, "MfProperty.Country")
+// DefaultTimezone applies to data without timezone, like snapshots
+// saved before it was recorded. Metropolitan maps are the vast majority.
+const DefaultTimezone Timezone = "Europe/Paris"
+
+var defaultLocation = func() *time.Location {
+	loc, err := time.LoadLocation(string(DefaultTimezone))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}()
+
+// Location returns the timezone as a *time.Location.
+// Empty timezone is DefaultTimezone, unknown ones are UTC.
+func (tz Timezone) Location() *time.Location {
+	if tz == "" || tz == DefaultTimezone {
+		return defaultLocation
+	}
+	loc, err := time.LoadLocation(string(tz))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (ctry *country) UnmarshalJSON(b []byte) error {
+	s, err := unmarshalStringValidate(b, countryStr, "MfProperty.Country")
 	if err != nil {
 		return err
 	}
-	*ctry = countryFr(s)
+	*ctry = country(s)
 	return nil
 }
 
@@ -222,3 +297,26 @@ func (multi MultiforecastData) PictoNames() []string {
 	}
 	return pictos
 }
+
+// UpdateTime returns the most recent upstream update time of all features,
+// which identifies the forecast run the data comes from.
+func (multi MultiforecastData) UpdateTime() time.Time {
+	var latest time.Time
+	for _, feat := range multi {
+		if feat.UpdateTime.After(latest) {
+			latest = feat.UpdateTime
+		}
+	}
+	return latest
+}
+
+// UpdateTimeOf returns the upstream update time of the feature of POI
+// insee, zero if missing
+func (multi MultiforecastData) UpdateTimeOf(insee string) time.Time {
+	for _, feat := range multi {
+		if string(feat.Properties.Insee) == insee {
+			return feat.UpdateTime
+		}
+	}
+	return time.Time{}
+}
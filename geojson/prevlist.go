@@ -2,9 +2,11 @@ package geojson
 
 import (
 	"encoding/json"
-	"fmt"
 	"log/slog"
+	"maps"
 	"time"
+
+	"gometeo/nullable"
 )
 
 type (
@@ -19,6 +21,7 @@ type (
 		Time    time.Time   `json:"echeance"`
 		Updated time.Time   `json:"updated"`
 		Prevs   prevsAtPois `json:"prevs"`
+		Tz      Timezone    `json:"-"` // local time of POIs, for day boundaries
 	}
 
 	prevsAtPois map[codeInsee]prevAtPoi
@@ -45,14 +48,32 @@ const (
 	termeCourt
 )
 
-// marshal a prevList (indexed by calendar date) into
-// map indexed by number of relative days
-func (pl PrevList) MarshalJSON() ([]byte, error) {
-	var data = make(map[int]prevsAtDay)
+// PrevRows is a PrevList indexed by number of days relative to J+0,
+// as sent to the client
+type PrevRows map[int]prevsAtDay
+
+// Rows reindexes a prevList (indexed by calendar date) by number of
+// relative days at instant now
+func (pl PrevList) Rows(now time.Time) PrevRows {
+	rows := make(PrevRows, len(pl))
+	loc := pl.Timezone().Location()
 	for d := range pl {
-		data[d.DaysFromNow()] = pl[d]
+		rows[d.DaysFrom(now, loc)] = pl[d]
+	}
+	return rows
+}
+
+// Timezone returns the timezone of the forecasts, DefaultTimezone if unknown.
+// All POIs of a map share the same timezone.
+func (pl PrevList) Timezone() Timezone {
+	for _, pad := range pl {
+		for _, pam := range pad {
+			if pam.Tz != "" {
+				return pam.Tz
+			}
+		}
 	}
-	return json.Marshal(data)
+	return DefaultTimezone
 }
 
 type featInfo struct {
@@ -60,13 +81,20 @@ type featInfo struct {
 	name       string
 	insee      codeInsee
 	updateTime time.Time
+	tz         Timezone
 }
 
-func (pl PrevList) Merge(old PrevList, dayMin, dayMax int) {
+// Merge recovers prevs from old within [dayMin, dayMax] days relative
+// to J+0 at instant now, where pl has none
+func (pl PrevList) Merge(old PrevList, dayMin, dayMax int, now time.Time) {
+	loc := pl.Timezone().Location()
+	if len(pl) == 0 {
+		loc = old.Timezone().Location()
+	}
 	// iterate over old prevs to fill missing slots in pl
 	for date := range old {
 		// ignore dates outside of requested time window
-		n := date.DaysFromNow()
+		n := date.DaysFrom(now, loc)
 		if n < dayMin || n > dayMax {
 			continue
 		}
@@ -89,9 +117,59 @@ func (pl PrevList) Merge(old PrevList, dayMin, dayMax int) {
 	}
 }
 
+// Coverage counts distinct POIs and echeances (moments and dailies)
+// from J+0 at instant now
+func (pl PrevList) Coverage(now time.Time) (pois, echeances int) {
+	loc := pl.Timezone().Location()
+	seen := make(map[codeInsee]bool)
+	for date, pad := range pl {
+		if date.DaysFrom(now, loc) < 0 {
+			continue
+		}
+		for _, pam := range pad {
+			echeances++
+			for insee := range pam.Prevs {
+				seen[insee] = true
+			}
+		}
+	}
+	return len(seen), echeances
+}
+
+// Backfill copies prevs of old from J+0 at instant now into pl, where pl
+// misses either the echeance or the POI. Used to keep serving the last
+// good data when an upstream response is incomplete.
+func (pl PrevList) Backfill(old PrevList, now time.Time) {
+	loc := old.Timezone().Location()
+	for date, padOld := range old {
+		if date.DaysFrom(now, loc) < 0 {
+			continue
+		}
+		pad := pl[date]
+		if pad == nil {
+			pad = make(prevsAtDay)
+			pl[date] = pad
+		}
+		for moment, pamOld := range padOld {
+			pam, ok := pad[moment]
+			if !ok {
+				// old maps are shared with the previous MfMap, do not mutate
+				pamOld.Prevs = maps.Clone(pamOld.Prevs)
+				pad[moment] = pamOld
+				continue
+			}
+			for insee, p := range pamOld.Prevs {
+				if _, ok := pam.Prevs[insee]; !ok {
+					pam.Prevs[insee] = p
+				}
+			}
+		}
+	}
+}
+
 // byEcheance reshapes original data (poi->echeance) into a
 // reversed jour->moment->poi structure
-// TODO: improve handling of incomplete/invalid mutliforecast
+// Incomplete or invalid data is expected to be fixed by Repair() first.
 func (mf MultiforecastData) BuildPrevs() (PrevList, error) {
 	pl := make(PrevList)
 
@@ -103,12 +181,14 @@ func (mf MultiforecastData) BuildPrevs() (PrevList, error) {
 			name:       mf[i].Properties.Name,
 			insee:      mf[i].Properties.Insee,
 			updateTime: mf[i].UpdateTime,
+			tz:         mf[i].Properties.Timezone,
 		}
+		loc := fi.tz.Location()
 
 		// iterate over echeances
 		for j := range forecasts {
 			f := &(forecasts[j])
-			e := f.Echeance()
+			e := f.EcheanceIn(loc)
 
 			// create PrevAtDay struct on first pass
 			pad, ok := pl[e.Date]
@@ -120,7 +200,7 @@ func (mf MultiforecastData) BuildPrevs() (PrevList, error) {
 			}
 
 			// accumulate Daily prev into PrevAtDay
-			d := mf.findDaily(fi.insee, e)
+			d := mf.findDaily(fi.insee, e, loc)
 			if d == nil {
 				//log.Printf("Missing daily data for id=%s (%s) echeance %s", fi.insee, fi.name, e)
 				continue
@@ -134,14 +214,14 @@ func (mf MultiforecastData) BuildPrevs() (PrevList, error) {
 	return pl, nil
 }
 
-func (mf MultiforecastData) findDaily(id codeInsee, e Echeance) *Daily {
-	day := e.Date.asTime()
+// findDaily returns the daily forecast of POI id on the local date of e
+func (mf MultiforecastData) findDaily(id codeInsee, e Echeance, loc *time.Location) *Daily {
 	for _, feat := range mf {
 		if feat.Properties.Insee != id {
 			continue
 		}
 		for _, d := range feat.Properties.Dailies {
-			if d.Time != day {
+			if d.EcheanceIn(loc).Date != e.Date {
 				continue
 			}
 			return &d
@@ -167,6 +247,7 @@ func (pad prevsAtDay) processPrev(m MomentName, fi featInfo, fb forecastBuild) {
 		pam.Time = fb.D.Time
 	}
 	pam.Updated = fi.updateTime
+	pam.Tz = fi.tz
 	pam.Prevs[fi.insee] = prevAtPoi{
 		Title:  fi.name,
 		Coords: fi.coords,
@@ -183,30 +264,30 @@ func (fb forecastBuild) MarshalJSON() ([]byte, error) {
 	type marshallPrev struct {
 		// from Forecast
 		// TODO : omitempty and pointer types
-		Moment MomentName `json:"moment_day"`
-		Time   time.Time  `json:"time"`
-		T      float64    `json:"T"`
-
-		TWindchill    float64 `json:"T_windchill"`
-		WindSpeed     int     `json:"wind_speed"`
-		WindSpeedGust int     `json:"wind_speed_gust"`
-		WindDirection int     `json:"wind_direction"`
-		WindIcon      string  `json:"wind_icon"`
-		//Iso0      int     `json:"iso0"`
-		CloudCover  int     `json:"total_cloud_cover"`
-		WeatherIcon string  `json:"weather_icon"`
-		WeatherDesc string  `json:"weather_description"`
-		Hrel        int     `json:"relative_humidity"`
-		Pression    float64 `json:"P_sea"`
-		Confiance   int     `json:"weather_confidence_index"`
+		Moment MomentName     `json:"moment_day"`
+		Time   time.Time      `json:"time"`
+		T      nullable.Float `json:"T"`
+
+		TWindchill    nullable.Float `json:"T_windchill"`
+		WindSpeed     nullable.Int   `json:"wind_speed"`
+		WindSpeedGust nullable.Int   `json:"wind_speed_gust"`
+		WindDirection nullable.Int   `json:"wind_direction"`
+		WindIcon      string         `json:"wind_icon"`
+		//Iso0      nullable.Int     `json:"iso0"`
+		CloudCover  nullable.Int   `json:"total_cloud_cover"`
+		WeatherIcon string         `json:"weather_icon"`
+		WeatherDesc string         `json:"weather_description"`
+		Hrel        nullable.Int   `json:"relative_humidity"`
+		Pression    nullable.Float `json:"P_sea"`
+		Confiance   nullable.Int   `json:"weather_confidence_index"`
 
 		// from Daily
 		//Time   time.Time `json:"time"`
-		Tmin float64 `json:"T_min"`
-		Tmax float64 `json:"T_max"`
-		Hmin int     `json:"relative_humidity_min"`
-		Hmax int     `json:"relative_humidity_max"`
-		Uv   int     `json:"uv_index"`
+		Tmin nullable.Float `json:"T_min"`
+		Tmax nullable.Float `json:"T_max"`
+		Hmin nullable.Int   `json:"relative_humidity_min"`
+		Hmax nullable.Int   `json:"relative_humidity_max"`
+		Uv   nullable.Int   `json:"uv_index"`
 		//WeatherIcon string    `json:"daily_weather_icon"`
 		//WeatherDesc string    `json:"daily_weather_description"`
 
@@ -216,25 +297,41 @@ func (fb forecastBuild) MarshalJSON() ([]byte, error) {
 	// alias
 	f, d := fb.F, fb.D
 
-	// DEBUG : catch a production bug
+	// incomplete data is sent as null rather than failing the whole map
 	if d == nil && f == nil {
-		return nil, fmt.Errorf("forecastBuild has 2 nil pointers")
-	}
-	if d == nil {
-		return nil, fmt.Errorf("missing daily prev with forecast %s,", fb.F.describe())
+		return []byte("null"), nil
 	}
 
-	// basic init with fields for the Daily version (long-term)
+	// basic init with all values null, long-term version
 	obj := marshallPrev{
-		Time:        d.Time,
-		Tmin:        d.Tmin,
-		Tmax:        d.Tmax,
-		Hmin:        d.Hmin,
-		Hmax:        d.Hmax,
-		Uv:          d.Uv,
-		WeatherIcon: d.WeatherIcon,
-		WeatherDesc: d.WeatherDesc,
-		LongTerme:   true,
+		T:             nullable.NullFloat,
+		TWindchill:    nullable.NullFloat,
+		WindSpeed:     nullable.NullInt,
+		WindSpeedGust: nullable.NullInt,
+		WindDirection: nullable.NullInt,
+		CloudCover:    nullable.NullInt,
+		Hrel:          nullable.NullInt,
+		Pression:      nullable.NullFloat,
+		Confiance:     nullable.NullInt,
+		Tmin:          nullable.NullFloat,
+		Tmax:          nullable.NullFloat,
+		Hmin:          nullable.NullInt,
+		Hmax:          nullable.NullInt,
+		Uv:            nullable.NullInt,
+		LongTerme:     true,
+	}
+	// fields for the Daily version
+	if d != nil {
+		obj.Time = d.Time
+		obj.Tmin = d.Tmin
+		obj.Tmax = d.Tmax
+		obj.Hmin = d.Hmin
+		obj.Hmax = d.Hmax
+		obj.Uv = d.Uv
+		obj.WeatherIcon = d.WeatherIcon
+		obj.WeatherDesc = d.WeatherDesc
+	} else {
+		obj.Time = f.Time
 	}
 	// updates for the reguar version
 	if f != nil && !f.LongTerme {
@@ -257,10 +354,6 @@ func (fb forecastBuild) MarshalJSON() ([]byte, error) {
 	return json.Marshal(obj)
 }
 
-func (f *Forecast) describe() string {
-	return fmt.Sprintf("time %v", f.Time)
-}
-
 // marshal (unordered) PrevAtDay maps into an (ordered) json array
 // avoid putting code about moments names and ordering into front-end
 // either 1 single daily map, or 4 matin/am/soir/nuit maps
@@ -0,0 +1,221 @@
+package geojson
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gometeo/nullable"
+)
+
+// IssueKind classifies data-quality issues in upstream forecasts
+type IssueKind string
+
+const (
+	IssueMissingDaily    IssueKind = "missing-daily"    // daily synthesized from the four moments
+	IssueDroppedEcheance IssueKind = "dropped-echeance" // no daily and not enough moments to build one
+	IssueDuplicate       IssueKind = "duplicate"        // duplicate moment or daily, first one kept
+	IssueOutOfRange      IssueKind = "out-of-range"     // value replaced by null
+)
+
+// Issue is a data-quality problem found on a POI, and how it was handled
+type Issue struct {
+	Insee  string
+	Name   string
+	Kind   IssueKind
+	Detail string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s (%s) %s: %s", i.Name, i.Insee, i.Kind, i.Detail)
+}
+
+// valid ranges of numeric values, outside values are replaced by null
+type validRange struct{ min, max float64 }
+
+var (
+	rangeTemperature = validRange{-70, 60}
+	rangeWind        = validRange{0, 100} // m/s
+	rangePercent     = validRange{0, 100}
+	rangePression    = validRange{850, 1100}
+	rangeUv          = validRange{0, 20}
+)
+
+func (r validRange) float(v *nullable.Float) bool {
+	if v.Valid() && (float64(*v) < r.min || float64(*v) > r.max) {
+		*v = nullable.NullFloat
+		return false
+	}
+	return true
+}
+
+func (r validRange) int(v *nullable.Int) bool {
+	if v.Valid() && (float64(*v) < r.min || float64(*v) > r.max) {
+		*v = nullable.NullInt
+		return false
+	}
+	return true
+}
+
+// allTrue is a non short-circuiting &&, so that all values are checked
+func allTrue(b ...bool) bool {
+	for _, ok := range b {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Repair checks forecasts of each POI and fixes them in place, so a bad
+// value or echeance does not fail the whole map. Run after ParseMultiforecast
+// and before BuildPrevs. Returns issues found, one per repair.
+func (mf MultiforecastData) Repair() []Issue {
+	var issues []Issue
+	for i := range mf {
+		issues = append(issues, mf[i].repair()...)
+	}
+	return issues
+}
+
+func (feat *mfFeature) repair() []Issue {
+	var issues []Issue
+	p := &feat.Properties
+	issue := func(kind IssueKind, format string, a ...any) {
+		issues = append(issues, Issue{
+			Insee:  string(p.Insee),
+			Name:   p.Name,
+			Kind:   kind,
+			Detail: fmt.Sprintf(format, a...),
+		})
+	}
+	loc := p.Timezone.Location()
+
+	// duplicates, keep the first one
+	seen := make(map[Echeance]bool, len(p.Forecasts))
+	p.Forecasts = slices.DeleteFunc(p.Forecasts, func(f Forecast) bool {
+		e := f.EcheanceIn(loc)
+		if seen[e] {
+			issue(IssueDuplicate, "forecast %s", e)
+			return true
+		}
+		seen[e] = true
+		return false
+	})
+	days := make(map[Date]bool, len(p.Dailies))
+	p.Dailies = slices.DeleteFunc(p.Dailies, func(d Daily) bool {
+		e := d.EcheanceIn(loc)
+		if days[e.Date] {
+			issue(IssueDuplicate, "daily %s", e.Date)
+			return true
+		}
+		days[e.Date] = true
+		return false
+	})
+
+	// out of range values
+	for j := range p.Forecasts {
+		f := &p.Forecasts[j]
+		ok := allTrue(
+			rangeTemperature.float(&f.T),
+			rangeTemperature.float(&f.TWindchill),
+			rangeWind.int(&f.WindSpeed),
+			rangeWind.int(&f.WindSpeedGust),
+			rangePercent.int(&f.CloudCover),
+			rangePercent.int(&f.Hrel),
+			rangePression.float(&f.Pression),
+		)
+		if !ok {
+			issue(IssueOutOfRange, "forecast %s", f.EcheanceIn(loc))
+			f.LongTerme = !f.T.Valid() || !f.WindSpeed.Valid()
+		}
+	}
+	for j := range p.Dailies {
+		d := &p.Dailies[j]
+		ok := allTrue(
+			rangeTemperature.float(&d.Tmin),
+			rangeTemperature.float(&d.Tmax),
+			rangePercent.int(&d.Hmin),
+			rangePercent.int(&d.Hmax),
+			rangeUv.int(&d.Uv),
+		)
+		if ok && d.Tmin.Valid() && d.Tmax.Valid() && d.Tmin > d.Tmax {
+			d.Tmin, d.Tmax = nullable.NullFloat, nullable.NullFloat
+			ok = false
+		}
+		if !ok {
+			issue(IssueOutOfRange, "daily %s", d.EcheanceIn(loc).Date)
+		}
+	}
+
+	// missing dailies. Dates at both ends of the forecast window are often
+	// partial and without daily upstream, they are dropped silently.
+	byDate := make(map[Date][]Forecast)
+	var dates []Date
+	for _, f := range p.Forecasts {
+		d := f.EcheanceIn(loc).Date
+		if _, ok := byDate[d]; !ok {
+			dates = append(dates, d)
+		}
+		byDate[d] = append(byDate[d], f)
+	}
+	dropped := make(map[Date]bool)
+	for k, date := range dates {
+		if days[date] {
+			continue
+		}
+		if d, ok := synthesizeDaily(date, byDate[date], loc); ok {
+			p.Dailies = append(p.Dailies, d)
+			issue(IssueMissingDaily, "daily %s built from forecasts", date)
+			continue
+		}
+		dropped[date] = true
+		if k != 0 && k != len(dates)-1 {
+			issue(IssueDroppedEcheance, "%d forecasts on %s without daily", len(byDate[date]), date)
+		}
+	}
+	if len(dropped) > 0 {
+		p.Forecasts = slices.DeleteFunc(p.Forecasts, func(f Forecast) bool {
+			return dropped[f.EcheanceIn(loc).Date]
+		})
+	}
+	slices.SortFunc(p.Dailies, func(a, b Daily) int { return a.Time.Compare(b.Time) })
+	return issues
+}
+
+// synthesizeDaily builds the daily of date from its four short-term moments
+func synthesizeDaily(date Date, forecasts []Forecast, loc *time.Location) (Daily, bool) {
+	if len(forecasts) != len(momentsStr) {
+		return Daily{}, false
+	}
+	d := Daily{
+		Time: time.Date(date.Year, date.Month, date.Day, 0, 0, 0, 0, loc),
+		Tmin: nullable.NullFloat,
+		Tmax: nullable.NullFloat,
+		Hmin: nullable.NullInt,
+		Hmax: nullable.NullInt,
+		Uv:   nullable.NullInt,
+	}
+	for _, f := range forecasts {
+		if f.LongTerme {
+			return Daily{}, false
+		}
+		if !d.Tmin.Valid() || f.T < d.Tmin {
+			d.Tmin = f.T
+		}
+		if !d.Tmax.Valid() || f.T > d.Tmax {
+			d.Tmax = f.T
+		}
+		if f.Hrel.Valid() && (!d.Hmin.Valid() || f.Hrel < d.Hmin) {
+			d.Hmin = f.Hrel
+		}
+		if f.Hrel.Valid() && (!d.Hmax.Valid() || f.Hrel > d.Hmax) {
+			d.Hmax = f.Hrel
+		}
+		// afternoon weather stands for the day
+		if d.WeatherIcon == "" || f.Moment == Apresmidi {
+			d.WeatherIcon, d.WeatherDesc = f.WeatherIcon, f.WeatherDesc
+		}
+	}
+	return d, true
+}
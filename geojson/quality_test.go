@@ -0,0 +1,108 @@
+package geojson_test
+
+import (
+	"strings"
+	"testing"
+
+	gj "gometeo/geojson"
+)
+
+// brokenForecast has duplicates, out-of-range values and missing dailies
+const brokenForecast = `{"type": "FeatureCollection", "features": [{
+	"update_time": "2025-01-01T05:00:00.000Z",
+	"type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [2.35, 48.85]},
+	"properties": {
+		"name": "Paris", "country": "FR - France", "french_department": "75",
+		"timezone": "Europe/Paris", "insee": "751010", "altitude": 35,
+		"forecast": [
+			{"moment_day": "matin", "time": "2025-01-01T07:00:00.000Z", "T": 1, "wind_speed": 5},
+			{"moment_day": "matin", "time": "2025-01-01T07:00:00.000Z", "T": 2, "wind_speed": 5},
+			{"moment_day": "après-midi", "time": "2025-01-01T13:00:00.000Z", "T": 99, "wind_speed": 5, "relative_humidity": 120},
+			{"moment_day": "soirée", "time": "2025-01-01T19:00:00.000Z", "T": 3, "wind_speed": 5},
+			{"moment_day": "nuit", "time": "2025-01-02T01:00:00.000Z", "T": 2, "wind_speed": 5},
+			{"moment_day": "matin", "time": "2025-01-02T07:00:00.000Z", "T": 2, "wind_speed": 5, "relative_humidity": 90},
+			{"moment_day": "après-midi", "time": "2025-01-02T13:00:00.000Z", "T": 6, "wind_speed": 5, "relative_humidity": 60, "weather_icon": "p2j"},
+			{"moment_day": "soirée", "time": "2025-01-02T19:00:00.000Z", "T": 4, "wind_speed": 5, "relative_humidity": 70},
+			{"moment_day": "nuit", "time": "2025-01-03T01:00:00.000Z", "T": 1, "wind_speed": 5},
+			{"moment_day": "matin", "time": "2025-01-03T07:00:00.000Z", "T": 0, "wind_speed": 5},
+			{"moment_day": "après-midi", "time": "2025-01-03T13:00:00.000Z", "T": 5, "wind_speed": 5},
+			{"moment_day": "matin", "time": "2025-01-04T07:00:00.000Z", "T": 0, "wind_speed": 5}
+		],
+		"daily_forecast": [
+			{"time": "2025-01-04T23:00:00.000Z", "T_min": 10, "T_max": 5},
+			{"time": "2024-12-31T23:00:00.000Z", "T_min": 1, "T_max": 8},
+			{"time": "2024-12-31T23:00:00.000Z", "T_min": 0, "T_max": 9}
+		]
+	}
+}]}`
+
+func TestRepair(t *testing.T) {
+	fc, err := gj.ParseMultiforecast(strings.NewReader(brokenForecast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := fc.Features.Repair()
+
+	kinds := make(map[gj.IssueKind]int)
+	for _, issue := range issues {
+		kinds[issue.Kind]++
+		if issue.Insee != "751010" {
+			t.Errorf("issue %v has insee %s", issue, issue.Insee)
+		}
+	}
+	want := map[gj.IssueKind]int{
+		gj.IssueDuplicate:       2, // matin Jan 1st and daily Jan 1st
+		gj.IssueOutOfRange:      2, // T=99 and Tmin > Tmax
+		gj.IssueMissingDaily:    1, // Jan 2nd has 4 moments
+		gj.IssueDroppedEcheance: 1, // Jan 3rd has 2 moments, Jan 4th is the last date
+	}
+	for k, n := range want {
+		if kinds[k] != n {
+			t.Errorf("Repair() got %d %s issues, want %d: %v", kinds[k], k, n, issues)
+		}
+	}
+
+	props := fc.Features[0].Properties
+	if len(props.Forecasts) != 8 {
+		t.Errorf("Repair() kept %d forecasts, want 8", len(props.Forecasts))
+	}
+	if props.Forecasts[0].T != 1 {
+		t.Errorf("duplicate forecast: kept T=%v, want the first one", props.Forecasts[0].T)
+	}
+	if f := props.Forecasts[1]; f.T.Valid() || f.Hrel.Valid() || !f.LongTerme {
+		t.Errorf("out of range T, Hrel got %v, %v longTerme=%v, want nulls and long-term", f.T, f.Hrel, f.LongTerme)
+	}
+	if len(props.Dailies) != 3 {
+		t.Fatalf("Repair() got %d dailies, want 3", len(props.Dailies))
+	}
+	jan1, jan2, jan5 := props.Dailies[0], props.Dailies[1], props.Dailies[2]
+	if jan1.Tmax != 8 {
+		t.Errorf("duplicate daily: kept Tmax=%v, want the first one", jan1.Tmax)
+	}
+	if jan2.Tmin != 1 || jan2.Tmax != 6 || jan2.Hmin != 60 || jan2.Hmax != 90 || jan2.WeatherIcon != "p2j" {
+		t.Errorf("synthesized daily got %+v", jan2)
+	}
+	if got := jan2.Echeance().Date; got != (gj.Date{Year: 2025, Month: 1, Day: 2}) {
+		t.Errorf("synthesized daily on %v, want 2025-01-02", got)
+	}
+	if jan5.Tmin.Valid() || jan5.Tmax.Valid() {
+		t.Errorf("Tmin > Tmax got %v, %v, want nulls", jan5.Tmin, jan5.Tmax)
+	}
+
+	// repaired data builds without loss
+	pl, err := fc.Features.BuildPrevs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []gj.Date{{Year: 2025, Month: 1, Day: 1}, {Year: 2025, Month: 1, Day: 2}} {
+		if got := len(pl[d]); got != 5 {
+			t.Errorf("BuildPrevs() day %v got %d moments, want 5", d, got)
+		}
+	}
+
+	// a second pass finds nothing
+	if issues := fc.Features.Repair(); len(issues) != 0 {
+		t.Errorf("Repair() twice got %v", issues)
+	}
+}
@@ -3,12 +3,21 @@ package main
 import (
 	"log/slog"
 	"os"
+	_ "time/tzdata" // timezones of overseas forecasts, missing from slim images
 
 	"gometeo/appconf"
 	"gometeo/server"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "fakeupstream":
+			os.Exit(fakeUpstream(os.Args[2:]))
+		}
+	}
 
 	appconf.Init(os.Args[1:])
 
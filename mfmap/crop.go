@@ -0,0 +1,90 @@
+package mfmap
+
+import (
+	gj "gometeo/geojson"
+	svt "gometeo/svgtools"
+)
+
+const (
+	// cropMargin is the share of the content size kept around it
+	cropMargin = 0.08
+
+	// cropMinKeep is the minimum share of the upstream map kept on each
+	// axis, so that a map with a single POI is not zoomed on a point
+	cropMinKeep = 0.25
+)
+
+// ContentBounds returns the union of subzone geometries and POI
+// coordinates of m, false if m has none.
+func (m *MfMap) ContentBounds() (gj.Bbox, bool) {
+	var b gj.Bbox
+	found := false
+	add := func(lat, lng float64) {
+		if !found {
+			b = gj.Bbox{LngW: lng, LngE: lng, LatN: lat, LatS: lat}
+			found = true
+			return
+		}
+		b.LngW, b.LngE = min(b.LngW, lng), max(b.LngE, lng)
+		b.LatS, b.LatN = min(b.LatS, lat), max(b.LatN, lat)
+	}
+	for _, feat := range m.Geography.Features {
+		for _, ring := range feat.Geometry.Coords {
+			for _, c := range ring {
+				add(c.Lat, c.Lng)
+			}
+		}
+	}
+	if m.Data != nil {
+		for _, poi := range m.Data.Children {
+			add(float64(poi.Lat), float64(poi.Lng))
+		}
+	}
+	return b, found
+}
+
+// CropBounds returns the crop of the upstream map of m: its content
+// bounds and a margin, as ratios of the geography bbox, which the upstream
+// svg viewbox spans. Falls back to CropRatio without geography bbox or
+// content.
+func (m *MfMap) CropBounds() svt.CropRatio {
+	g := m.Geography.Bbox
+	w, h := g.LngE-g.LngW, g.LatN-g.LatS
+	content, ok := m.ContentBounds()
+	if !ok || w <= 0 || h <= 0 {
+		return CropRatio
+	}
+	left, right := cropAxis(
+		(content.LngW-g.LngW)/w,
+		(g.LngE-content.LngE)/w,
+	)
+	top, bottom := cropAxis(
+		(g.LatN-content.LatN)/h,
+		(content.LatS-g.LatS)/h,
+	)
+	return svt.CropRatio{Left: left, Right: right, Top: top, Bottom: bottom}
+}
+
+// cropAxis turns the free space before and after the content on an axis,
+// as shares of the map, into crop ratios leaving cropMargin of the content
+// size on each side, and at least cropMinKeep of the map
+func cropAxis(before, after float64) (float64, float64) {
+	size := 1 - before - after
+	if size < 0 {
+		return 0, 0 // not content bounds, ignored
+	}
+	before -= cropMargin * size
+	after -= cropMargin * size
+	if keep := 1 - before - after; keep < cropMinKeep {
+		grow := (cropMinKeep - keep) / 2
+		before, after = before-grow, after-grow
+		// a crop grown past an edge moves to the other side
+		if before < 0 {
+			after += before
+		} else if after < 0 {
+			before += after
+		}
+	}
+	// content beyond the map is not cropped on that side
+	return max(before, 0), max(after, 0)
+}
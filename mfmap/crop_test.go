@@ -0,0 +1,98 @@
+package mfmap
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	gj "gometeo/geojson"
+	sf "gometeo/stringfloat"
+	svt "gometeo/svgtools"
+)
+
+// testGeography spans lng 0 to 10 and lat 40 to 50, with a subzone
+// polygon of the given [lng, lat] coordinates
+func testGeography(t *testing.T, coords string) gj.GeoCollection {
+	t.Helper()
+	src := `{"type": "FeatureCollection", "bbox": [0, 50, 10, 40], "features": [{
+		"type": "Feature", "bbox": [0, 50, 10, 40],
+		"properties": {"prop0": {"nom": "zone", "cible": "Z1"}},
+		"geometry": {"type": "Polygon", "coordinates": [` + coords + `]}}]}`
+	gc, err := gj.ParseGeography(strings.NewReader(src), map[string]string{"Z1": "zone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *gc
+}
+
+func TestCropBounds(t *testing.T) {
+	pois := func(coords ...float64) *MapData {
+		d := &MapData{}
+		for i := 0; i+1 < len(coords); i += 2 {
+			d.Children = append(d.Children, Poi{Lat: sf.StringFloat(coords[i]), Lng: sf.StringFloat(coords[i+1])})
+		}
+		return d
+	}
+	tests := []struct {
+		name  string
+		geo   string // subzone polygon, none if empty
+		noBox bool
+		data  *MapData
+		want  svt.CropRatio
+	}{
+		{name: "no content", data: pois(), want: CropRatio},
+		{name: "no geography bbox", noBox: true, data: pois(45, 5), want: CropRatio},
+		{
+			name: "pois with margin", data: pois(44, 2, 48, 6),
+			want: svt.CropRatio{Left: 0.168, Right: 0.368, Top: 0.168, Bottom: 0.368},
+		},
+		{
+			name: "pois and subzone", geo: `[[1, 45], [3, 49], [3, 45], [1, 45]]`, data: pois(44, 2, 48, 6),
+			want: svt.CropRatio{Left: 0.06, Right: 0.36, Top: 0.06, Bottom: 0.36},
+		},
+		{
+			name: "single poi", data: pois(45, 5),
+			want: svt.CropRatio{Left: 0.375, Right: 0.375, Top: 0.375, Bottom: 0.375},
+		},
+		{
+			name: "single poi near an edge", data: pois(45, 0.5),
+			want: svt.CropRatio{Left: 0, Right: 0.75, Top: 0.375, Bottom: 0.375},
+		},
+		{
+			name: "content beyond the map", geo: `[[-1, 39], [11, 51], [-1, 51], [-1, 39]]`, data: pois(),
+			want: svt.CropRatio{},
+		},
+	}
+	for _, tc := range tests {
+		m := MfMap{Data: tc.data, Geography: testGeography(t, "")}
+		if tc.geo != "" {
+			m.Geography = testGeography(t, tc.geo)
+		} else {
+			m.Geography.Features = nil
+		}
+		if tc.noBox {
+			m.Geography.Bbox = gj.Bbox{}
+		}
+		got := m.CropBounds()
+		near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+		if !near(got.Left, tc.want.Left) || !near(got.Right, tc.want.Right) ||
+			!near(got.Top, tc.want.Top) || !near(got.Bottom, tc.want.Bottom) {
+			t.Errorf("%s: CropBounds() = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseSvgCrop(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="1000px" height="1000px" viewBox="0 0 1000 1000"/>`
+	m := MfMap{Data: &MapData{Children: []Poi{{Lat: 45, Lng: 5}}}, Geography: testGeography(t, "")}
+	m.Geography.Features = nil
+	if err := m.ParseSvgMap(strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	if want := (svt.CropRatio{Left: 0.375, Right: 0.375, Top: 0.375, Bottom: 0.375}); m.SvgCrop != want {
+		t.Errorf("SvgCrop = %+v, want %+v", m.SvgCrop, want)
+	}
+	if !strings.Contains(string(m.SvgMap), `viewBox="375 375 250 250"`) {
+		t.Errorf("svg not cropped to the poi: %s", m.SvgMap)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"slices"
+	"strings"
 
+	"gometeo/mfmap/scope"
 	sf "gometeo/stringfloat"
 )
 
@@ -74,19 +77,58 @@ func ParseData(r io.Reader) (*MapData, error) {
 		return nil, err
 	}
 
-	// exclude marine & montagne & outermer
+	// exclude marine & montagne from metropolitan maps,
+	// and keep only subzones of their own family on other maps
 	filteredSubzones := make(Subzones)
 	re, ok := szFilters[data.Info.Taxonomy]
+	family := familyOf(data.Info.Path)
 	// keep only subzones matching filter regexp, ignore others
-	for id := range data.Subzones {
-		if ok && re.MatchString(id) {
-			filteredSubzones[id] = data.Subzones[id]
+	for id, sz := range data.Subzones {
+		if (ok && family == nil && re.MatchString(id)) || (family != nil && strings.HasPrefix(sz.Path, family.Prefix)) {
+			filteredSubzones[id] = sz
 		}
 	}
 	data.Subzones = filteredSubzones
 	return &data, nil
 }
 
+// subzoneTaxonomy is the taxonomy of subzones kept by szFilters
+var subzoneTaxonomy = map[string]string{
+	"PAYS":   "REGION",
+	"REGION": "DEPARTEMENT",
+}
+
+// subzonesTaxonomy returns the taxonomy of subzones of data, the one of
+// their family for montagne and marine maps
+func (data *MapData) subzonesTaxonomy() string {
+	if family := familyOf(data.Info.Path); family != nil {
+		return family.Subzones
+	}
+	return subzoneTaxonomy[data.Info.Taxonomy]
+}
+
+// zone returns the scope zone of the map of data
+func (data *MapData) zone() scope.Zone {
+	return scope.Zone{Path: extractPath(data.Info.Path), Id: data.Info.IdTechnique, Taxonomy: data.Info.Taxonomy}
+}
+
+// FilterScope drops subzones out of sc, so they are neither crawled
+// nor linked from this map. ancestors are the zones above this map,
+// from the crawl root down.
+func (data *MapData) FilterScope(sc *scope.Scope, ancestors []scope.Zone) {
+	if sc == nil {
+		return
+	}
+	ancestors = append(slices.Clip(ancestors), data.zone())
+	taxo := data.subzonesTaxonomy()
+	for id, sz := range data.Subzones {
+		z := scope.Zone{Path: extractPath(sz.Path), Id: id, Taxonomy: taxo}
+		if !sc.Allows(ancestors, z) {
+			delete(data.Subzones, id)
+		}
+	}
+}
+
 func (m *MfMap) Name() string {
 	if m.Data == nil {
 		return "undefined"
@@ -94,6 +136,14 @@ func (m *MfMap) Name() string {
 	return m.Data.Info.Name
 }
 
+// Zone returns the scope zone of m, the zero Zone before parsing
+func (m *MfMap) Zone() scope.Zone {
+	if m.Data == nil {
+		return scope.Zone{}
+	}
+	return m.Data.zone()
+}
+
 func (m *MfMap) Path() string {
 	if m.Data == nil {
 		return "undefined"
@@ -102,15 +152,22 @@ func (m *MfMap) Path() string {
 	if m.Data.Info.IdTechnique == "PAYS007" {
 		return "france"
 	}
-	return extractPath(m.Data.Info.Path)
+	if p := extractPath(m.Data.Info.Path); p != "" {
+		return p
+	}
+	// family roots like /meteo-montagne have no id suffix
+	return strings.Trim(m.Data.Info.Path, "/")
 }
 
-var pathPattern = regexp.MustCompile(`^/previsions-meteo-france/(.+)/`)
+var pathPattern = regexp.MustCompile(`^/(?:previsions-meteo-france/|(meteo-montagne/|meteo-marine/))(.+)/`)
 
+// extractPath returns the path a map is published under. Family maps keep
+// their family prefix, e.g. "meteo-montagne/chablais", so that they never
+// collide with metropolitan maps of the same name.
 func extractPath(mfPath string) string {
 	match := pathPattern.FindStringSubmatch(mfPath)
-	if (match != nil) && (len(match) == 2) {
-		return match[1]
+	if (match != nil) && (len(match) == 3) {
+		return match[1] + match[2]
 	}
 	return ""
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"gometeo/mfmap"
+	"gometeo/mfmap/scope"
 	"gometeo/testutils"
 )
 
@@ -87,3 +88,77 @@ func TestName(t *testing.T) {
 		}
 	})
 }
+
+func TestFilterScope(t *testing.T) {
+	data := mfmap.MapData{
+		Info: mfmap.MapInfo{Taxonomy: "PAYS"},
+		Subzones: mfmap.Subzones{
+			"REGIN84": {Path: "/previsions-meteo-france/auvergne-rhone-alpes/84"},
+			"REGIN53": {Path: "/previsions-meteo-france/bretagne/53"},
+		},
+	}
+	sc, err := scope.Parse("auvergne-rhone-alpes", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.FilterScope(sc, nil)
+	if _, ok := data.Subzones["REGIN84"]; !ok || len(data.Subzones) != 1 {
+		t.Errorf("FilterScope() kept %v, want REGIN84 only", data.Subzones)
+	}
+
+	// the included region keeps all its departments
+	region := mfmap.MapData{
+		Info: mfmap.MapInfo{Taxonomy: "REGION", IdTechnique: "REGIN84", Path: "/previsions-meteo-france/auvergne-rhone-alpes/84"},
+		Subzones: mfmap.Subzones{
+			"DEPT15": {Path: "/previsions-meteo-france/cantal/15"},
+			"DEPT01": {Path: "/previsions-meteo-france/ain/01"},
+		},
+	}
+	region.FilterScope(sc, []scope.Zone{{Path: "", Id: "PAYS007", Taxonomy: "PAYS"}})
+	if len(region.Subzones) != 2 {
+		t.Errorf("FilterScope() on the included region kept %v, want all departments", region.Subzones)
+	}
+
+	// deeper maps inherit the inclusion from their ancestors only, so that
+	// a map refreshed alone is filtered like during the full crawl
+	ancestors := []scope.Zone{
+		{Path: "", Id: "PAYS007", Taxonomy: "PAYS"},
+		{Path: "auvergne-rhone-alpes", Id: "REGIN84", Taxonomy: "REGION"},
+	}
+	for _, tc := range []struct {
+		ancestors []scope.Zone
+		want      int
+	}{
+		{ancestors, 1},
+		{ancestors[:1], 0},
+		{nil, 0},
+	} {
+		dept := mfmap.MapData{
+			Info: mfmap.MapInfo{Taxonomy: "DEPARTEMENT", IdTechnique: "DEPT15", Path: "/previsions-meteo-france/cantal/15"},
+			Subzones: mfmap.Subzones{
+				"MASSIF15": {Path: "/meteo-montagne/cantal/15"},
+			},
+		}
+		dept.FilterScope(sc, tc.ancestors)
+		if len(dept.Subzones) != tc.want {
+			t.Errorf("FilterScope() below %v kept %v, want %d subzones", tc.ancestors, dept.Subzones, tc.want)
+		}
+	}
+
+	// family subzones are matched by their family taxonomy
+	massifs := mfmap.MapData{
+		Info: mfmap.MapInfo{Taxonomy: "MONTAGNE", Path: "/meteo-montagne"},
+		Subzones: mfmap.Subzones{
+			"MASSIF01": {Path: "/meteo-montagne/chablais/1"},
+			"MASSIF02": {Path: "/meteo-montagne/aravis/2"},
+		},
+	}
+	sc, err = scope.Parse("", "taxonomy:MASSIF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	massifs.FilterScope(sc, nil)
+	if len(massifs.Subzones) != 0 {
+		t.Errorf("FilterScope() excluding taxonomy:MASSIF kept %v", massifs.Subzones)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	gj "gometeo/geojson"
+	"gometeo/mfmap"
+	svt "gometeo/svgtools"
+)
+
+// WriteCropOverlay writes the svg map of m with the geography drawn over
+// it: subzone outlines in blue, POIs in red and content bounds dashed in
+// green, projected with the bbox sent to the browser. Shapes off their
+// place on the map show a crop mismatch.
+func WriteCropOverlay(wr io.Writer, m *mfmap.MfMap) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(m.SvgMap); err != nil {
+		return fmt.Errorf("svg map parse error: %w", err)
+	}
+	sz, err := (*svt.Tree)(doc).GetSize()
+	if err != nil {
+		return fmt.Errorf("svg map size error: %w", err)
+	}
+	cr := m.SvgCrop
+	bbox := m.Geography.Bbox.Crop(cr.Left, cr.Right, cr.Top, cr.Bottom)
+	if bbox.LngE <= bbox.LngW || bbox.LatN <= bbox.LatS {
+		return fmt.Errorf("empty geography bbox")
+	}
+	vb := sz.Viewbox
+	project := func(lat, lng float64) (float64, float64) {
+		x := float64(vb[0]) + (lng-bbox.LngW)/(bbox.LngE-bbox.LngW)*float64(vb[2])
+		y := float64(vb[1]) + (bbox.LatN-lat)/(bbox.LatN-bbox.LatS)*float64(vb[3])
+		return x, y
+	}
+	stroke := fmt.Sprint(max(vb[2], vb[3]) / 300)
+
+	overlay := doc.Root().CreateElement("g")
+	overlay.CreateAttr("id", "crop-overlay")
+	overlay.CreateAttr("fill", "none")
+	overlay.CreateAttr("stroke-width", stroke)
+	for _, feat := range m.Geography.Features {
+		for _, ring := range feat.Geometry.Coords {
+			points := make([]string, len(ring))
+			for i, c := range ring {
+				x, y := project(c.Lat, c.Lng)
+				points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+			}
+			p := overlay.CreateElement("polygon")
+			p.CreateAttr("points", strings.Join(points, " "))
+			p.CreateAttr("stroke", "blue")
+		}
+	}
+	if m.Data != nil {
+		for _, poi := range m.Data.Children {
+			x, y := project(float64(poi.Lat), float64(poi.Lng))
+			c := overlay.CreateElement("circle")
+			c.CreateAttr("cx", fmt.Sprintf("%.1f", x))
+			c.CreateAttr("cy", fmt.Sprintf("%.1f", y))
+			c.CreateAttr("r", stroke)
+			c.CreateAttr("fill", "red")
+		}
+	}
+	if content, ok := m.ContentBounds(); ok {
+		rect(overlay, content, project).CreateAttr("stroke-dasharray", stroke+" "+stroke)
+	}
+	_, err = doc.WriteTo(wr)
+	return err
+}
+
+// rect draws b on parent as a green rectangle
+func rect(parent *etree.Element, b gj.Bbox, project func(lat, lng float64) (float64, float64)) *etree.Element {
+	x0, y0 := project(b.LatN, b.LngW)
+	x1, y1 := project(b.LatS, b.LngE)
+	r := parent.CreateElement("rect")
+	r.CreateAttr("x", fmt.Sprintf("%.1f", x0))
+	r.CreateAttr("y", fmt.Sprintf("%.1f", y0))
+	r.CreateAttr("width", fmt.Sprintf("%.1f", x1-x0))
+	r.CreateAttr("height", fmt.Sprintf("%.1f", y1-y0))
+	r.CreateAttr("stroke", "green")
+	return r
+}
@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	gj "gometeo/geojson"
+	"gometeo/mfmap"
+	"gometeo/mfmap/handlers"
+)
+
+func TestWriteCropOverlay(t *testing.T) {
+	const geo = `{"type": "FeatureCollection", "bbox": [0, 50, 10, 40], "features": [{
+		"type": "Feature", "bbox": [0, 50, 10, 40],
+		"properties": {"prop0": {"nom": "zone", "cible": "Z1"}},
+		"geometry": {"type": "Polygon", "coordinates": [[[2, 44], [6, 48], [6, 44], [2, 44]]]}}]}`
+	gc, err := gj.ParseGeography(strings.NewReader(geo), map[string]string{"Z1": "zone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mfmap.MfMap{Data: &mfmap.MapData{Children: []mfmap.Poi{{Lat: 46, Lng: 4}}}, Geography: *gc}
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" width="1000px" height="1000px" viewBox="0 0 1000 1000"/>`
+	if err := m.ParseSvgMap(strings.NewReader(svg)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := handlers.WriteCropOverlay(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	// geography lands on the cropped svg where it was before the crop
+	for _, want := range []string{
+		`viewBox="168 168 463 463"`,
+		`<polygon points="200.0,600.0 600.0,200.0 600.0,600.0 200.0,600.0" stroke="blue"/>`,
+		`<circle cx="400.0" cy="400.0" r="1" fill="red"/>`,
+		`<rect x="200.0" y="200.0" width="400.0" height="400.0" stroke="green" stroke-dasharray="1 1"/>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("overlay lacks %s:\n%s", want, buf.String())
+		}
+	}
+
+	m.SvgMap = nil
+	if err := handlers.WriteCropOverlay(&buf, m); err == nil {
+		t.Error("overlay without svg map must fail")
+	}
+}
@@ -4,21 +4,21 @@ import (
 	"bytes"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
-	"strings"
 
+	"gometeo/clientip"
 	"gometeo/mfmap"
 	"gometeo/obs"
 )
 
-// Register adds handlers to mux for "/$path", "/$path/data", "/$path/cacheid/svg"
-// and a redirection from "/" to "/france". reg may be nil (observability disabled).
+// Register adds handlers to mux for "/$path", "/$path/data", "/$path/cacheid/svg",
+// the "/$path/crop" debug overlay and a redirection from "/" to "/france". reg may be nil (observability disabled).
 func Register(mux *http.ServeMux, m *mfmap.MfMap, reg *obs.Registry) {
 	p := "/" + m.Path()
 	mux.HandleFunc(p, makeMainHandler(m))
 	mux.HandleFunc(p+"/data", makeDataHandler(m, reg))
 	mux.HandleFunc(p+"/"+m.Conf.CacheId+"/svg", makeSvgMapHandler(m))
+	mux.HandleFunc(p+"/crop", makeCropHandler(m))
 	if p == "/france" {
 		mux.HandleFunc("/{$}", makeRedirectHandler("/france"))
 	}
@@ -61,7 +61,12 @@ func makeDataHandler(m *mfmap.MfMap, reg *obs.Registry) func(http.ResponseWriter
 		}
 		// update on data handler (JSON request) instead of main handler
 		// to allow main page caching and avoid simplest bots
-		m.Schedule.MarkHit(clientIP(req))
+		ip := clientip.FromRequest(req)
+		if m.Conf.Hits.Accept(ip, req.UserAgent()) {
+			m.Schedule.MarkHit(ip)
+		} else {
+			reg.RecordHitIgnored()
+		}
 		reg.RecordMapServed()
 	}
 }
@@ -83,20 +88,22 @@ func makeSvgMapHandler(m *mfmap.MfMap) func(http.ResponseWriter, *http.Request)
 	}
 }
 
-// clientIP returns the real client IP, looking through reverse-proxy headers.
-func clientIP(req *http.Request) string {
-	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For may contain a chain: "client, proxy1, proxy2"
-		if ip, _, ok := strings.Cut(xff, ","); ok {
-			return strings.TrimSpace(ip)
+func makeCropHandler(m *mfmap.MfMap) func(http.ResponseWriter, *http.Request) {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		buf := bytes.Buffer{}
+		if err := WriteCropOverlay(&buf, m); err != nil {
+			resp.WriteHeader(http.StatusNotFound)
+			slog.Warn("crop overlay unavailable", "url", req.URL, "err", err)
+			return
+		}
+		resp.Header().Add("Cache-Control", "no-cache")
+		resp.Header().Add("Content-Type", "image/svg+xml")
+		resp.WriteHeader(http.StatusOK)
+		_, err := io.Copy(resp, &buf)
+		if err != nil {
+			slog.Error("send error", "err", err)
 		}
-		return strings.TrimSpace(xff)
-	}
-	if xri := req.Header.Get("X-Real-Ip"); xri != "" {
-		return xri
 	}
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	return ip
 }
 
 func makeRedirectHandler(url string) func(http.ResponseWriter, *http.Request) {
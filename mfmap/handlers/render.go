@@ -65,7 +65,7 @@ type jsonMap struct {
 	Taxonomy   string         `json:"taxonomy"`
 	Bbox       gj.Bbox        `json:"bbox"`
 	SubZones   gj.GeoFeatures `json:"subzones"`
-	Prevs      gj.PrevList    `json:"prevs"`
+	Prevs      gj.PrevRows    `json:"prevs"`
 	Chroniques gj.Graphdata   `json:"chroniques"`
 }
 
@@ -85,7 +85,7 @@ func WriteJson(wr io.Writer, m *mfmap.MfMap) error {
 
 // BuildJson builds the JSON response object for m.
 func BuildJson(m *mfmap.MfMap) (*jsonMap, error) {
-	cr := mfmap.CropRatio
+	cr := m.SvgCrop
 	bbox := m.Geography.Bbox.Crop(cr.Left, cr.Right, cr.Top, cr.Bottom)
 
 	j := jsonMap{
@@ -96,11 +96,11 @@ func BuildJson(m *mfmap.MfMap) (*jsonMap, error) {
 		Taxonomy:   m.Data.Info.Taxonomy,
 		SubZones:   m.Geography.Features,
 		Bbox:       bbox,
-		Prevs:      m.Prevs,
+		Prevs:      m.Prevs.Rows(m.Now()),
 		Chroniques: m.Graphdata,
 	}
-	// highchart disabled for PAYS. Only on DEPTs & REGIONs
-	if m.Data.Info.Taxonomy == "PAYS" {
+	// highchart disabled for overviews (PAYS, family roots). Only on smaller zones
+	if m.IsOverview() {
 		j.Chroniques = nil
 	}
 	return &j, nil
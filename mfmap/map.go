@@ -1,15 +1,23 @@
 package mfmap
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
+	"reflect"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 
+	"gometeo/clock"
 	gj "gometeo/geojson"
 	"gometeo/mfmap/schedule"
+	"gometeo/mfmap/scope"
+	"gometeo/rewrite"
+	"gometeo/schema"
+	svt "gometeo/svgtools"
 )
 
 // MapConf holds runtime configuration injected at construction time.
@@ -17,7 +25,14 @@ type MapConf struct {
 	CacheId  string
 	VueJs    string
 	Upstream string
+	Hosts    rewrite.Hosts // optional; zero value is the api host scraped from pages
 	Rates    schedule.UpdateRates
+	Hits     *schedule.HitFilter // optional; nil counts every data request as a visit
+	Scope    *scope.Scope        // optional; nil crawls all subzones
+	Clock    clock.Clock         // optional; nil is the system clock
+	Schema   *schema.Checker     // optional; nil disables upstream schema checks
+	Budget   schedule.Budget     // optional; nil never stretches update rates
+	Svg      *svt.OptimizeConf   // optional; nil only crops svg maps
 }
 
 // MfMap is the main in-memory storage type of this project.
@@ -34,14 +49,37 @@ type MfMap struct {
 	Prevs     gj.PrevList  // = gj.BuildPrevs()
 	Graphdata gj.Graphdata // =  gj.BuildChroniques()
 
+	// Issues are data-quality problems repaired on last forecast parsing
+	Issues []gj.Issue
+
+	// Reference is the last refresh accepted as complete, when this one was
+	// backfilled: later refreshes are checked against it and backfilled
+	// from it, never from backfilled data. Nil for complete refreshes.
+	Reference *MfMap
+
+	// ProbeRun is the upstream update time of the first POI, the one
+	// requested by crawl probes
+	ProbeRun time.Time
+
 	Pictos []string
 
 	// SvgMap is the background image (viewport-cropped upstream image)
 	SvgMap []byte
 
+	// SvgCrop is the crop applied to SvgMap, and to the bbox sent with
+	// geography so that both stay aligned
+	SvgCrop svt.CropRatio
+
+	// SvgReport tells the bytes saved on SvgMap by optimization
+	SvgReport svt.OptimizeReport
+
 	// Geography are geographical boundaries of subzones
 	Geography gj.GeoCollection
 
+	// Ancestors are the zones above this map, from the crawl root down,
+	// against which MapConf.Scope filters subzones. Set before parsing.
+	Ancestors []scope.Zone
+
 	// breadcrumb is built by recursive parent lookup in MapCollection
 	Parent     string
 	Breadcrumb Breadcrumbs
@@ -65,15 +103,46 @@ type Picto struct {
 	Img  []byte
 }
 
+// Now returns the current time on the clock of m.Conf
+func (m *MfMap) Now() time.Time {
+	return clock.Or(m.Conf.Clock).Now()
+}
+
+// payload shapes checked by MapConf.Schema, other roots are dynamic
+var drupalSpec = schema.Spec{
+	Endpoint: "drupal",
+	Type:     reflect.TypeFor[MapData](),
+	OpenRoot: true, // drupal settings hold many other modules
+}
+
+// bufferSchema reads r into memory when schema checks are enabled, so that
+// the raw payload can be checked once parsed. Otherwise r is unchanged.
+func (m *MfMap) bufferSchema(r io.Reader) (io.Reader, []byte, error) {
+	if m.Conf.Schema == nil {
+		return r, nil, nil
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(raw), raw, nil
+}
+
 func (m *MfMap) ParseHtml(html io.Reader) error {
 	j, err := htmlFilter(html)
 	if err != nil {
 		return err
 	}
+	j, raw, err := m.bufferSchema(j)
+	if err != nil {
+		return err
+	}
 	data, err := ParseData(j)
 	if err != nil {
 		return err
 	}
+	m.Conf.Schema.Check(drupalSpec, m.OriginalPath, raw)
+	data.FilterScope(m.Conf.Scope, m.Ancestors)
 	m.Data = data
 	return nil
 }
@@ -86,8 +155,9 @@ func (m *MfMap) Merge(old *MfMap, dayMin, dayMax int) {
 		return
 	}
 	// merge maps and chroniques
-	m.Prevs.Merge(old.Prevs, dayMin, dayMax)
-	m.Graphdata.Merge(old.Graphdata, dayMin, dayMax)
+	now := m.Now()
+	m.Prevs.Merge(old.Prevs, dayMin, dayMax, now)
+	m.Graphdata.Merge(old.Graphdata, dayMin, dayMax, now)
 
 	// copy stats
 	m.Schedule.CopyFrom(&old.Schedule)
@@ -139,21 +209,33 @@ func isJsonTag(t html.Token) bool {
 }
 
 func (m *MfMap) ParseMultiforecast(r io.Reader) error {
+	r, raw, err := m.bufferSchema(r)
+	if err != nil {
+		return err
+	}
 	fc, err := gj.ParseMultiforecast(r)
 	if err != nil {
 		return err
 	}
+	m.Conf.Schema.Check(schema.Spec{Endpoint: "multiforecast", Type: reflect.TypeOf(fc)}, m.OriginalPath, raw)
+	// fix incomplete or invalid forecasts instead of failing the whole map
+	issues := fc.Features.Repair()
 	prevs, err := fc.Features.BuildPrevs()
 	if err != nil {
 		return err
 	}
-	graphdata, err := fc.Features.BuildChroniques()
+	graphdata, err := fc.Features.BuildChroniques(m.Now())
 	if err != nil {
 		return err
 	}
 	m.Prevs = prevs
 	m.Graphdata = graphdata
+	m.Issues = issues
 	m.Pictos = fc.Features.PictoNames()
+	m.Schedule.ObserveRun(fc.Features.UpdateTime())
+	if m.Data != nil && len(m.Data.Children) > 0 {
+		m.ProbeRun = fc.Features.UpdateTimeOf(m.Data.Children[0].Insee)
+	}
 	return nil
 }
 
@@ -171,11 +253,19 @@ func (m *MfMap) ParseGeography(r io.Reader) error {
 		}
 		subzones[sz] = path
 	}
+	r, raw, err := m.bufferSchema(r)
+	if err != nil {
+		return err
+	}
 	gc, err := gj.ParseGeography(r, subzones)
 	if err != nil {
 		return err
 	}
+	m.Conf.Schema.Check(schema.Spec{Endpoint: "geography", Type: reflect.TypeOf(gc)}, m.OriginalPath, raw)
 	if gc != nil {
+		if err = gc.Check(m.Bounds()); err != nil {
+			return fmt.Errorf("invalid geography: %w", err)
+		}
 		m.Geography = *gc
 	}
 	return nil
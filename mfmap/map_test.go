@@ -2,11 +2,13 @@ package mfmap_test
 
 import (
 	"bytes"
+	"slices"
 	"strings"
 	"testing"
 
 	"gometeo/mfmap"
 	"gometeo/mfmap/handlers"
+	"gometeo/schema"
 	"gometeo/testutils"
 )
 
@@ -164,3 +166,33 @@ func TestMerge(t *testing.T) {
 		t.Error("Prevs is empty after Merge")
 	}
 }
+
+func TestSchemaCheck(t *testing.T) {
+	const forecast = `{"type": "FeatureCollection", "features": [{
+	"update_time": "2025-01-15T05:00:00.000Z", "type": "Feature",
+	"geometry": {"type": "Point", "coordinates": [2.35, 48.85]},
+	"properties": {
+		"name": "Paris", "country": "FR - France", "french_department": "75",
+		"timezone": "Europe/Paris", "insee": "751010", "altitude": 35,
+		"forecast": [{"moment_day": "après-midi", "time": "2025-01-15T13:00:00.000Z", "T": 5, "wind_speed": 3, "snow_risk": 0}],
+		"daily_forecast": [{"time": "2025-01-14T23:00:00.000Z", "T_min": 1, "T_max": 6}]
+	}}]}`
+	m := &mfmap.MfMap{Conf: mfmap.MapConf{Schema: schema.New(nil)}}
+	if err := m.ParseMultiforecast(strings.NewReader(forecast)); err != nil {
+		t.Fatal(err)
+	}
+	invs := m.Conf.Schema.Inventories()
+	if len(invs) != 1 || invs[0].Endpoint != "multiforecast" {
+		t.Fatalf("Inventories() got %+v", invs)
+	}
+	inv := invs[0]
+	if want := []string{"features[].properties.forecast[].snow_risk"}; !slices.Equal(inv.Unknown, want) {
+		t.Errorf("unknown fields got %v, want %v", inv.Unknown, want)
+	}
+	if slices.Contains(inv.Missing, "features[].properties.forecast[].long_terme") {
+		t.Error("computed field long_terme reported missing")
+	}
+	if !slices.Contains(inv.Missing, "features[].properties.forecast[].P_sea") {
+		t.Errorf("missing P_sea not reported in %v", inv.Missing)
+	}
+}
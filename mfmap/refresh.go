@@ -0,0 +1,109 @@
+package mfmap
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReferenceMaxAge bounds the age of the data backfilled into degraded
+// refreshes: past it, refreshes are accepted as they come, unless empty.
+const ReferenceMaxAge = 24 * time.Hour
+
+// RefreshVerdict tells how a refreshed map replaces the stored one
+type RefreshVerdict int
+
+const (
+	RefreshAccepted RefreshVerdict = iota // stored as is
+	RefreshPartial                        // stored, backfilled from the previous map
+	RefreshRejected                       // dropped, the previous map is kept
+)
+
+func (v RefreshVerdict) String() string {
+	switch v {
+	case RefreshPartial:
+		return "partial"
+	case RefreshRejected:
+		return "rejected"
+	}
+	return "accepted"
+}
+
+// RefreshCheck is the result of CheckRefresh
+type RefreshCheck struct {
+	Verdict RefreshVerdict
+	Reasons []string
+}
+
+func (c *RefreshCheck) degrade(v RefreshVerdict, format string, a ...any) {
+	c.Verdict = max(c.Verdict, v)
+	c.Reasons = append(c.Reasons, fmt.Sprintf(format, a...))
+}
+
+// reference returns the last refresh accepted as complete among m and its
+// reference, nil when older than ReferenceMaxAge.
+func (m *MfMap) reference(now time.Time) *MfMap {
+	ref := m
+	if m.Reference != nil {
+		ref = m.Reference
+	}
+	if now.Sub(ref.Schedule.LastUpdate()) > ReferenceMaxAge {
+		return nil
+	}
+	return ref
+}
+
+// CheckRefresh compares m, just fetched, with old, the stored version of
+// the same map. A refresh is degraded when it has less than ratio times the
+// POIs or echeances from J+0 of the last complete refresh, or lost an
+// asset: it is then partial. It is rejected if it has no forecast at all
+// while old has some.
+func (m *MfMap) CheckRefresh(old *MfMap, ratio float64) RefreshCheck {
+	var c RefreshCheck
+	now := m.Now()
+	pois, echeances := m.Prevs.Coverage(now)
+	if oldPois, oldEcheances := old.Prevs.Coverage(now); (pois == 0 || echeances == 0) && oldEcheances > 0 {
+		c.degrade(RefreshRejected, "no forecast, had %d POIs", oldPois)
+		return c
+	}
+	ref := old.reference(now)
+	if ref == nil {
+		return c
+	}
+	oldPois, oldEcheances := ref.Prevs.Coverage(now)
+	if float64(pois) < ratio*float64(oldPois) {
+		c.degrade(RefreshPartial, "%d POIs, had %d", pois, oldPois)
+	}
+	if float64(echeances) < ratio*float64(oldEcheances) {
+		c.degrade(RefreshPartial, "%d echeances, had %d", echeances, oldEcheances)
+	}
+	if len(m.SvgMap) == 0 && len(ref.SvgMap) > 0 {
+		c.degrade(RefreshPartial, "svg map missing")
+	}
+	if len(m.Geography.Features) == 0 && len(ref.Geography.Features) > 0 {
+		c.degrade(RefreshPartial, "geography missing")
+	}
+	return c
+}
+
+// Backfill completes m, a partial refresh of old, with data missing in m:
+// assets, and forecasts from J+0 by echeance and by POI, taken from the
+// last complete refresh only. Past days are recovered by Merge.
+func (m *MfMap) Backfill(old *MfMap) {
+	now := m.Now()
+	ref := old.reference(now)
+	if ref == nil {
+		return
+	}
+	m.Reference = ref
+	if len(m.SvgMap) == 0 {
+		m.SvgMap, m.SvgCrop, m.SvgReport = ref.SvgMap, ref.SvgCrop, ref.SvgReport
+	}
+	if len(m.Geography.Features) == 0 {
+		m.Geography = ref.Geography
+	}
+	m.Prevs.Backfill(ref.Prevs, now)
+	// chroniques from J+0 too
+	loc := ref.Prevs.Timezone().Location()
+	y, mo, d := now.In(loc).Date()
+	m.Graphdata.Backfill(ref.Graphdata, time.Date(y, mo, d, 0, 0, 0, 0, loc))
+}
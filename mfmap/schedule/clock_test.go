@@ -0,0 +1,65 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"gometeo/mfmap/schedule"
+	"gometeo/testutils"
+)
+
+func TestFailureBackoffClock(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2026, 3, 29, 0, 30, 0, 0, time.UTC))
+	s := schedule.Stats{
+		Rates: schedule.UpdateRates{
+			HotMaxAge:      time.Hour,
+			ColdMaxAge:     4 * time.Hour,
+			FailureBackoff: 30 * time.Minute,
+		},
+		Clock: clk,
+	}
+	s.MarkUpdate()
+	if got := s.DurationToUpdate(); got != 4*time.Hour {
+		t.Errorf("DurationToUpdate() after update got %s, want 4h", got)
+	}
+	clk.Advance(5 * time.Hour)
+	if got := s.DurationToUpdate(); got != -time.Hour {
+		t.Errorf("DurationToUpdate() overdue got %s, want -1h", got)
+	}
+	s.MarkFailure()
+	tests := []struct {
+		advance time.Duration
+		want    time.Duration
+	}{
+		{0, 30 * time.Minute},
+		{20 * time.Minute, 10 * time.Minute},
+		{10 * time.Minute, 0},
+		// overdue again once the backoff is over
+		{time.Hour, -time.Hour},
+	}
+	for _, tc := range tests {
+		clk.Advance(tc.advance)
+		if got := s.DurationToUpdate(); got != tc.want {
+			t.Errorf("DurationToUpdate() at %s got %s, want %s", clk.Now(), got, tc.want)
+		}
+	}
+}
+
+func TestHotExpiryClock(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC))
+	s := schedule.Stats{
+		Rates: schedule.UpdateRates{HotDuration: time.Hour, HotVisitors: 1},
+		Clock: clk,
+	}
+	s.MarkHit("192.0.2.1")
+	if !s.IsHot() {
+		t.Fatal("IsHot() false right after a hit")
+	}
+	if !s.LastHit().Equal(clk.Now()) {
+		t.Errorf("LastHit() got %s, want %s", s.LastHit(), clk.Now())
+	}
+	clk.Advance(time.Hour + time.Minute)
+	if s.IsHot() {
+		t.Error("IsHot() still true after HotDuration")
+	}
+}
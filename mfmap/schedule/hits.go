@@ -0,0 +1,175 @@
+package schedule
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// histogram covers the last 7 days with one bucket per hour
+const (
+	histogramBucket = time.Hour
+	histogramSize   = 7 * 24
+)
+
+// DefaultBotPattern matches user agents of crawlers, uptime monitors,
+// link previewers and scripted clients. Matching is case-insensitive.
+const DefaultBotPattern = `bot|crawl|spider|slurp|archiver|monitor|uptime|pingdom|statuscake|` +
+	`headless|lighthouse|preview|facebookexternalhit|curl|wget|python|go-http-client|java/|okhttp|libwww`
+
+// HitFilter decides which data requests count as visits.
+// A nil *HitFilter accepts every hit.
+type HitFilter struct {
+	botUA   *regexp.Regexp
+	ignored []netip.Prefix
+}
+
+// NewHitFilter builds a filter rejecting user agents matching botPattern
+// (case-insensitive, empty disables UA filtering) and clients in ignored.
+func NewHitFilter(botPattern string, ignored []netip.Prefix) (*HitFilter, error) {
+	hf := &HitFilter{ignored: ignored}
+	if botPattern != "" {
+		re, err := regexp.Compile("(?i)" + botPattern)
+		if err != nil {
+			return nil, err
+		}
+		hf.botUA = re
+	}
+	return hf, nil
+}
+
+// Accept reports whether a hit from clientIP with userAgent is a real visit.
+// Requests without a user agent are never browsers.
+func (hf *HitFilter) Accept(clientIP, userAgent string) bool {
+	if hf == nil {
+		return true
+	}
+	if hf.botUA != nil && (strings.TrimSpace(userAgent) == "" || hf.botUA.MatchString(userAgent)) {
+		return false
+	}
+	if len(hf.ignored) > 0 {
+		if ip, err := netip.ParseAddr(clientIP); err == nil {
+			ip = ip.Unmap()
+			for _, p := range hf.ignored {
+				if p.Contains(ip) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// visitor holds per-client timestamps used for deduplication
+// and unique visitors counting
+type visitor struct {
+	lastSeen    time.Time // any accepted hit
+	lastCounted time.Time // last hit recorded into the histogram
+}
+
+// hitLog is the rolling hit accounting of a map: deduplicated visits in
+// hourly buckets, and recently seen clients. Guarded by a mutex because
+// hits are much rarer than reads of atomic stats.
+type hitLog struct {
+	mutex     sync.Mutex
+	buckets   [histogramSize]int
+	hours     [histogramSize]int64 // unix hour of each bucket, detects stale slots
+	visitors  map[string]*visitor
+	lastPrune time.Time
+}
+
+func unixHour(t time.Time) int64 {
+	return t.Unix() / int64(histogramBucket/time.Second)
+}
+
+// record adds a hit from client at time now. Hits closer than dedup to the
+// previous counted hit of the same client are not counted again.
+// Returns true if the hit was counted.
+func (hl *hitLog) record(client string, now time.Time, dedup, retention time.Duration) bool {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+
+	if hl.visitors == nil {
+		hl.visitors = make(map[string]*visitor)
+	}
+	v, ok := hl.visitors[client]
+	if !ok {
+		v = &visitor{}
+		hl.visitors[client] = v
+	}
+	v.lastSeen = now
+	counted := v.lastCounted.IsZero() || now.Sub(v.lastCounted) >= dedup
+	if counted {
+		v.lastCounted = now
+		h := unixHour(now)
+		i := h % histogramSize
+		if hl.hours[i] != h {
+			hl.hours[i] = h
+			hl.buckets[i] = 0
+		}
+		hl.buckets[i]++
+	}
+	// forget old visitors at most once per bucket
+	if now.Sub(hl.lastPrune) >= histogramBucket {
+		hl.lastPrune = now
+		for ip, v := range hl.visitors {
+			if now.Sub(v.lastSeen) > retention {
+				delete(hl.visitors, ip)
+			}
+		}
+	}
+	return counted
+}
+
+// histogram returns counted visits per hour, oldest first, ending at now.
+func (hl *hitLog) histogram(now time.Time) []int {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	out := make([]int, histogramSize)
+	cur := unixHour(now)
+	for k := range histogramSize {
+		h := cur - int64(histogramSize-1-k)
+		if h < 0 {
+			continue
+		}
+		i := h % histogramSize
+		if hl.hours[i] == h {
+			out[k] = hl.buckets[i]
+		}
+	}
+	return out
+}
+
+// uniqueSince counts distinct clients seen after t.
+func (hl *hitLog) uniqueSince(t time.Time) int {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	n := 0
+	for _, v := range hl.visitors {
+		if v.lastSeen.After(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// copyFrom replaces hl content with a deep copy of other.
+func (hl *hitLog) copyFrom(other *hitLog) {
+	if hl == other {
+		return
+	}
+	other.mutex.Lock()
+	buckets, hours := other.buckets, other.hours
+	visitors := make(map[string]*visitor, len(other.visitors))
+	for ip, v := range other.visitors {
+		cp := *v
+		visitors[ip] = &cp
+	}
+	other.mutex.Unlock()
+
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	hl.buckets, hl.hours, hl.visitors = buckets, hours, visitors
+}
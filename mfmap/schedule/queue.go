@@ -0,0 +1,183 @@
+package schedule
+
+import (
+	"container/heap"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Queue is a priority queue of maps keyed by their next due time.
+// The update loop sleeps until the head is due, or until Wake() fires
+// because the head changed.
+//
+// A popped entry is "in flight" until Complete() is called: it is not
+// dispatched again and Schedule() calls on it are ignored, since the
+// running refresh will reschedule it on completion.
+type Queue struct {
+	mutex sync.Mutex
+	heap  queueHeap
+	index map[string]*queueItem // all entries, queued or in flight
+	wake  chan struct{}
+}
+
+// QueueEntry is the introspection view of a queued map.
+type QueueEntry struct {
+	Key      string
+	Due      time.Time
+	InFlight bool
+}
+
+type queueItem struct {
+	key      string
+	due      time.Time
+	inFlight bool
+	pos      int // index in heap, -1 when in flight
+}
+
+type queueHeap []*queueItem
+
+func (h queueHeap) Len() int           { return len(h) }
+func (h queueHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h queueHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+func (h *queueHeap) Push(x any) {
+	it := x.(*queueItem)
+	it.pos = len(*h)
+	*h = append(*h, it)
+}
+func (h *queueHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.pos = -1
+	*h = old[:n-1]
+	return it
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		index: make(map[string]*queueItem),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Wake returns a channel receiving a signal each time the head of the
+// queue may have changed.
+func (q *Queue) Wake() <-chan struct{} {
+	return q.wake
+}
+
+// NOT SAFE - q.mutex must be held
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default: // a wake up is already pending
+	}
+}
+
+// Schedule adds key or moves it to due. Ignored while key is in flight.
+func (q *Queue) Schedule(key string, due time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	it, ok := q.index[key]
+	switch {
+	case !ok:
+		it = &queueItem{key: key, due: due}
+		q.index[key] = it
+		heap.Push(&q.heap, it)
+	case it.inFlight:
+		return
+	case it.due.Equal(due):
+		return
+	default:
+		it.due = due
+		heap.Fix(&q.heap, it.pos)
+	}
+	q.signal()
+}
+
+// Complete marks the refresh of key as finished and schedules it at due.
+func (q *Queue) Complete(key string, due time.Time) {
+	q.mutex.Lock()
+	if it, ok := q.index[key]; ok && it.inFlight {
+		it.inFlight = false
+		it.due = due
+		heap.Push(&q.heap, it)
+		q.signal()
+		q.mutex.Unlock()
+		return
+	}
+	q.mutex.Unlock()
+	q.Schedule(key, due)
+}
+
+// Remove drops key from the queue.
+func (q *Queue) Remove(key string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	it, ok := q.index[key]
+	if !ok {
+		return
+	}
+	delete(q.index, key)
+	if !it.inFlight {
+		heap.Remove(&q.heap, it.pos)
+		q.signal()
+	}
+}
+
+// Peek returns the head of the queue without removing it.
+func (q *Queue) Peek() (key string, due time.Time, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.heap) == 0 {
+		return "", time.Time{}, false
+	}
+	it := q.heap[0]
+	return it.key, it.due, true
+}
+
+// PopDue removes the head if it is due at now and marks it in flight.
+func (q *Queue) PopDue(now time.Time) (key string, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.heap) == 0 || q.heap[0].due.After(now) {
+		return "", false
+	}
+	it := heap.Pop(&q.heap).(*queueItem)
+	it.inFlight = true
+	return it.key, true
+}
+
+// Len returns the number of entries, including in-flight ones.
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.index)
+}
+
+// Entries lists all entries, in-flight first, then by due time.
+func (q *Queue) Entries() []QueueEntry {
+	q.mutex.Lock()
+	entries := make([]QueueEntry, 0, len(q.index))
+	for _, it := range q.index {
+		entries = append(entries, QueueEntry{Key: it.key, Due: it.due, InFlight: it.inFlight})
+	}
+	q.mutex.Unlock()
+
+	slices.SortFunc(entries, func(a, b QueueEntry) int {
+		if a.InFlight != b.InFlight {
+			if a.InFlight {
+				return -1
+			}
+			return 1
+		}
+		return a.Due.Compare(b.Due)
+	})
+	return entries
+}
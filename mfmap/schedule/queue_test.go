@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueOrder(t *testing.T) {
+	q := NewQueue()
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.Schedule("/b", t0.Add(2*time.Minute))
+	q.Schedule("/a", t0.Add(1*time.Minute))
+	q.Schedule("/c", t0.Add(3*time.Minute))
+
+	if key, due, ok := q.Peek(); !ok || key != "/a" || !due.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("Peek() = %s %v %v, want /a", key, due, ok)
+	}
+	if _, ok := q.PopDue(t0); ok {
+		t.Error("PopDue() returned an entry before it is due")
+	}
+	// moving an entry re-prioritizes it
+	q.Schedule("/c", t0)
+	if key, ok := q.PopDue(t0); !ok || key != "/c" {
+		t.Errorf("PopDue() = %s %v, want /c", key, ok)
+	}
+	var got []string
+	for {
+		key, ok := q.PopDue(t0.Add(time.Hour))
+		if !ok {
+			break
+		}
+		got = append(got, key)
+	}
+	if len(got) != 2 || got[0] != "/a" || got[1] != "/b" {
+		t.Errorf("pop order = %v, want [/a /b]", got)
+	}
+	if q.Len() != 3 {
+		t.Errorf("Len() = %d, want 3 including in-flight entries", q.Len())
+	}
+}
+
+func TestQueueInFlight(t *testing.T) {
+	q := NewQueue()
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.Schedule("/a", t0)
+	if key, ok := q.PopDue(t0); !ok || key != "/a" {
+		t.Fatalf("PopDue() = %s %v, want /a", key, ok)
+	}
+	// in-flight entries are not dispatched twice
+	q.Schedule("/a", t0)
+	if _, ok := q.PopDue(t0); ok {
+		t.Error("in-flight entry was rescheduled")
+	}
+	entries := q.Entries()
+	if len(entries) != 1 || !entries[0].InFlight {
+		t.Errorf("Entries() = %+v, want /a in flight", entries)
+	}
+	q.Complete("/a", t0.Add(time.Hour))
+	if key, due, ok := q.Peek(); !ok || key != "/a" || !due.Equal(t0.Add(time.Hour)) {
+		t.Errorf("after Complete(), Peek() = %s %v %v", key, due, ok)
+	}
+	q.Remove("/a")
+	if _, _, ok := q.Peek(); ok || q.Len() != 0 {
+		t.Error("Remove() left an entry")
+	}
+}
+
+func TestQueueWake(t *testing.T) {
+	q := NewQueue()
+	select {
+	case <-q.Wake():
+		t.Fatal("wake signal on empty queue")
+	default:
+	}
+	q.Schedule("/a", time.Now())
+	q.Schedule("/b", time.Now()) // pending signals coalesce
+	select {
+	case <-q.Wake():
+	default:
+		t.Fatal("no wake signal after Schedule()")
+	}
+	select {
+	case <-q.Wake():
+		t.Fatal("wake signals must not pile up")
+	default:
+	}
+}
+
+func TestOnHot(t *testing.T) {
+	s := Stats{Rates: testRates}
+	s.Rates.HotVisitors = 2
+	fired := 0
+	s.OnHot(func() { fired++ })
+
+	now := time.Now()
+	s.markHitAt("192.0.2.1", now)
+	if fired != 0 {
+		t.Fatal("OnHot fired below the visitors threshold")
+	}
+	s.markHitAt("192.0.2.2", now)
+	s.markHitAt("192.0.2.3", now)
+	if fired != 1 {
+		t.Errorf("OnHot fired %d times, want 1", fired)
+	}
+}
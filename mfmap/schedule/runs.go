@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	runHistory   = 8               // number of upstream runs remembered per map
+	runTolerance = 5 * time.Minute // update times closer than this belong to the same run
+	minRuns      = 3               // runs needed before trusting the cadence
+)
+
+// runLog remembers the upstream publication times (update_time of
+// multiforecast features) observed on successive fetches of a map, and
+// infers the publication cadence from them.
+type runLog struct {
+	mutex sync.Mutex
+	times []time.Time // distinct runs, ascending
+}
+
+// observe records a run. Returns true if it was not already known.
+func (rl *runLog) observe(t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	for _, known := range rl.times {
+		if t.Sub(known).Abs() < runTolerance {
+			return false
+		}
+	}
+	rl.times = append(rl.times, t)
+	slices.SortFunc(rl.times, time.Time.Compare)
+	if len(rl.times) > runHistory {
+		rl.times = rl.times[len(rl.times)-runHistory:]
+	}
+	return true
+}
+
+func (rl *runLog) last() time.Time {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if len(rl.times) == 0 {
+		return time.Time{}
+	}
+	return rl.times[len(rl.times)-1]
+}
+
+// cadence returns the median interval between consecutive runs, or 0 when
+// too few runs were observed. The median ignores the occasional skipped run.
+func (rl *runLog) cadence() time.Duration {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if len(rl.times) < minRuns {
+		return 0
+	}
+	intervals := make([]time.Duration, 0, len(rl.times)-1)
+	for i := 1; i < len(rl.times); i++ {
+		intervals = append(intervals, rl.times[i].Sub(rl.times[i-1]))
+	}
+	slices.Sort(intervals)
+	return intervals[len(intervals)/2]
+}
+
+// mergeFrom adds runs known by other.
+func (rl *runLog) mergeFrom(other *runLog) {
+	if rl == other {
+		return
+	}
+	other.mutex.Lock()
+	times := slices.Clone(other.times)
+	other.mutex.Unlock()
+	for _, t := range times {
+		rl.observe(t)
+	}
+}
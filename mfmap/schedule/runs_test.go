@@ -0,0 +1,103 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunLog(t *testing.T) {
+	var rl runLog
+	t0 := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	if rl.cadence() != 0 || !rl.last().IsZero() {
+		t.Fatal("empty runLog must have no cadence nor last run")
+	}
+	rl.observe(t0)
+	rl.observe(t0.Add(6 * time.Hour))
+	if rl.observe(t0.Add(6*time.Hour + time.Minute)) {
+		t.Error("update times within tolerance must count as the same run")
+	}
+	if rl.cadence() != 0 {
+		t.Errorf("cadence() with 2 runs = %v, want 0 (unknown)", rl.cadence())
+	}
+	// out of order observations and a skipped run
+	rl.observe(t0.Add(18 * time.Hour))
+	rl.observe(t0.Add(12 * time.Hour))
+	rl.observe(t0.Add(30 * time.Hour))
+	if got := rl.cadence(); got != 6*time.Hour {
+		t.Errorf("cadence() = %v, want 6h", got)
+	}
+	if got := rl.last(); !got.Equal(t0.Add(30 * time.Hour)) {
+		t.Errorf("last() = %v, want %v", got, t0.Add(30*time.Hour))
+	}
+	for i := range 2 * runHistory {
+		rl.observe(t0.Add(time.Duration(40+i) * time.Hour))
+	}
+	if len(rl.times) != runHistory {
+		t.Errorf("runLog keeps %d runs, want %d", len(rl.times), runHistory)
+	}
+}
+
+func TestRunMerge(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	var old, fresh Stats
+	old.ObserveRun(t0)
+	old.ObserveRun(t0.Add(6 * time.Hour))
+	fresh.ObserveRun(t0.Add(12 * time.Hour))
+	fresh.CopyFrom(&old)
+	if got := fresh.RunCadence(); got != 6*time.Hour {
+		t.Errorf("RunCadence() after merge = %v, want 6h", got)
+	}
+	if got := fresh.ExpectedRun(); !got.Equal(t0.Add(18 * time.Hour)) {
+		t.Errorf("ExpectedRun() = %v, want %v", got, t0.Add(18*time.Hour))
+	}
+}
+
+func TestUpdateOnExpectedRun(t *testing.T) {
+	r := testRates
+	r.RunMargin = 10 * time.Minute
+	now := time.Now()
+	hotStats := func() *Stats {
+		s := &Stats{Rates: r}
+		s.markHitAt("192.0.2.1", now)
+		s.MarkUpdate()
+		return s
+	}
+	tests := map[string]struct {
+		nextRun time.Duration // from now
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		// next run in 3h: wait for it rather than polling every HotMaxAge
+		"wait next run": {3 * time.Hour, 3*time.Hour + 9*time.Minute, 3*time.Hour + 10*time.Minute},
+		// next run in 10h: never wait longer than ColdMaxAge
+		"capped": {10 * time.Hour, r.ColdMaxAge - time.Minute, r.ColdMaxAge},
+		// next run expected before the last update, and did not show up: poll
+		"late run": {-time.Hour, r.HotMaxAge - time.Minute, r.HotMaxAge},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := hotStats()
+			next := now.Add(tt.nextRun)
+			for i := 3; i > 0; i-- {
+				s.ObserveRun(next.Add(-time.Duration(i) * 6 * time.Hour))
+			}
+			d := s.DurationToUpdate()
+			if d < tt.wantMin || d > tt.wantMax {
+				t.Errorf("DurationToUpdate() = %v, want in [%v, %v]", d, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestMarkUnchanged(t *testing.T) {
+	s := Stats{Rates: testRates}
+	s.MarkUpdate()
+	s.lastUpdate.Store(time.Now().Add(-2 * testRates.ColdMaxAge))
+	if s.DurationToUpdate() > 0 {
+		t.Fatal("stale map must be due")
+	}
+	s.MarkUnchanged()
+	if d := s.DurationToUpdate(); d < testRates.ColdMaxAge-time.Minute {
+		t.Errorf("after MarkUnchanged(), DurationToUpdate() = %v, want about %v", d, testRates.ColdMaxAge)
+	}
+}
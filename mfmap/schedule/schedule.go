@@ -3,6 +3,8 @@ package schedule
 import (
 	"sync/atomic"
 	"time"
+
+	"gometeo/clock"
 )
 
 type UpdateRates struct {
@@ -10,36 +12,146 @@ type UpdateRates struct {
 	HotMaxAge      time.Duration // update freq for "hot" maps
 	ColdMaxAge     time.Duration // update rate for "cold" maps (default for maps never used)
 	FailureBackoff time.Duration // delay before retrying a map after a fetch failure
+	HotVisitors    int           // unique visitors within HotDuration to become "hot" (0 counts as 1)
+	HitDedup       time.Duration // repeated hits from a client within this window count once
+	RunMargin      time.Duration // delay after an expected upstream run before fetching it
+
+	// hotness of a map warms up its descendants: a map d levels below a hot
+	// ancestor gets PropagateFactor^d of the way from ColdMaxAge to HotMaxAge.
+	PropagateFactor float64 // in [0,1], 0 disables propagation
+	PropagateDepth  int     // max levels below a hot map
+
+	// while the upstream request budget runs low, maps that are not hot
+	// update every ColdMaxAge*BudgetStretch, without warmth from hot ancestors
+	BudgetStretch float64 // <= 1 disables the stretch
+}
+
+// Budget tells whether the upstream request budget is running low.
+// *budget.Budget implements it.
+type Budget interface {
+	Low() bool
 }
 
 type Stats struct {
 	Rates        UpdateRates
+	Clock        clock.Clock  // optional; nil is the system clock
+	Budget       Budget       // optional; nil is never low
 	lastUpdate   atomic.Value // wraps a time.Time
 	lastHit      atomic.Value // wraps a time.Time
 	lastFailure  atomic.Value // wraps a time.Time
+	lastCheck    atomic.Value // wraps a time.Time
 	lastClientIP atomic.Value // wraps a string
-	hitCount     atomic.Int64 // simple counter
+	hits         hitLog       // deduplicated hourly histogram and recent visitors
+	runs         runLog       // upstream publication times
+	onHot        atomic.Pointer[func()]
+	parent       atomic.Pointer[Stats] // stats of the parent map, for hotness propagation
+}
+
+func (s *Stats) now() time.Time {
+	return clock.Or(s.Clock).Now()
 }
 
 func (s *Stats) MarkUpdate() {
-	now := time.Now()
-	s.lastUpdate.Store(now)
+	s.lastUpdate.Store(s.now())
 	s.lastFailure.Store(time.Time{}) // clear any prior failure
 }
 
 func (s *Stats) MarkFailure() {
-	s.lastFailure.Store(time.Now())
+	s.lastFailure.Store(s.now())
 }
 
 func (s *Stats) LastFailure() time.Time {
 	return loadAsTime(&s.lastFailure)
 }
 
+// MarkUnchanged records that upstream was checked and has not published
+// a new run since the last update. Data is as fresh as a new fetch would be.
+func (s *Stats) MarkUnchanged() {
+	s.lastCheck.Store(s.now())
+	s.lastFailure.Store(time.Time{})
+}
+
+func (s *Stats) LastCheck() time.Time {
+	return loadAsTime(&s.lastCheck)
+}
+
+// ObserveRun records the upstream update time of fetched forecasts.
+func (s *Stats) ObserveRun(t time.Time) {
+	s.runs.observe(t)
+}
+
+// LastRun returns the latest upstream update time observed.
+func (s *Stats) LastRun() time.Time {
+	return s.runs.last()
+}
+
+// RunCadence returns the learned upstream publication interval, 0 if unknown.
+func (s *Stats) RunCadence() time.Duration {
+	return s.runs.cadence()
+}
+
+// ExpectedRun returns when upstream should publish the next run,
+// or zero time if the cadence is unknown.
+func (s *Stats) ExpectedRun() time.Time {
+	c := s.runs.cadence()
+	if c == 0 {
+		return time.Time{}
+	}
+	return s.runs.last().Add(c)
+}
+
+// MarkHit records a visit from clientIP. Callers are expected to drop bots
+// beforehand (see HitFilter); repeated hits are deduplicated here.
 func (s *Stats) MarkHit(clientIP string) {
-	now := time.Now()
+	s.markHitAt(clientIP, s.now())
+}
+
+func (s *Stats) markHitAt(clientIP string, now time.Time) {
+	wasHot := s.IsHot()
 	s.lastHit.Store(now)
 	s.lastClientIP.Store(clientIP)
-	s.hitCount.Add(1)
+	s.hits.record(clientIP, now, s.Rates.HitDedup, s.retention())
+	if !wasHot && s.IsHot() {
+		if f := s.onHot.Load(); f != nil {
+			(*f)()
+		}
+	}
+}
+
+// OnHot registers f to be called when a hit turns the map hot,
+// so the scheduler can bring its next update forward.
+func (s *Stats) OnHot(f func()) {
+	s.onHot.Store(&f)
+}
+
+// SetParent links s to the stats of the parent map (nil for root maps).
+// Must be updated whenever the parent map is replaced.
+func (s *Stats) SetParent(p *Stats) {
+	s.parent.Store(p)
+}
+
+// Warmth returns the hotness inherited from the nearest hot ancestor:
+// PropagateFactor^d for an ancestor d levels up, 0 if none within PropagateDepth.
+func (s *Stats) Warmth() float64 {
+	f := s.Rates.PropagateFactor
+	if f <= 0 {
+		return 0
+	}
+	w := 1.0
+	p := s.parent.Load()
+	for d := 1; d <= s.Rates.PropagateDepth && p != nil; d++ {
+		w *= min(f, 1)
+		if p.IsHot() {
+			return w
+		}
+		p = p.parent.Load()
+	}
+	return 0
+}
+
+// retention is how long a client is remembered for unique visitors counting
+func (s *Stats) retention() time.Duration {
+	return max(s.Rates.HotDuration, s.Rates.HitDedup)
 }
 
 func (s *Stats) LastHit() time.Time {
@@ -68,29 +180,70 @@ func loadAsTime(a *atomic.Value) time.Time {
 	}
 }
 
+// HitCount returns the number of counted (deduplicated) visits over
+// the histogram span (7 days).
 func (s *Stats) HitCount() int64 {
-	return s.hitCount.Load()
+	var n int64
+	for _, c := range s.Histogram() {
+		n += int64(c)
+	}
+	return n
+}
+
+// Histogram returns counted visits per hour over the last 7 days, oldest first.
+func (s *Stats) Histogram() []int {
+	return s.hits.histogram(s.now())
 }
 
+// RecentVisitors returns the number of distinct clients seen within HotDuration.
+func (s *Stats) RecentVisitors() int {
+	return s.hits.uniqueSince(s.now().Add(-s.Rates.HotDuration))
+}
+
+// IsHot reports whether enough distinct visitors requested the map recently.
 func (s *Stats) IsHot() bool {
-	hitAge := time.Since(s.LastHit())
-	return hitAge < s.Rates.HotDuration
+	threshold := max(s.Rates.HotVisitors, 1)
+	return s.RecentVisitors() >= threshold
 }
 
+// DurationToUpdate returns the delay before the next update, negative if overdue.
+//
+// Hot maps whose upstream cadence is known wait for the next expected run
+// instead of polling every HotMaxAge, but never longer than ColdMaxAge.
+// Once the expected run is late, they poll again every HotMaxAge.
 func (s *Stats) DurationToUpdate() time.Duration {
-	hitAge := time.Since(s.LastHit())
-	updateAge := time.Since(s.LastUpdate())
+	now := s.now()
+	// data is as fresh as the last fetch or unchanged check
+	seen := s.LastUpdate()
+	if c := s.LastCheck(); c.After(seen) {
+		seen = c
+	}
+	age := now.Sub(seen)
 
 	var d time.Duration
-	if hitAge < s.Rates.HotDuration {
-		d = s.Rates.HotMaxAge - updateAge
+	if s.IsHot() {
+		d = s.Rates.HotMaxAge - age
+		if next := s.ExpectedRun(); !next.IsZero() {
+			due := next.Add(s.Rates.RunMargin)
+			if seen.Before(due) {
+				d = min(due.Sub(now), s.Rates.ColdMaxAge-age)
+			}
+		}
+	} else if s.budgetLow() {
+		// save the remaining upstream requests for hot maps
+		d = time.Duration(max(s.Rates.BudgetStretch, 1)*float64(s.Rates.ColdMaxAge)) - age
 	} else {
-		d = s.Rates.ColdMaxAge - updateAge
+		// warm maps, below a hot one, update in between hot and cold rates
+		maxAge := s.Rates.ColdMaxAge
+		if w := s.Warmth(); w > 0 {
+			maxAge -= time.Duration(w * float64(s.Rates.ColdMaxAge-s.Rates.HotMaxAge))
+		}
+		d = maxAge - age
 	}
 	// After a failure, hold off at least FailureBackoff before retrying,
 	// even if the regular schedule says the map is overdue.
 	if f := s.LastFailure(); !f.IsZero() {
-		backoff := s.Rates.FailureBackoff - time.Since(f)
+		backoff := s.Rates.FailureBackoff - now.Sub(f)
 		if backoff > d {
 			d = backoff
 		}
@@ -98,10 +251,20 @@ func (s *Stats) DurationToUpdate() time.Duration {
 	return d
 }
 
-// CopyFrom copies hit stats from another Stats instance.
+func (s *Stats) budgetLow() bool {
+	return s.Budget != nil && s.Budget.Low()
+}
+
+// NextDue returns the time at which the map should be updated.
+func (s *Stats) NextDue() time.Time {
+	return s.now().Add(s.DurationToUpdate())
+}
+
+// CopyFrom copies hit stats and known upstream runs from another Stats instance.
 // Used during map merges to preserve hit tracking.
 func (s *Stats) CopyFrom(other *Stats) {
 	s.lastHit.Store(other.LastHit())
 	s.lastClientIP.Store(other.LastClientIP())
-	s.hitCount.Store(other.HitCount())
+	s.hits.copyFrom(&other.hits)
+	s.runs.mergeFrom(&other.runs)
 }
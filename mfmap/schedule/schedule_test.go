@@ -1,6 +1,7 @@
 package schedule
 
 import (
+	"net/netip"
 	"sync"
 	"testing"
 	"time"
@@ -120,11 +121,13 @@ func TestNeedUpdate(t *testing.T) {
 			want:   false,
 		},
 	}
-	s := Stats{Rates: testRates}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
+			s := Stats{Rates: testRates}
 			s.lastUpdate.Store(test.update)
-			s.lastHit.Store(test.hit)
+			if !test.hit.IsZero() {
+				s.markHitAt("192.0.2.1", test.hit)
+			}
 			got := s.DurationToUpdate() < 0
 			if got != test.want {
 				t.Errorf("DurationToUpdate()<0 got %v, want %v", got, test.want)
@@ -132,3 +135,172 @@ func TestNeedUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestHitDedup(t *testing.T) {
+	r := testRates
+	r.HitDedup = 30 * time.Minute
+	s := Stats{Rates: r}
+	now := time.Now()
+	s.markHitAt("192.0.2.1", now.Add(-50*time.Minute))
+	s.markHitAt("192.0.2.1", now.Add(-40*time.Minute)) // within window, dropped
+	s.markHitAt("192.0.2.1", now.Add(-10*time.Minute)) // 40 min after counted hit
+	s.markHitAt("192.0.2.2", now.Add(-9*time.Minute))
+	if got := s.HitCount(); got != 3 {
+		t.Errorf("HitCount() = %d, want 3", got)
+	}
+	if got := s.RecentVisitors(); got != 2 {
+		t.Errorf("RecentVisitors() = %d, want 2", got)
+	}
+}
+
+func TestHotVisitorsThreshold(t *testing.T) {
+	r := testRates
+	r.HotVisitors = 3
+	s := Stats{Rates: r}
+	now := time.Now()
+	for range 10 {
+		s.markHitAt("192.0.2.1", now) // same client hammering
+	}
+	s.markHitAt("192.0.2.2", now)
+	if s.IsHot() {
+		t.Error("2 unique visitors must not reach a threshold of 3")
+	}
+	s.markHitAt("192.0.2.3", now)
+	if !s.IsHot() {
+		t.Error("3 unique visitors must reach a threshold of 3")
+	}
+
+	// visitors older than HotDuration are not recent anymore
+	old := Stats{Rates: r}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		old.markHitAt(ip, now.Add(-r.HotDuration-time.Minute))
+	}
+	if old.IsHot() {
+		t.Error("visitors older than HotDuration must not make a map hot")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	s := Stats{Rates: testRates}
+	now := time.Now()
+	s.markHitAt("a", now)
+	s.markHitAt("b", now.Add(-2*time.Hour))
+	s.markHitAt("c", now.Add(-2*time.Hour))
+	s.markHitAt("d", now.Add(-8*24*time.Hour)) // older than histogram span
+
+	h := s.Histogram()
+	if len(h) != histogramSize {
+		t.Fatalf("len(Histogram()) = %d, want %d", len(h), histogramSize)
+	}
+	if h[histogramSize-1] != 1 || h[histogramSize-3] != 2 {
+		t.Errorf("unexpected histogram tail %v", h[histogramSize-4:])
+	}
+	if got := s.HitCount(); got != 3 {
+		t.Errorf("HitCount() = %d, want 3 (hits older than 7 days are dropped)", got)
+	}
+}
+
+func TestHitFilter(t *testing.T) {
+	monitors, _ := netip.ParsePrefix("198.51.100.0/24")
+	hf, err := NewHitFilter(DefaultBotPattern, []netip.Prefix{monitors})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:133.0) Gecko/20100101 Firefox/133.0"
+	tests := []struct {
+		ip, ua string
+		want   bool
+	}{
+		{"192.0.2.1", firefox, true},
+		{"192.0.2.1", "", false},
+		{"192.0.2.1", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", false},
+		{"192.0.2.1", "Uptime-Kuma/1.23.0", false},
+		{"192.0.2.1", "curl/8.5.0", false},
+		{"198.51.100.7", firefox, false},
+		{"::ffff:198.51.100.7", firefox, false},
+	}
+	for _, test := range tests {
+		if got := hf.Accept(test.ip, test.ua); got != test.want {
+			t.Errorf("Accept(%s, %q) = %v, want %v", test.ip, test.ua, got, test.want)
+		}
+	}
+	var nilFilter *HitFilter
+	if !nilFilter.Accept("192.0.2.1", "") {
+		t.Error("nil HitFilter must accept every hit")
+	}
+}
+
+func TestWarmth(t *testing.T) {
+	r := testRates
+	r.HotVisitors = 1
+	r.PropagateFactor = 0.5
+	r.PropagateDepth = 2
+	root, child, grandChild, tooDeep := &Stats{Rates: r}, &Stats{Rates: r}, &Stats{Rates: r}, &Stats{Rates: r}
+	child.SetParent(root)
+	grandChild.SetParent(child)
+	tooDeep.SetParent(grandChild)
+
+	if w := grandChild.Warmth(); w != 0 {
+		t.Fatalf("Warmth() below a cold map = %v, want 0", w)
+	}
+	root.MarkHit("192.0.2.1")
+	root.MarkUpdate()
+	for _, s := range []*Stats{child, grandChild, tooDeep} {
+		s.MarkUpdate()
+	}
+	tests := []struct {
+		name string
+		s    *Stats
+		want float64
+		age  time.Duration // refresh delay from last update
+	}{
+		{"child", child, 0.5, r.ColdMaxAge - (r.ColdMaxAge-r.HotMaxAge)/2},
+		{"grandchild", grandChild, 0.25, r.ColdMaxAge - (r.ColdMaxAge-r.HotMaxAge)/4},
+		{"beyond depth", tooDeep, 0, r.ColdMaxAge},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Warmth(); got != tt.want {
+			t.Errorf("%s Warmth() = %v, want %v", tt.name, got, tt.want)
+		}
+		if d := tt.s.DurationToUpdate(); d > tt.age || d < tt.age-time.Minute {
+			t.Errorf("%s DurationToUpdate() = %v, want about %v", tt.name, d, tt.age)
+		}
+	}
+}
+
+type fakeBudget bool
+
+func (b fakeBudget) Low() bool { return bool(b) }
+
+func TestBudgetStretch(t *testing.T) {
+	r := testRates
+	r.HotVisitors = 1
+	r.PropagateFactor = 0.5
+	r.PropagateDepth = 1
+	r.BudgetStretch = 3
+	warm := r.ColdMaxAge - (r.ColdMaxAge-r.HotMaxAge)/2
+	tests := []struct {
+		name   string
+		budget Budget
+		hot    bool
+		want   time.Duration // refresh delay from last update
+	}{
+		{"no budget", nil, false, warm},
+		{"budget ok", fakeBudget(false), false, warm},
+		{"budget low", fakeBudget(true), false, 3 * r.ColdMaxAge},
+		{"budget low, hot map", fakeBudget(true), true, r.HotMaxAge},
+	}
+	for _, tt := range tests {
+		parent := &Stats{Rates: r}
+		parent.MarkHit("192.0.2.1")
+		s := &Stats{Rates: r, Budget: tt.budget}
+		s.SetParent(parent)
+		if tt.hot {
+			s.MarkHit("192.0.2.2")
+		}
+		s.MarkUpdate()
+		if d := s.DurationToUpdate(); d > tt.want || d < tt.want-time.Minute {
+			t.Errorf("%s: DurationToUpdate() = %v, want about %v", tt.name, d, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package scope selects which maps are crawled and linked.
+//
+// Rules are matched against the path, IdTechnique and taxonomy of a zone.
+// They are written as "[field:]pattern" where field is one of "path"
+// (default), "id" or "taxonomy", and pattern is a glob, or a regular
+// expression when prefixed with '~'. Matching is case-insensitive.
+//
+//	path:auvergne-rhone-alpes    one region
+//	taxonomy:DEPARTEMENT         all departments (of crawled regions)
+//	id:~^DEPT(15|43)$            two departments
+//
+// Rules are applied to subzones of a crawled map, never to the crawl root.
+// A zone matching an include rule keeps its whole subtree: a zone below it
+// is included through its ancestors, exclude rules still apply. Since
+// subzones are only reached through their parent, including a region keeps
+// the departments of that region only.
+//
+// Rules files hold one rule per line, prefixed with '+' to include or '-'
+// to exclude zones. Blank lines and lines starting with '#' are skipped:
+//
+//	# Auvergne-Rhône-Alpes only, without Ain and Allier
+//	+auvergne-rhone-alpes
+//	-id:~^DEPT0[13]$
+package scope
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Zone identifies a map candidate for crawling.
+type Zone struct {
+	Path     string // as published, e.g. "cantal" or "meteo-montagne/chablais"
+	Id       string // IdTechnique, e.g. "DEPT15"
+	Taxonomy string // PAYS, REGION, DEPARTEMENT...
+}
+
+type rule struct {
+	field string
+	glob  string         // lowercased
+	re    *regexp.Regexp // nil for globs
+	raw   string
+}
+
+func (r rule) match(z Zone) bool {
+	var v string
+	switch r.field {
+	case "id":
+		v = z.Id
+	case "taxonomy":
+		v = z.Taxonomy
+	default:
+		v = z.Path
+	}
+	if r.re != nil {
+		return r.re.MatchString(v)
+	}
+	ok, _ := path.Match(r.glob, strings.ToLower(v))
+	return ok
+}
+
+// Scope holds include and exclude rules. A nil *Scope allows every zone.
+// Immutable once parsed, safe for concurrent use.
+type Scope struct {
+	include []rule
+	exclude []rule
+}
+
+// Parse builds a Scope from comma-separated include and exclude rules.
+// Returns nil when both are empty.
+func Parse(include, exclude string) (*Scope, error) {
+	inc, err := parseRules(include)
+	if err != nil {
+		return nil, fmt.Errorf("include rules: %w", err)
+	}
+	exc, err := parseRules(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude rules: %w", err)
+	}
+	if len(inc) == 0 && len(exc) == 0 {
+		return nil, nil
+	}
+	return &Scope{include: inc, exclude: exc}, nil
+}
+
+// ParseFile builds a Scope from the rules file name, added to
+// comma-separated include and exclude rules as given to Parse. Rules of
+// the file may hold commas, e.g. in regexp repetitions. An empty name is
+// just Parse.
+func ParseFile(name, include, exclude string) (*Scope, error) {
+	sc, err := Parse(include, exclude)
+	if err != nil || name == "" {
+		return sc, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if sc == nil {
+		sc = &Scope{}
+	}
+	sca := bufio.NewScanner(f)
+	for n := 1; sca.Scan(); n++ {
+		line := strings.TrimSpace(sca.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules := &sc.include
+		switch line[0] {
+		case '+':
+		case '-':
+			rules = &sc.exclude
+		default:
+			return nil, fmt.Errorf("%s:%d: rule '%s' must start with '+' or '-'", name, n, line)
+		}
+		r, err := parseRule(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		*rules = append(*rules, r)
+	}
+	if err = sca.Err(); err != nil {
+		return nil, err
+	}
+	if len(sc.include) == 0 && len(sc.exclude) == 0 {
+		return nil, nil
+	}
+	return sc, nil
+}
+
+func parseRules(s string) ([]rule, error) {
+	var rules []rule
+	for _, raw := range strings.Split(s, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		r, err := parseRule(raw)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func parseRule(raw string) (rule, error) {
+	r := rule{field: "path", raw: raw}
+	pattern := raw
+	if f, p, ok := strings.Cut(raw, ":"); ok {
+		switch strings.ToLower(f) {
+		case "path", "id":
+			r.field = strings.ToLower(f)
+		case "taxonomy", "taxo":
+			r.field = "taxonomy"
+		default:
+			return r, fmt.Errorf("unknown field '%s' in rule '%s', want path, id or taxonomy", f, raw)
+		}
+		pattern = p
+	}
+	if re, ok := strings.CutPrefix(pattern, "~"); ok {
+		var err error
+		if r.re, err = regexp.Compile("(?i)" + re); err != nil {
+			return r, fmt.Errorf("rule '%s': %w", raw, err)
+		}
+	} else {
+		r.glob = strings.ToLower(pattern)
+		if _, err := path.Match(r.glob, ""); err != nil {
+			return r, fmt.Errorf("rule '%s': %w", raw, err)
+		}
+	}
+	return r, nil
+}
+
+// Allows reports whether zone z is in scope, below ancestors (from the
+// crawl root down to the parent of z): z matches no exclude rule, and if
+// there are include rules, z or one of its ancestors matches one.
+func (sc *Scope) Allows(ancestors []Zone, z Zone) bool {
+	if sc == nil {
+		return true
+	}
+	for _, r := range sc.exclude {
+		if r.match(z) {
+			return false
+		}
+	}
+	if len(sc.include) == 0 || sc.includes(z) {
+		return true
+	}
+	for _, a := range ancestors {
+		if sc.includes(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *Scope) includes(z Zone) bool {
+	for _, r := range sc.include {
+		if r.match(z) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *Scope) String() string {
+	if sc == nil {
+		return "all"
+	}
+	raws := func(rules []rule) string {
+		s := make([]string, len(rules))
+		for i, r := range rules {
+			s[i] = r.raw
+		}
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprintf("include=[%s] exclude=[%s]", raws(sc.include), raws(sc.exclude))
+}
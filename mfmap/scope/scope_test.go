@@ -0,0 +1,153 @@
+package scope
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	france   = Zone{Path: "france", Id: "PAYS007", Taxonomy: "PAYS"}
+	ara      = Zone{Path: "auvergne-rhone-alpes", Id: "REGIN84", Taxonomy: "REGION"}
+	bretagne = Zone{Path: "bretagne", Id: "REGIN53", Taxonomy: "REGION"}
+	cantal   = Zone{Path: "cantal", Id: "DEPT15", Taxonomy: "DEPARTEMENT"}
+	ain      = Zone{Path: "ain", Id: "DEPT01", Taxonomy: "DEPARTEMENT"}
+)
+
+func TestAllows(t *testing.T) {
+	tests := map[string]struct {
+		include, exclude string
+		allowed          []Zone
+		denied           []Zone
+	}{
+		"no rules": {"", "", []Zone{france, ara, cantal}, nil},
+		"one region and departments": {
+			"path:auvergne-rhone-alpes, taxonomy:departement", "",
+			[]Zone{ara, cantal, ain}, []Zone{bretagne},
+		},
+		"glob":        {"auvergne*", "", []Zone{ara}, []Zone{bretagne, cantal}},
+		"regex on id": {"id:~^DEPT(15|43)$", "", []Zone{cantal}, []Zone{ain, ara}},
+		"exclude wins": {
+			"taxo:DEPARTEMENT", "cantal",
+			[]Zone{ain}, []Zone{cantal, ara},
+		},
+		"exclude only": {"", "taxonomy:REGION", []Zone{cantal}, []Zone{ara, bretagne}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sc, err := Parse(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, z := range tt.allowed {
+				if !sc.Allows([]Zone{france}, z) {
+					t.Errorf("Allows(%s) = false, want true", z.Path)
+				}
+			}
+			for _, z := range tt.denied {
+				if sc.Allows([]Zone{france}, z) {
+					t.Errorf("Allows(%s) = true, want false", z.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowsSubtree(t *testing.T) {
+	finistere := Zone{Path: "finistere", Id: "DEPT29", Taxonomy: "DEPARTEMENT"}
+	massif := Zone{Path: "cantal-massif", Id: "MASSIF15", Taxonomy: "MASSIF"}
+	sc, err := Parse("auvergne-rhone-alpes", "ain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only ARA and its departments, in any order: the answer depends on
+	// the ancestors only
+	tests := []struct {
+		ancestors []Zone
+		z         Zone
+		want      bool
+	}{
+		{[]Zone{france, ara, cantal}, massif, true}, // deeper levels inherit the inclusion
+		{[]Zone{france, ara}, cantal, true},
+		{[]Zone{france}, ara, true},
+		{[]Zone{france}, bretagne, false},
+		{[]Zone{france, ara}, ain, false}, // exclude rules apply below an included zone
+		{[]Zone{france, bretagne}, finistere, false},
+		{[]Zone{cantal}, massif, false}, // ancestors above cantal unknown
+		{nil, cantal, false},
+	}
+	for _, tc := range tests {
+		if got := sc.Allows(tc.ancestors, tc.z); got != tc.want {
+			t.Errorf("Allows(%v, %s) = %v, want %v", tc.ancestors, tc.z.Path, got, tc.want)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	tests := map[string]struct {
+		file, include string
+		allowed       []Zone
+		denied        []Zone
+		fails         bool
+	}{
+		"rules and comments": {
+			file:    "# ARA only\n\n+auvergne-rhone-alpes\n -id:~^DEPT0{1,2}1$\n",
+			allowed: []Zone{ara},
+			denied:  []Zone{bretagne, ain},
+		},
+		"added to cli rules": {
+			file:    "-ain\n",
+			include: "taxonomy:DEPARTEMENT",
+			allowed: []Zone{cantal},
+			denied:  []Zone{ain, ara},
+		},
+		"comments only": {file: "# nothing\n"},
+		"no sign":       {file: "+bretagne\nauvergne*\n", fails: true},
+		"bad rule":      {file: "+region:bretagne\n", fails: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "scope.txt")
+			if err := os.WriteFile(file, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			sc, err := ParseFile(file, tt.include, "")
+			if tt.fails {
+				if err == nil {
+					t.Fatal("ParseFile(): expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.allowed)+len(tt.denied) == 0 && sc != nil {
+				t.Errorf("ParseFile() = %v, want nil", sc)
+			}
+			for _, z := range tt.allowed {
+				if !sc.Allows([]Zone{france}, z) {
+					t.Errorf("Allows(%s) = false, want true", z.Path)
+				}
+			}
+			for _, z := range tt.denied {
+				if sc.Allows([]Zone{france}, z) {
+					t.Errorf("Allows(%s) = true, want false", z.Path)
+				}
+			}
+		})
+	}
+	if _, err := ParseFile(filepath.Join(t.TempDir(), "missing"), "", ""); err == nil {
+		t.Error("ParseFile() of a missing file: expected error")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, inc := range []string{"region:bretagne", "id:~(", "path:[a-"} {
+		if _, err := Parse(inc, ""); err == nil {
+			t.Errorf("Parse(%q): expected error", inc)
+		}
+	}
+	if sc, err := Parse(" , ", ""); sc != nil || err != nil {
+		t.Errorf("Parse of empty rules = %v, %v, want nil, nil", sc, err)
+	}
+}
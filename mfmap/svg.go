@@ -9,7 +9,8 @@ import (
 	svt "gometeo/svgtools"
 )
 
-// CropRatio is the SVG viewport crop ratio applied to upstream maps.
+// CropRatio is the SVG viewport crop ratio applied to upstream maps
+// without geography, see CropBounds.
 var CropRatio = svt.CropRatio{
 	Left:   0.20,
 	Right:  0.08,
@@ -17,6 +18,8 @@ var CropRatio = svt.CropRatio{
 	Bottom: 0.08,
 }
 
+// ParseSvgMap crops the upstream svg map to CropBounds, which needs
+// geography and page data parsed first, and optimizes it with m.Conf.Svg.
 func (m *MfMap) ParseSvgMap(r io.Reader) error {
 	xml, err := io.ReadAll(r)
 	if err != nil {
@@ -31,13 +34,19 @@ func (m *MfMap) ParseSvgMap(r io.Reader) error {
 	if err != nil {
 		return fmt.Errorf("could not get svg size: %w", err)
 	}
-	if err = tree.SetSize(szOrig.Crop(CropRatio)); err != nil {
+	szCrop := szOrig.Crop(m.CropBounds())
+	if err = tree.SetSize(szCrop); err != nil {
 		return fmt.Errorf("could not set svg size: %w", err)
 	}
+	removed := 0
+	if m.Conf.Svg != nil {
+		removed = tree.Optimize(*m.Conf.Svg)
+	}
 	buf, err := doc.WriteToBytes()
 	if err != nil {
 		return fmt.Errorf("xml serialization error: %w", err)
 	}
-	m.SvgMap = buf
+	m.SvgMap, m.SvgCrop = buf, szOrig.Ratio(szCrop.Viewbox)
+	m.SvgReport = svt.OptimizeReport{Before: len(xml), After: len(buf), Removed: removed}
 	return nil
 }
@@ -2,7 +2,10 @@ package mfmap
 
 import (
 	"os"
+	"strings"
 	"testing"
+
+	"gometeo/svgtools"
 )
 
 func TestParseSvg(t *testing.T) {
@@ -20,3 +23,36 @@ func TestParseSvg(t *testing.T) {
 		t.Fatal("ParseSvgMap() produced empty output")
 	}
 }
+
+func TestParseSvgOptimize(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="100px" height="100px" viewBox="0 0 100 100">
+  <!-- exported -->
+  <path d="M10.123 50.456L60.789 50.012"/>
+</svg>`
+	tests := []struct {
+		name string
+		conf *svgtools.OptimizeConf
+		want string
+	}{
+		{"cropped only", nil, `<path d="M10.123 50.456L60.789 50.012"/>`},
+		{"optimized", &svgtools.OptimizeConf{Precision: 1}, `<path d="M10.1 50.5L60.8 50"/></svg>`},
+	}
+	sizes := make([]int, len(tests))
+	for i, tc := range tests {
+		m := MfMap{Conf: MapConf{Svg: tc.conf}}
+		if err := m.ParseSvgMap(strings.NewReader(src)); err != nil {
+			t.Fatalf("%s: ParseSvgMap() error: %s", tc.name, err)
+		}
+		if !strings.Contains(string(m.SvgMap), tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.name, m.SvgMap, tc.want)
+		}
+		r := m.SvgReport
+		if r.Before != len(src) || r.After != len(m.SvgMap) {
+			t.Errorf("%s: report %+v, want %d bytes before and %d after", tc.name, r, len(src), len(m.SvgMap))
+		}
+		sizes[i] = r.After
+	}
+	if sizes[1] >= sizes[0] {
+		t.Errorf("optimized map is %d bytes, cropped only %d", sizes[1], sizes[0])
+	}
+}
@@ -6,30 +6,49 @@ import (
 	"strings"
 
 	"gometeo/mfmap"
+	"gometeo/rewrite"
 )
 
 const ApiMultiforecast = "/multiforecast"
 
 // ApiUrl builds an API URL from MapData.Tools.Config
 // typically: https://rpcache-aa.meteofrance.com/internet2018client/2.0/path
-func ApiUrl(data *mfmap.MapData, path string, query *url.Values) (*url.URL, error) {
+// hosts.ApiBase replaces the scraped scheme, host and base path, then
+// hosts rules are applied, e.g. to reach a mirror or a local fake upstream.
+func ApiUrl(hosts rewrite.Hosts, data *mfmap.MapData, path string, query *url.Values) (*url.URL, error) {
 	conf := data.Tools.Config
 	var querystring string
 	if query != nil {
 		querystring = "?" + query.Encode()
 	}
-	raw := fmt.Sprintf("https://%s.%s%s%s",
-		conf.Site,
-		conf.BaseUrl,
-		path,
-		querystring)
-	return url.Parse(raw)
+	base := strings.TrimSuffix(hosts.ApiBase, "/")
+	if base == "" {
+		base = fmt.Sprintf("https://%s.%s", conf.Site, conf.BaseUrl)
+	}
+	u, err := url.Parse(base + path + querystring)
+	if err != nil {
+		return nil, err
+	}
+	return hosts.Rewrite(u), nil
 }
 
 // ForecastUrl builds the multiforecast endpoint URL from MapData
-func ForecastUrl(data *mfmap.MapData) (*url.URL, error) {
-	ids := make([]string, len(data.Children))
-	for i, poi := range data.Children {
+func ForecastUrl(hosts rewrite.Hosts, data *mfmap.MapData) (*url.URL, error) {
+	return forecastUrl(hosts, data, data.Children)
+}
+
+// ForecastProbeUrl builds a multiforecast URL for the first POI only,
+// a cheap request telling which upstream run the map data comes from.
+func ForecastProbeUrl(hosts rewrite.Hosts, data *mfmap.MapData) (*url.URL, error) {
+	if len(data.Children) == 0 {
+		return nil, fmt.Errorf("no POI to probe on map '%s'", data.Info.Name)
+	}
+	return forecastUrl(hosts, data, data.Children[:1])
+}
+
+func forecastUrl(hosts rewrite.Hosts, data *mfmap.MapData, pois []mfmap.Poi) (*url.URL, error) {
+	ids := make([]string, len(pois))
+	for i, poi := range pois {
 		ids[i] = poi.Insee
 	}
 	query := make(url.Values)
@@ -40,7 +59,7 @@ func ForecastUrl(data *mfmap.MapData) (*url.URL, error) {
 	query.Add("instants", "morning,afternoon,evening,night")
 	query.Add("liste_id", strings.Join(ids, ","))
 
-	return ApiUrl(data, ApiMultiforecast, &query)
+	return ApiUrl(hosts, data, ApiMultiforecast, &query)
 }
 
 // GeographyUrl builds the geography GeoJSON URL
@@ -9,6 +9,7 @@ import (
 
 	"gometeo/mfmap"
 	"gometeo/mfmap/urls"
+	"gometeo/rewrite"
 	"gometeo/testutils"
 )
 
@@ -89,7 +90,7 @@ func TestApiUrl(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			u, err := urls.ApiUrl(data, test.path, nil)
+			u, err := urls.ApiUrl(rewrite.Hosts{}, data, test.path, nil)
 			if err != nil {
 				t.Fatalf("ApiUrl() error: %s", err)
 			}
@@ -101,6 +102,40 @@ func TestApiUrl(t *testing.T) {
 	}
 }
 
+func TestApiBaseOverride(t *testing.T) {
+	data := &mfmap.MapData{Children: []mfmap.Poi{{Insee: "751010"}}}
+	data.Tools.Config = mfmap.MapConfig{Site: "rwg", BaseUrl: "meteofrance.com/internet2018client/2.0"}
+	rules, err := rewrite.ParseRules("https://rwg.meteofrance.com=http://localhost:1052")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		hosts rewrite.Hosts
+		want  string
+	}{
+		"scraped":  {rewrite.Hosts{}, apiBaseURL + urls.ApiMultiforecast},
+		"override": {rewrite.Hosts{ApiBase: "http://localhost:1052/api/"}, "http://localhost:1052/api" + urls.ApiMultiforecast},
+		"rule":     {rewrite.Hosts{Rules: rules}, "http://localhost:1052/internet2018client/2.0" + urls.ApiMultiforecast},
+		"override and rule": {
+			rewrite.Hosts{ApiBase: "https://staging.meteofrance.com/api", Rules: rules},
+			"https://staging.meteofrance.com/api" + urls.ApiMultiforecast,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			u, err := urls.ForecastProbeUrl(test.hosts, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.RawQuery = ""
+			if got := u.String(); got != test.want {
+				t.Errorf("ForecastProbeUrl()='%s' want '%s'", got, test.want)
+			}
+		})
+	}
+}
+
 func TestForecastUrl(t *testing.T) {
 	data := parseHtml(t)
 
@@ -113,7 +148,7 @@ func TestForecastUrl(t *testing.T) {
 		"liste_id":   coordsRegexp,
 	}
 
-	u, err := urls.ForecastUrl(data)
+	u, err := urls.ForecastUrl(rewrite.Hosts{}, data)
 	if err != nil {
 		t.Fatalf("ForecastUrl() error: %s", err)
 	}
@@ -0,0 +1,126 @@
+package mfmap
+
+import (
+	"fmt"
+	"strings"
+
+	gj "gometeo/geojson"
+)
+
+// metropolePrefix is the upstream path prefix of metropolitan and overseas
+// department maps
+const metropolePrefix = "/previsions-meteo-france/"
+
+// ZoneKind is a family of upstream maps served in addition to metropolitan
+// France. Each family is crawled from its own roots, and is switched on
+// individually (see appconf -zones).
+type ZoneKind struct {
+	Name     string   // switch name
+	Roots    []string // upstream paths the crawl starts from
+	Prefix   string   // upstream path prefix of maps in the family, "" for plain departments
+	Overview bool     // roots are overview maps, rendered like France
+	Subzones string   // taxonomy of subzones, matched by scope rules
+}
+
+// ZoneKinds lists supported families. Overseas departments are plain
+// DEPARTEMENT maps under the metropolitan prefix, without subzones.
+var ZoneKinds = []ZoneKind{
+	{
+		Name: "outremer",
+		Roots: []string{
+			metropolePrefix + "guadeloupe/971",
+			metropolePrefix + "martinique/972",
+			metropolePrefix + "guyane/973",
+			metropolePrefix + "la-reunion/974",
+			metropolePrefix + "mayotte/976",
+		},
+	},
+	{
+		Name:     "montagne",
+		Roots:    []string{"/meteo-montagne"},
+		Prefix:   "/meteo-montagne/",
+		Overview: true,
+		Subzones: "MASSIF",
+	},
+	{
+		Name:     "marine",
+		Roots:    []string{"/meteo-marine"},
+		Prefix:   "/meteo-marine/",
+		Overview: true,
+		Subzones: "COTE",
+	},
+}
+
+// ParseZoneKinds returns the families named in a comma-separated list.
+func ParseZoneKinds(s string) ([]ZoneKind, error) {
+	var kinds []ZoneKind
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, k := range ZoneKinds {
+			if k.Name == name {
+				kinds = append(kinds, k)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown zone '%s', want one of %s", name, zoneKindNames())
+		}
+	}
+	return kinds, nil
+}
+
+func zoneKindNames() string {
+	names := make([]string, len(ZoneKinds))
+	for i, k := range ZoneKinds {
+		names[i] = k.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// familyOf returns the non-metropolitan family upstream path p belongs to,
+// or nil for metropolitan maps.
+func familyOf(p string) *ZoneKind {
+	for i, k := range ZoneKinds {
+		if k.Prefix == "" {
+			continue
+		}
+		if strings.HasPrefix(p, k.Prefix) || p == strings.TrimSuffix(k.Prefix, "/") {
+			return &ZoneKinds[i]
+		}
+	}
+	return nil
+}
+
+// Bounds returns the bounds the geography of m lies within: those of its
+// overseas department, metropolitan France otherwise. The department code
+// is the last segment of upstream paths.
+func (m *MfMap) Bounds() gj.Bounds {
+	if m.Data == nil {
+		return gj.Metropole
+	}
+	p := strings.TrimSuffix(m.Data.Info.Path, "/")
+	return gj.BoundsOf(p[strings.LastIndex(p, "/")+1:])
+}
+
+// IsOverview reports whether m is an overview map (France, or the root of
+// an overview family), for which charts are not shown.
+func (m *MfMap) IsOverview() bool {
+	if m.Data == nil {
+		return false
+	}
+	if m.Data.Info.Taxonomy == "PAYS" {
+		return true
+	}
+	p := strings.TrimSuffix(m.Data.Info.Path, "/")
+	for _, k := range ZoneKinds {
+		if k.Overview && strings.TrimSuffix(k.Prefix, "/") == p {
+			return true
+		}
+	}
+	return false
+}
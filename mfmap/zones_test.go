@@ -0,0 +1,55 @@
+package mfmap_test
+
+import (
+	"strings"
+	"testing"
+
+	"gometeo/mfmap"
+)
+
+func TestParseZoneKinds(t *testing.T) {
+	kinds, err := mfmap.ParseZoneKinds("montagne, MARINE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kinds) != 2 || kinds[0].Name != "montagne" || kinds[1].Name != "marine" {
+		t.Errorf("ParseZoneKinds() = %v", kinds)
+	}
+	if kinds, err := mfmap.ParseZoneKinds(""); err != nil || len(kinds) != 0 {
+		t.Errorf("ParseZoneKinds(\"\") = %v, %v, want none", kinds, err)
+	}
+	if _, err := mfmap.ParseZoneKinds("atlantide"); err == nil {
+		t.Error("ParseZoneKinds(atlantide): expected error")
+	}
+}
+
+func TestFamilyMaps(t *testing.T) {
+	j := `{
+		"mf_map_layers_v2": {"name": "Montagne", "path": "/meteo-montagne", "taxonomy": "MONTAGNE", "field_id_technique": "MONTAGNE001"},
+		"mf_map_layers_v2_sub_zone": {
+			"MASSIF01": {"path": "/meteo-montagne/chablais/1", "name": "Chablais"},
+			"REGIN84":  {"path": "/previsions-meteo-france/auvergne-rhone-alpes/84", "name": "ARA"}
+		}
+	}`
+	data, err := mfmap.ParseData(strings.NewReader(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data.Subzones["MASSIF01"]; !ok || len(data.Subzones) != 1 {
+		t.Errorf("family map subzones = %v, want MASSIF01 only", data.Subzones)
+	}
+	root := &mfmap.MfMap{Data: data}
+	if got := root.Path(); got != "meteo-montagne" {
+		t.Errorf("root Path() = %s, want meteo-montagne", got)
+	}
+	if !root.IsOverview() {
+		t.Error("family root must be an overview map")
+	}
+	massif := &mfmap.MfMap{Data: &mfmap.MapData{Info: mfmap.MapInfo{Path: "/meteo-montagne/chablais/1"}}}
+	if got := massif.Path(); got != "meteo-montagne/chablais" {
+		t.Errorf("massif Path() = %s, want meteo-montagne/chablais", got)
+	}
+	if massif.IsOverview() {
+		t.Error("massif must not be an overview map")
+	}
+}
@@ -0,0 +1,73 @@
+// Package nullable holds numeric types keeping track of null or missing
+// JSON values, which plain float64/int fields silently turn into 0.
+//
+// Missing values are stored in-band (NaN, math.MinInt) so the types stay
+// plain float64/int underneath: gob snapshots encoded with float64/int
+// fields decode into them unchanged.
+package nullable
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// Float is a float64 where NaN stands for a missing value
+type Float float64
+
+// Int is an int where math.MinInt stands for a missing value
+type Int int
+
+// NullFloat and NullInt are the missing values
+var NullFloat = Float(math.NaN())
+
+const NullInt Int = math.MinInt
+
+func (f Float) Valid() bool { return !math.IsNaN(float64(f)) }
+
+func (i Int) Valid() bool { return i != NullInt }
+
+// UnmarshalJSON reads a number or null. Fields absent from the json
+// object are left untouched, so callers initialize them to NullFloat.
+func (f *Float) UnmarshalJSON(b []byte) error {
+	var v *float64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v == nil {
+		*f = NullFloat
+		return nil
+	}
+	*f = Float(*v)
+	return nil
+}
+
+// MarshalJSON writes null for missing values
+func (f Float) MarshalJSON() ([]byte, error) {
+	if !f.Valid() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+// UnmarshalJSON reads an integer or null
+func (i *Int) UnmarshalJSON(b []byte) error {
+	var v *int
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v == nil {
+		*i = NullInt
+		return nil
+	}
+	*i = Int(*v)
+	return nil
+}
+
+// MarshalJSON writes null for missing values
+func (i Int) MarshalJSON() ([]byte, error) {
+	if !i.Valid() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Itoa(int(i))), nil
+}
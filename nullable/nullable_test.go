@@ -0,0 +1,92 @@
+package nullable
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	type item struct {
+		A Float `json:"a"`
+		B Float `json:"b"`
+		C Int   `json:"c"`
+		D Int   `json:"d"`
+	}
+	j := []byte(`{"a": null, "b": 12.5, "c": null, "d": 0}`)
+	got := item{A: 1, C: 1}
+	if err := json.Unmarshal(j, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.A.Valid() || !got.B.Valid() || got.B != 12.5 {
+		t.Errorf("Float unmarshal got %v/%v, want null/12.5", got.A, got.B)
+	}
+	if got.C.Valid() || !got.D.Valid() || got.D != 0 {
+		t.Errorf("Int unmarshal got %v/%v, want null/0", got.C, got.D)
+	}
+	if err := json.Unmarshal([]byte(`{"c": 1.5}`), &got); err == nil {
+		t.Error("Int unmarshal of a decimal value: expected error")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{NullFloat, "null"},
+		{Float(0), "0"},
+		{Float(-3.25), "-3.25"},
+		{NullInt, "null"},
+		{Int(0), "0"},
+		{Int(1013), "1013"},
+	}
+	for _, tc := range tests {
+		b, err := json.Marshal(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("Marshal(%#v) got %s, want %s", tc.v, b, tc.want)
+		}
+	}
+}
+
+func TestGobCompat(t *testing.T) {
+	// snapshots encoded before nullable types existed
+	type oldItem struct {
+		T    float64
+		Uv   int
+		Zero int
+	}
+	type newItem struct {
+		T    Float
+		Uv   Int
+		Zero Int
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(oldItem{T: 12.5, Uv: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var got newItem
+	if err := gob.NewDecoder(&b).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (newItem{T: 12.5, Uv: 3}) {
+		t.Errorf("gob decode of old fields got %+v", got)
+	}
+
+	// missing values survive a round trip
+	b.Reset()
+	if err := gob.NewEncoder(&b).Encode(newItem{T: NullFloat, Uv: NullInt}); err != nil {
+		t.Fatal(err)
+	}
+	got = newItem{}
+	if err := gob.NewDecoder(&b).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.T.Valid() || got.Uv.Valid() {
+		t.Errorf("gob round trip lost null values, got %+v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package obs
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DataIssue counts data-quality issues of one kind on one POI of a map,
+// repaired at parse time (see geojson.Repair).
+type DataIssue struct {
+	Map    string
+	Poi    string
+	Kind   string
+	Detail string // detail of the last occurrence
+	Count  int64
+	Last   time.Time
+}
+
+type dataIssueKey struct {
+	mapPath, poi, kind string
+}
+
+// dataIssues is the table of data-quality issues, keyed by (map, poi, kind)
+// so that a recurring issue does not grow it. Writes happen on map parsing
+// only, a mutex is fine.
+type dataIssues struct {
+	mu    sync.Mutex
+	table map[dataIssueKey]*DataIssue
+	total int64
+}
+
+// RecordDataIssue records a data-quality issue found and repaired on POI poi
+// of map mapPath. Nil-safe.
+func (r *Registry) RecordDataIssue(mapPath, poi, kind, detail string) {
+	if r == nil {
+		return
+	}
+	now := r.clock.Now()
+	di := &r.dataIssues
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	if di.table == nil {
+		di.table = make(map[dataIssueKey]*DataIssue)
+	}
+	k := dataIssueKey{mapPath, poi, kind}
+	issue, ok := di.table[k]
+	if !ok {
+		issue = &DataIssue{Map: mapPath, Poi: poi, Kind: kind}
+		di.table[k] = issue
+	}
+	issue.Count++
+	issue.Detail = detail
+	issue.Last = now
+	di.total++
+}
+
+// snapshot returns a copy of the issues, most recent first, and their total.
+func (di *dataIssues) snapshot() ([]DataIssue, int64) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	out := make([]DataIssue, 0, len(di.table))
+	for _, issue := range di.table {
+		out = append(out, *issue)
+	}
+	slices.SortFunc(out, func(a, b DataIssue) int {
+		if c := b.Last.Compare(a.Last); c != 0 {
+			return c
+		}
+		if a.Map != b.Map {
+			return strings.Compare(a.Map, b.Map)
+		}
+		return strings.Compare(a.Poi, b.Poi)
+	})
+	return out, di.total
+}
@@ -60,6 +60,7 @@ const DefaultErrorRingSize = 10
 // Registry is the process-wide observability state. Construct one in the
 // server entry point and inject it into crawl/content via their conf structs.
 type Registry struct {
+	clock     Clock
 	startTime time.Time
 
 	upstreamRequests atomic.Int64
@@ -68,8 +69,24 @@ type Registry struct {
 	pictosFailed     atomic.Int64
 	pictosServed     atomic.Int64
 	staticServed     atomic.Int64
+	hitsIgnored      atomic.Int64
 
-	errors *errorRing
+	rateLimitedPages  atomic.Int64
+	rateLimitedData   atomic.Int64
+	rateLimitedStatic atomic.Int64
+	loadShed          atomic.Int64
+	probesUnchanged   atomic.Int64
+	probesChanged     atomic.Int64
+	mapsApiOnly       atomic.Int64
+	mapsScraped       atomic.Int64
+	refreshesPartial  atomic.Int64
+	refreshesRejected atomic.Int64
+	schemaChanges     atomic.Int64
+	upstreamDenied    atomic.Int64
+	budgetLows        atomic.Int64
+
+	errors     *errorRing
+	dataIssues dataIssues
 }
 
 // NewRegistry returns a Registry with startTime set to now and an error ring
@@ -78,10 +95,34 @@ func NewRegistry() *Registry {
 	return NewRegistryWithSize(DefaultErrorRingSize)
 }
 
+// Clock tells the current time. Same shape as gometeo/clock.Clock, declared
+// here so the Registry stays stdlib-only.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
 // NewRegistryWithSize builds a Registry with a custom ring capacity (tests).
 func NewRegistryWithSize(ringSize int) *Registry {
+	return newRegistry(systemClock{}, ringSize)
+}
+
+// NewRegistryWithClock builds a Registry timing uptime and errors on c,
+// nil is the system clock.
+func NewRegistryWithClock(c Clock) *Registry {
+	if c == nil {
+		c = systemClock{}
+	}
+	return newRegistry(c, DefaultErrorRingSize)
+}
+
+func newRegistry(c Clock, ringSize int) *Registry {
 	return &Registry{
-		startTime: time.Now(),
+		clock:     c,
+		startTime: c.Now(),
 		errors:    newErrorRing(ringSize),
 	}
 }
@@ -90,9 +131,11 @@ func NewRegistryWithSize(ringSize int) *Registry {
 type ErrorSource string
 
 const (
-	SourceMap   ErrorSource = "map"
-	SourcePicto ErrorSource = "picto"
-	SourceCrawl ErrorSource = "crawl"
+	SourceMap     ErrorSource = "map"
+	SourcePicto   ErrorSource = "picto"
+	SourceCrawl   ErrorSource = "crawl"
+	SourceRefresh ErrorSource = "refresh"
+	SourceSchema  ErrorSource = "schema"
 )
 
 // ErrorEvent is one entry in the recent-errors ring buffer.
@@ -106,15 +149,31 @@ type ErrorEvent struct {
 // Snapshot is a point-in-time view of the Registry state, safe to read
 // outside any lock. Meant to be consumed by status handlers or exporters.
 type Snapshot struct {
-	StartTime     time.Time
-	Uptime        time.Duration
-	UpstreamRequests int64
-	MapsFailed       int64
-	MapsServed       int64
-	PictosFailed     int64
-	PictosServed     int64
-	StaticServed     int64
-	RecentErrors     []ErrorEvent // newest first
+	StartTime         time.Time
+	Uptime            time.Duration
+	UpstreamRequests  int64
+	MapsFailed        int64
+	MapsServed        int64
+	PictosFailed      int64
+	PictosServed      int64
+	StaticServed      int64
+	HitsIgnored       int64
+	RateLimitedPages  int64
+	RateLimitedData   int64
+	RateLimitedStatic int64
+	LoadShed          int64
+	ProbesUnchanged   int64
+	ProbesChanged     int64
+	MapsApiOnly       int64
+	MapsScraped       int64
+	RefreshesPartial  int64
+	RefreshesRejected int64
+	SchemaChanges     int64
+	UpstreamDenied    int64        // upstream requests refused by the request budget
+	BudgetLows        int64        // times the request budget started running low
+	RecentErrors      []ErrorEvent // newest first
+	DataIssuesTotal   int64
+	DataIssues        []DataIssue // most recent first
 }
 
 // RecordUpstreamRequest is called each time an HTTP request is actually
@@ -133,7 +192,7 @@ func (r *Registry) RecordUpstreamRequest() {
 func (r *Registry) RecordMapFailed(path string, err error) {
 	r.mapsFailed.Add(1)
 	r.errors.push(ErrorEvent{
-		Time:   time.Now(),
+		Time:   r.clock.Now(),
 		Source: SourceMap,
 		Target: path,
 		Err:    errString(err),
@@ -167,10 +226,127 @@ func (r *Registry) RecordStaticServed() {
 	r.staticServed.Add(1)
 }
 
+// RecordHitIgnored is called when a map data request is not counted as a
+// visit (bot user agent or monitoring address). Nil-safe.
+func (r *Registry) RecordHitIgnored() {
+	if r == nil {
+		return
+	}
+	r.hitsIgnored.Add(1)
+}
+
+// RecordRateLimited is called when a request is rejected with 429 because
+// the client exhausted its budget for class ("page", "data" or "static").
+// Nil-safe.
+func (r *Registry) RecordRateLimited(class string) {
+	if r == nil {
+		return
+	}
+	switch class {
+	case "data":
+		r.rateLimitedData.Add(1)
+	case "static":
+		r.rateLimitedStatic.Add(1)
+	default:
+		r.rateLimitedPages.Add(1)
+	}
+}
+
+// RecordLoadShed is called when a request is rejected with 503 because
+// too many requests are in flight. Nil-safe.
+func (r *Registry) RecordLoadShed() {
+	if r == nil {
+		return
+	}
+	r.loadShed.Add(1)
+}
+
+// RecordProbe is called after a change probe, telling whether upstream
+// published a new run (a full crawl follows) or not (the crawl is skipped).
+// Nil-safe.
+func (r *Registry) RecordProbe(changed bool) {
+	if r == nil {
+		return
+	}
+	if changed {
+		r.probesChanged.Add(1)
+	} else {
+		r.probesUnchanged.Add(1)
+	}
+}
+
+// RecordMapFetch is called after a map is fetched, with forecasts only
+// (apiOnly) or with its page scraped again. Nil-safe.
+func (r *Registry) RecordMapFetch(apiOnly bool) {
+	if r == nil {
+		return
+	}
+	if apiOnly {
+		r.mapsApiOnly.Add(1)
+	} else {
+		r.mapsScraped.Add(1)
+	}
+}
+
+// RecordUpstreamDenied is called each time a request is not sent to
+// upstream because the request budget is spent. Nil-safe.
+func (r *Registry) RecordUpstreamDenied() {
+	if r == nil {
+		return
+	}
+	r.upstreamDenied.Add(1)
+}
+
+// RecordBudgetLow is called when the upstream request budget starts
+// running low. Nil-safe.
+func (r *Registry) RecordBudgetLow() {
+	if r == nil {
+		return
+	}
+	r.budgetLows.Add(1)
+}
+
+// RecordDegradedRefresh is called when a refreshed map is degraded compared
+// to the stored one, and was either partially merged (rejected false) or
+// dropped. The decision goes to the recent errors ring. Nil-safe.
+func (r *Registry) RecordDegradedRefresh(path string, rejected bool, reason string) {
+	if r == nil {
+		return
+	}
+	verdict := "partial"
+	if rejected {
+		verdict = "rejected"
+		r.refreshesRejected.Add(1)
+	} else {
+		r.refreshesPartial.Add(1)
+	}
+	r.errors.push(ErrorEvent{
+		Time:   r.clock.Now(),
+		Source: SourceRefresh,
+		Target: path,
+		Err:    verdict + ": " + reason,
+	})
+}
+
+// RecordSchemaChange is called the first time a field appears in, or
+// disappears from, the payloads of an upstream endpoint. Nil-safe.
+func (r *Registry) RecordSchemaChange(endpoint, field, change string) {
+	if r == nil {
+		return
+	}
+	r.schemaChanges.Add(1)
+	r.errors.push(ErrorEvent{
+		Time:   r.clock.Now(),
+		Source: SourceSchema,
+		Target: endpoint,
+		Err:    "field " + field + " " + change,
+	})
+}
+
 func (r *Registry) RecordPictoFailed(name string, err error) {
 	r.pictosFailed.Add(1)
 	r.errors.push(ErrorEvent{
-		Time:   time.Now(),
+		Time:   r.clock.Now(),
 		Source: SourcePicto,
 		Target: name,
 		Err:    errString(err),
@@ -181,7 +357,7 @@ func (r *Registry) RecordPictoFailed(name string, err error) {
 // expiration). Target may be empty.
 func (r *Registry) RecordCrawlError(target string, err error) {
 	r.errors.push(ErrorEvent{
-		Time:   time.Now(),
+		Time:   r.clock.Now(),
 		Source: SourceCrawl,
 		Target: target,
 		Err:    errString(err),
@@ -190,16 +366,33 @@ func (r *Registry) RecordCrawlError(target string, err error) {
 
 // Snapshot returns a consistent read of the registry state.
 func (r *Registry) Snapshot() Snapshot {
+	issues, issuesTotal := r.dataIssues.snapshot()
 	return Snapshot{
-		StartTime:        r.startTime,
-		Uptime:           time.Since(r.startTime),
-		UpstreamRequests: r.upstreamRequests.Load(),
-		MapsFailed:       r.mapsFailed.Load(),
-		MapsServed:       r.mapsServed.Load(),
-		PictosFailed:     r.pictosFailed.Load(),
-		PictosServed:     r.pictosServed.Load(),
-		StaticServed:     r.staticServed.Load(),
-		RecentErrors:     r.errors.snapshot(),
+		StartTime:         r.startTime,
+		Uptime:            r.clock.Now().Sub(r.startTime),
+		UpstreamRequests:  r.upstreamRequests.Load(),
+		MapsFailed:        r.mapsFailed.Load(),
+		MapsServed:        r.mapsServed.Load(),
+		PictosFailed:      r.pictosFailed.Load(),
+		PictosServed:      r.pictosServed.Load(),
+		StaticServed:      r.staticServed.Load(),
+		HitsIgnored:       r.hitsIgnored.Load(),
+		RateLimitedPages:  r.rateLimitedPages.Load(),
+		RateLimitedData:   r.rateLimitedData.Load(),
+		RateLimitedStatic: r.rateLimitedStatic.Load(),
+		LoadShed:          r.loadShed.Load(),
+		ProbesUnchanged:   r.probesUnchanged.Load(),
+		ProbesChanged:     r.probesChanged.Load(),
+		MapsApiOnly:       r.mapsApiOnly.Load(),
+		MapsScraped:       r.mapsScraped.Load(),
+		RefreshesPartial:  r.refreshesPartial.Load(),
+		RefreshesRejected: r.refreshesRejected.Load(),
+		SchemaChanges:     r.schemaChanges.Load(),
+		UpstreamDenied:    r.upstreamDenied.Load(),
+		BudgetLows:        r.budgetLows.Load(),
+		RecentErrors:      r.errors.snapshot(),
+		DataIssuesTotal:   issuesTotal,
+		DataIssues:        issues,
 	}
 }
 
@@ -215,8 +408,8 @@ func errString(err error) string {
 type errorRing struct {
 	mu   sync.Mutex
 	buf  []ErrorEvent
-	next int   // index of next write
-	full bool  // true once buf has been filled at least once
+	next int  // index of next write
+	full bool // true once buf has been filled at least once
 	size int
 }
 
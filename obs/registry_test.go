@@ -4,6 +4,9 @@ import (
 	"errors"
 	"sync"
 	"testing"
+	"time"
+
+	"gometeo/testutils"
 )
 
 func TestCountersRecord(t *testing.T) {
@@ -13,6 +16,8 @@ func TestCountersRecord(t *testing.T) {
 	r.RecordUpstreamRequest()
 	r.RecordMapFailed("/c", errors.New("boom"))
 	r.RecordPictoFailed("p2j", errors.New("nope"))
+	r.RecordUpstreamDenied()
+	r.RecordBudgetLow()
 
 	s := r.Snapshot()
 	if s.UpstreamRequests != 3 {
@@ -24,6 +29,9 @@ func TestCountersRecord(t *testing.T) {
 	if s.PictosFailed != 1 {
 		t.Errorf("PictosFailed = %d, want 1", s.PictosFailed)
 	}
+	if s.UpstreamDenied != 1 || s.BudgetLows != 1 {
+		t.Errorf("UpstreamDenied, BudgetLows = %d, %d, want 1, 1", s.UpstreamDenied, s.BudgetLows)
+	}
 	if s.Uptime <= 0 {
 		t.Errorf("Uptime = %v, want > 0", s.Uptime)
 	}
@@ -106,3 +114,46 @@ func TestConcurrentRecorders(t *testing.T) {
 		t.Errorf("RecentErrors len = %d, want 50", len(s.RecentErrors))
 	}
 }
+
+func TestRegistryClock(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	r := NewRegistryWithClock(clk)
+	clk.Advance(90 * time.Minute)
+	r.RecordMapFailed("/a", errors.New("e1"))
+
+	s := r.Snapshot()
+	if s.Uptime != 90*time.Minute {
+		t.Errorf("Uptime = %v, want 1h30m", s.Uptime)
+	}
+	if got := s.RecentErrors[0].Time; !got.Equal(clk.Now()) {
+		t.Errorf("error Time = %v, want %v", got, clk.Now())
+	}
+}
+
+func TestDataIssues(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	r := NewRegistryWithClock(clk)
+	r.RecordDataIssue("/a", "751010", "out-of-range", "forecast 1")
+	clk.Advance(time.Minute)
+	r.RecordDataIssue("/b", "130010", "missing-daily", "daily")
+	clk.Advance(time.Minute)
+	r.RecordDataIssue("/a", "751010", "out-of-range", "forecast 2")
+
+	var nilReg *Registry
+	nilReg.RecordDataIssue("/a", "751010", "duplicate", "") // must not panic
+
+	s := r.Snapshot()
+	if s.DataIssuesTotal != 3 {
+		t.Errorf("DataIssuesTotal = %d, want 3", s.DataIssuesTotal)
+	}
+	if len(s.DataIssues) != 2 {
+		t.Fatalf("DataIssues len = %d, want 2", len(s.DataIssues))
+	}
+	first := s.DataIssues[0]
+	if first.Map != "/a" || first.Count != 2 || first.Detail != "forecast 2" || !first.Last.Equal(clk.Now()) {
+		t.Errorf("DataIssues[0] = %+v, want /a, count 2, last detail and time", first)
+	}
+	if s.DataIssues[1].Map != "/b" {
+		t.Errorf("DataIssues[1].Map = %s, want /b", s.DataIssues[1].Map)
+	}
+}
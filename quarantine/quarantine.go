@@ -0,0 +1,211 @@
+// Package quarantine keeps upstream payloads that failed parsing, so that
+// problems can be reproduced later.
+//
+// Each entry is a raw body file and a JSON metadata file (URL, headers,
+// error) in a single directory. The directory is size-capped: oldest entries
+// are removed when the number of entries or their total size exceeds the
+// limits. A nil *Store is valid and disables the quarantine.
+package quarantine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gometeo/clock"
+)
+
+const (
+	DefaultMaxEntries = 50
+	DefaultMaxBytes   = 20 << 20
+
+	metaExt = ".json"
+	bodyExt = ".body"
+)
+
+// Conf is the location and the size limits of the quarantine directory
+type Conf struct {
+	Dir        string
+	MaxEntries int         // 0 is DefaultMaxEntries
+	MaxBytes   int64       // total size of bodies, 0 is DefaultMaxBytes
+	Clock      clock.Clock // optional; nil is the system clock
+}
+
+// Entry is the metadata of a quarantined payload
+type Entry struct {
+	Name   string      `json:"name"` // file names without extension
+	Time   time.Time   `json:"time"`
+	Kind   string      `json:"kind"` // parser which rejected the payload
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"` // nil for cached responses
+	Err    string      `json:"error"`
+	Size   int64       `json:"size"`
+}
+
+// Store is a quarantine directory. Safe for concurrent use.
+type Store struct {
+	conf  Conf
+	mutex sync.Mutex
+}
+
+// New returns a Store on conf.Dir, nil if conf.Dir is empty.
+// The directory is created on first Save.
+func New(conf Conf) *Store {
+	if conf.Dir == "" {
+		return nil
+	}
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = DefaultMaxEntries
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = DefaultMaxBytes
+	}
+	return &Store{conf: conf}
+}
+
+// Dir returns the quarantine directory, "" for a nil Store
+func (s *Store) Dir() string {
+	if s == nil {
+		return ""
+	}
+	return s.conf.Dir
+}
+
+// Save stores body and its metadata, then removes oldest entries over the
+// limits. Name, Time and Size of e are set by Save. Nil-safe.
+func (s *Store) Save(e Entry, body []byte) error {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.conf.Dir, 0o755); err != nil {
+		return fmt.Errorf("quarantine: %w", err)
+	}
+	e.Time = clock.Or(s.conf.Clock).Now()
+	e.Size = int64(len(body))
+	e.Name = entryName(e.Time, e.Kind)
+	if e.Header != nil {
+		// session tokens are not needed to reproduce a parsing error
+		e.Header = e.Header.Clone()
+		e.Header.Del("Set-Cookie")
+	}
+	meta, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("quarantine: %w", err)
+	}
+	if err := os.WriteFile(s.path(e.Name, bodyExt), body, 0o644); err != nil {
+		return fmt.Errorf("quarantine: %w", err)
+	}
+	// metadata is written last: an entry without it is ignored
+	if err := os.WriteFile(s.path(e.Name, metaExt), meta, 0o644); err != nil {
+		return fmt.Errorf("quarantine: %w", err)
+	}
+	return s.rotate()
+}
+
+// entryName sorts by time, the kind is only for humans browsing the directory
+func entryName(t time.Time, kind string) string {
+	kind = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(kind))
+	return t.UTC().Format("20060102-150405.000000000") + "-" + kind
+}
+
+func (s *Store) path(name, ext string) string {
+	return filepath.Join(s.conf.Dir, name+ext)
+}
+
+// rotate removes oldest entries until the limits are met, keeping at least
+// the newest one. NOT SAFE - s.mutex must be acquired by callers.
+func (s *Store) rotate() error {
+	entries, err := s.list()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for i, e := range entries {
+		total += e.Size
+		if i == 0 || (i < s.conf.MaxEntries && total <= s.conf.MaxBytes) {
+			continue
+		}
+		os.Remove(s.path(e.Name, metaExt))
+		os.Remove(s.path(e.Name, bodyExt))
+	}
+	return nil
+}
+
+// List returns quarantined entries, newest first. Nil-safe.
+func (s *Store) List() ([]Entry, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list()
+}
+
+func (s *Store) list() ([]Entry, error) {
+	files, err := os.ReadDir(s.conf.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("quarantine: %w", err)
+	}
+	var entries []Entry
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), metaExt)
+		if !ok || f.IsDir() {
+			continue
+		}
+		e, err := s.meta(name)
+		if err != nil {
+			continue // not ours, or half-written
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(b.Name, a.Name) })
+	return entries, nil
+}
+
+func (s *Store) meta(name string) (Entry, error) {
+	var e Entry
+	b, err := os.ReadFile(s.path(name, metaExt))
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, err
+	}
+	e.Name = name
+	return e, nil
+}
+
+// Load returns the metadata and the raw body of entry name
+func (s *Store) Load(name string) (Entry, []byte, error) {
+	if s == nil {
+		return Entry{}, nil, fmt.Errorf("quarantine disabled")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, err := s.meta(name)
+	if err != nil {
+		return e, nil, fmt.Errorf("quarantine entry '%s': %w", name, err)
+	}
+	body, err := os.ReadFile(s.path(name, bodyExt))
+	if err != nil {
+		return e, nil, fmt.Errorf("quarantine entry '%s': %w", name, err)
+	}
+	return e, body, nil
+}
@@ -0,0 +1,108 @@
+package quarantine
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gometeo/testutils"
+)
+
+func TestSaveListLoad(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	s := New(Conf{Dir: filepath.Join(t.TempDir(), "q"), Clock: clk})
+
+	// empty, directory not created yet
+	if entries, err := s.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List() on empty store got %v, %v", entries, err)
+	}
+	header := http.Header{"Content-Type": {"text/html"}, "Set-Cookie": {"mfsession=secret"}}
+	e := Entry{Kind: "html", URL: "https://example.com/", Header: header, Err: "JSON data not found"}
+	if err := s.Save(e, []byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(time.Second)
+	if err := s.Save(Entry{Kind: "multiforecast", Err: "invalid"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Kind != "multiforecast" {
+		t.Fatalf("List() got %+v, want 2 entries newest first", entries)
+	}
+	got, body, err := s.Load(entries[1].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "<html></html>" || got.URL != e.URL || got.Err != e.Err || got.Size != 13 {
+		t.Errorf("Load() got %+v %q", got, body)
+	}
+	if !got.Time.Equal(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Load() time got %v", got.Time)
+	}
+	if got.Header.Get("Content-Type") != "text/html" || got.Header.Get("Set-Cookie") != "" {
+		t.Errorf("Load() header got %v, want Set-Cookie removed", got.Header)
+	}
+	if header.Get("Set-Cookie") == "" {
+		t.Error("Save() modified the caller's header")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		sizes      []int
+		want       int // entries kept
+	}{
+		{"entries", 3, 1000, []int{10, 10, 10, 10, 10}, 3},
+		{"bytes", 10, 25, []int{10, 10, 10, 10}, 2},
+		{"newest kept", 10, 5, []int{10, 10}, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+			dir := t.TempDir()
+			s := New(Conf{Dir: dir, MaxEntries: tc.maxEntries, MaxBytes: tc.maxBytes, Clock: clk})
+			for _, n := range tc.sizes {
+				clk.Advance(time.Millisecond)
+				if err := s.Save(Entry{Kind: "svg"}, make([]byte, n)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tc.want {
+				t.Errorf("kept %d entries, want %d", len(entries), tc.want)
+			}
+			files, _ := os.ReadDir(dir)
+			if len(files) != 2*tc.want {
+				t.Errorf("%d files left, want %d", len(files), 2*tc.want)
+			}
+			if want := clk.Now(); !entries[0].Time.Equal(want) {
+				t.Errorf("newest entry at %v, want %v", entries[0].Time, want)
+			}
+		})
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	s := New(Conf{})
+	if s != nil {
+		t.Fatal("New() without directory must return nil")
+	}
+	if err := s.Save(Entry{}, nil); err != nil {
+		t.Errorf("nil Save() got %v", err)
+	}
+	if entries, err := s.List(); entries != nil || err != nil {
+		t.Errorf("nil List() got %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package ratelimit protects the HTTP server against misbehaving clients.
+//
+// Two independent mechanisms, both disabled by their zero value:
+//   - per-client token buckets, with separate budgets for pages, map data
+//     and static assets. Over-budget requests get 429 Too Many Requests.
+//   - a global cap on requests in flight. Excess requests are shed
+//     immediately with 503 Service Unavailable.
+//
+// Both set Retry-After and are counted in obs. Clients are identified with
+// clientip.FromRequest, so the limiter must run inside the clientip middleware.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gometeo/clientip"
+	"gometeo/obs"
+)
+
+// Class groups requests sharing a per-client budget.
+type Class int
+
+const (
+	ClassPage   Class = iota // html pages, status page
+	ClassData                // map JSON data, the expensive one
+	ClassStatic              // js, css, fonts, pictos, svg maps, favicons
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassData:
+		return "data"
+	case ClassStatic:
+		return "static"
+	default:
+		return "page"
+	}
+}
+
+// Rate is a token bucket refill rate and capacity. Zero value is unlimited.
+type Rate struct {
+	PerSec float64
+	Burst  int
+}
+
+func (r Rate) Enabled() bool {
+	return r.PerSec > 0
+}
+
+func (r Rate) String() string {
+	if !r.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%g/%d", r.PerSec, r.Burst)
+}
+
+// ParseRate parses "rate/burst" (e.g. "2/20" or "0.5/10").
+// Empty string or "0" disables the limit. Burst defaults to ceil(rate).
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || s == "off" {
+		return Rate{}, nil
+	}
+	rs, bs, hasBurst := strings.Cut(s, "/")
+	perSec, err := strconv.ParseFloat(rs, 64)
+	if err != nil || perSec <= 0 || math.IsInf(perSec, 0) {
+		return Rate{}, fmt.Errorf("invalid rate '%s', want a positive number", rs)
+	}
+	burst := int(math.Ceil(perSec))
+	if hasBurst {
+		burst, err = strconv.Atoi(bs)
+		if err != nil || burst < 1 {
+			return Rate{}, fmt.Errorf("invalid burst '%s', want a positive integer", bs)
+		}
+	}
+	return Rate{PerSec: perSec, Burst: burst}, nil
+}
+
+// Conf holds the limiter settings. Zero value disables everything.
+type Conf struct {
+	Pages       Rate
+	Data        Rate
+	Static      Rate
+	MaxInFlight int // 0 = unlimited
+}
+
+func (c Conf) Enabled() bool {
+	return c.Pages.Enabled() || c.Data.Enabled() || c.Static.Enabled() || c.MaxInFlight > 0
+}
+
+func (c Conf) rate(cl Class) Rate {
+	switch cl {
+	case ClassData:
+		return c.Data
+	case ClassStatic:
+		return c.Static
+	default:
+		return c.Pages
+	}
+}
+
+// sweepInterval is how often buckets full again are dropped. Forgetting a
+// full bucket is invisible to the client, however slow its refill rate.
+const sweepInterval = 10 * time.Minute
+
+// Limiter is an http middleware enforcing Conf.
+type Limiter struct {
+	conf     Conf
+	obs      *obs.Registry // optional
+	inFlight atomic.Int64
+
+	mutex     sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+	now       func() time.Time // indirected for tests
+}
+
+type bucketKey struct {
+	ip    string
+	class Class
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter. reg may be nil.
+func New(conf Conf, reg *obs.Registry) *Limiter {
+	return &Limiter{
+		conf:    conf,
+		obs:     reg,
+		buckets: make(map[bucketKey]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Classify returns the budget class of a request path.
+func Classify(p string) Class {
+	switch {
+	case strings.HasSuffix(p, "/data"):
+		return ClassData
+	case strings.HasPrefix(p, "/js/"),
+		strings.HasPrefix(p, "/css/"),
+		strings.HasPrefix(p, "/fonts/"),
+		strings.HasPrefix(p, "/pictos/"),
+		strings.HasSuffix(p, "/svg"),
+		path.Ext(p) != "":
+		return ClassStatic
+	default:
+		return ClassPage
+	}
+}
+
+// allow takes a token from the bucket of (ip, class). When the bucket is
+// empty it returns false and the delay until the next token.
+func (l *Limiter) allow(ip string, cl Class) (bool, time.Duration) {
+	r := l.conf.rate(cl)
+	if !r.Enabled() {
+		return true, 0
+	}
+	now := l.now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(now)
+
+	key := bucketKey{ip, cl}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(r.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(r.Burst), b.tokens+now.Sub(b.last).Seconds()*r.PerSec)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / r.PerSec * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets refilled up to their burst since last used.
+// NOT SAFE - l.mutex must be held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		r := l.conf.rate(k.class)
+		if b.tokens+now.Sub(b.last).Seconds()*r.PerSec >= float64(r.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Middleware wraps h with load shedding and per-client rate limiting.
+// Returns h unchanged when the limiter is disabled. /healthz is exempt
+// so that container health checks never fail because of load.
+func (l *Limiter) Middleware(h http.Handler) http.Handler {
+	if !l.conf.Enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/healthz" {
+			h.ServeHTTP(w, req)
+			return
+		}
+		if max := l.conf.MaxInFlight; max > 0 {
+			if l.inFlight.Add(1) > int64(max) {
+				l.inFlight.Add(-1)
+				l.obs.RecordLoadShed()
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "server busy", http.StatusServiceUnavailable)
+				return
+			}
+			defer l.inFlight.Add(-1)
+		}
+		cl := Classify(req.URL.Path)
+		if ok, wait := l.allow(clientip.FromRequest(req), cl); !ok {
+			l.obs.RecordRateLimited(cl.String())
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gometeo/obs"
+)
+
+func TestParseRate(t *testing.T) {
+	valid := map[string]Rate{
+		"":       {},
+		"0":      {},
+		"2/20":   {PerSec: 2, Burst: 20},
+		"0.5/10": {PerSec: 0.5, Burst: 10},
+		"3":      {PerSec: 3, Burst: 3},
+		"0.2":    {PerSec: 0.2, Burst: 1},
+	}
+	for s, want := range valid {
+		got, err := ParseRate(s)
+		if err != nil {
+			t.Errorf("ParseRate(%q) error: %v", s, err)
+		}
+		if got != want {
+			t.Errorf("ParseRate(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+	for _, s := range []string{"wesh", "-1/3", "2/0", "2/x", "Inf/3"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("ParseRate(%q): expected error", s)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[string]Class{
+		"/france":                    ClassPage,
+		"/statusse":                  ClassPage,
+		"/":                          ClassPage,
+		"/france/data":               ClassData,
+		"/auvergne-rhone-alpes/data": ClassData,
+		"/france/8a1b2c3d/svg":       ClassStatic,
+		"/js/8a1b2c3d/main.js":       ClassStatic,
+		"/pictos/8a1b2c3d/p1j":       ClassStatic,
+		"/favicon.ico":               ClassStatic,
+		"/robots.txt":                ClassStatic,
+	}
+	for p, want := range tests {
+		if got := Classify(p); got != want {
+			t.Errorf("Classify(%s) = %s, want %s", p, got, want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l := New(Conf{Data: Rate{PerSec: 1, Burst: 3}}, nil)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if ok, _ := l.allow("192.0.2.1", ClassData); !ok {
+			t.Fatalf("request %d within burst rejected", i)
+		}
+	}
+	ok, wait := l.allow("192.0.2.1", ClassData)
+	if ok {
+		t.Fatal("request beyond burst accepted")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want in (0, 1s]", wait)
+	}
+	// budgets are per client and per class
+	if ok, _ := l.allow("192.0.2.2", ClassData); !ok {
+		t.Error("other client must have its own bucket")
+	}
+	if ok, _ := l.allow("192.0.2.1", ClassPage); !ok {
+		t.Error("unlimited class must not be rejected")
+	}
+	// refill
+	now = now.Add(1500 * time.Millisecond)
+	if ok, _ := l.allow("192.0.2.1", ClassData); !ok {
+		t.Error("bucket must refill over time")
+	}
+	// idle buckets are forgotten
+	now = now.Add(2 * sweepInterval)
+	l.allow("192.0.2.3", ClassData)
+	l.mutex.Lock()
+	n := len(l.buckets)
+	l.mutex.Unlock()
+	if n != 1 {
+		t.Errorf("after sweep, %d buckets left, want 1", n)
+	}
+}
+
+func TestSweepSlowRate(t *testing.T) {
+	// a drained bucket takes 100 minutes to refill, longer than sweepInterval
+	l := New(Conf{Data: Rate{PerSec: 0.0005, Burst: 3}}, nil)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	for range 3 {
+		l.allow("192.0.2.1", ClassData)
+	}
+	kept := func() bool {
+		l.allow("192.0.2.2", ClassData) // sweeps
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		_, ok := l.buckets[bucketKey{"192.0.2.1", ClassData}]
+		return ok
+	}
+
+	now = now.Add(2 * sweepInterval)
+	if !kept() {
+		t.Fatal("bucket still refilling was forgotten")
+	}
+	if ok, _ := l.allow("192.0.2.1", ClassData); ok {
+		t.Error("request on a bucket still refilling accepted")
+	}
+	now = now.Add(100 * time.Minute)
+	if kept() {
+		t.Error("full bucket not forgotten")
+	}
+}
+
+func TestMiddlewareRateLimited(t *testing.T) {
+	reg := obs.NewRegistry()
+	l := New(Conf{Data: Rate{PerSec: 0.01, Burst: 1}}, reg)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("/france/data"); rec.Code != http.StatusOK {
+		t.Fatalf("first data request status %d, want 200", rec.Code)
+	}
+	rec := get("/france/data")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second data request status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("healthz must be exempt, got %d", rec.Code)
+	}
+	if got := reg.Snapshot().RateLimitedData; got != 1 {
+		t.Errorf("RateLimitedData = %d, want 1", got)
+	}
+}
+
+func TestMiddlewareLoadShed(t *testing.T) {
+	reg := obs.NewRegistry()
+	l := New(Conf{MaxInFlight: 1}, reg)
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/france", nil))
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/france", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d while at capacity, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+	}
+	close(release)
+	wg.Wait()
+
+	if got := reg.Snapshot().LoadShed; got != 1 {
+		t.Errorf("LoadShed = %d, want 1", got)
+	}
+	if l.inFlight.Load() != 0 {
+		t.Errorf("inFlight = %d after completion, want 0", l.inFlight.Load())
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	base := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := New(Conf{}, nil).Middleware(base)
+	if _, ok := h.(http.HandlerFunc); !ok {
+		t.Fatal("disabled limiter must return the handler unchanged")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gometeo/crawl"
+	"gometeo/quarantine"
+)
+
+// replay is the 'replay' subcommand. It feeds quarantined payloads through
+// the parsers again, to reproduce a parsing error or check a fix:
+//
+//	gometeo replay [-dir quarantine] [entry or file ...]
+//
+// Without arguments, all entries of the quarantine directory are replayed.
+// Returns the exit code: 0 if all payloads parse, 1 otherwise.
+func replay(args []string) int {
+	f := flag.NewFlagSet("replay", flag.ContinueOnError)
+	dir := f.String("dir", os.Getenv("GOMETEO_QUARANTINE_DIR"), "quarantine directory")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+	names := f.Args()
+	if len(names) == 0 {
+		if *dir == "" {
+			fmt.Fprintln(os.Stderr, "replay: no quarantine directory, set -dir or GOMETEO_QUARANTINE_DIR")
+			return 2
+		}
+		entries, err := quarantine.New(quarantine.Conf{Dir: *dir}).List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "replay:", err)
+			return 2
+		}
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+	}
+
+	var failed int
+	for _, arg := range names {
+		// accept entry names, or paths of the .json/.body files of an entry
+		d, name := filepath.Split(arg)
+		if d == "" {
+			d = *dir
+		}
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".body")
+		e, body, err := quarantine.New(quarantine.Conf{Dir: d}).Load(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "replay:", err)
+			failed++
+			continue
+		}
+		if err := crawl.Replay(e.Kind, bytes.NewReader(body)); err != nil {
+			fmt.Printf("FAIL %s %s %s: %v\n", name, e.Kind, e.URL, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s %s %s\n", name, e.Kind, e.URL)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+// Package rewrite redirects upstream urls to other hosts, so that staging,
+// mirrors or a local fake upstream can stand in for meteofrance.com.
+//
+// A rule "https://rpcache-aa.meteofrance.com=http://localhost:1052" moves
+// every url of the left-hand scheme and host to the right-hand ones. Hosts
+// may start with a "*." wildcard, and both sides may have a path prefix,
+// replaced as a whole.
+package rewrite
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Rule replaces the From prefix of urls by To
+type Rule struct {
+	From, To *url.URL
+}
+
+// Hosts tells where upstream urls point to. The zero value changes nothing.
+type Hosts struct {
+	ApiBase string // replaces the forecast api base scraped from pages
+	Rules   []Rule // applied after ApiBase, the first matching rule wins
+}
+
+// ParseRules parses comma-separated "from=to" rules, empty is none
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("rule '%s' is not 'from=to'", item)
+		}
+		var r Rule
+		var err error
+		if r.From, err = parseBase(from); err != nil {
+			return nil, err
+		}
+		if r.To, err = parseBase(to); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(r.To.Host, "*.") {
+			return nil, fmt.Errorf("rule '%s' has a wildcard target", item)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parseBase parses an absolute http(s) url without query
+func parseBase(s string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("'%s' is not an absolute http(s) url", s)
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
+
+// match tells whether u starts with the From prefix of r, and returns the
+// rest of its path
+func (r Rule) match(u *url.URL) (string, bool) {
+	if u.Scheme != r.From.Scheme {
+		return "", false
+	}
+	host := strings.ToLower(u.Host)
+	if suffix, ok := strings.CutPrefix(r.From.Host, "*"); ok {
+		if !strings.HasSuffix(host, suffix) {
+			return "", false
+		}
+	} else if host != r.From.Host {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(u.Path, r.From.Path)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return "", false
+	}
+	return rest, true
+}
+
+// Rewrite returns a copy of u moved by the first matching rule
+func (h Hosts) Rewrite(u *url.URL) *url.URL {
+	v := *u
+	for _, r := range h.Rules {
+		rest, ok := r.match(u)
+		if !ok {
+			continue
+		}
+		v.Scheme = r.To.Scheme
+		v.Host = r.To.Host
+		v.Path = r.To.Path + rest
+		v.RawPath = ""
+		break
+	}
+	return &v
+}
+
+func (r Rule) String() string {
+	return r.From.String() + "=" + r.To.String()
+}
+
+// String lists the api base and rules, for logs
+func (h Hosts) String() string {
+	s := make([]string, 0, len(h.Rules)+1)
+	if h.ApiBase != "" {
+		s = append(s, "api="+h.ApiBase)
+	}
+	for _, r := range h.Rules {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, ",")
+}
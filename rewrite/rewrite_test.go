@@ -0,0 +1,71 @@
+package rewrite
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := map[string]struct {
+		rules string
+		want  int
+		err   bool
+	}{
+		"empty":    {rules: "", want: 0},
+		"two":      {rules: "https://a.fr=http://localhost:1052, https://*.b.fr/x=https://c.fr/y/", want: 2},
+		"no equal": {rules: "https://a.fr", err: true},
+		"relative": {rules: "/a=http://localhost", err: true},
+		"query":    {rules: "https://a.fr?x=1=http://localhost", err: true},
+		"scheme":   {rules: "ftp://a.fr=http://localhost", err: true},
+		"wildcard": {rules: "https://a.fr=http://*.b.fr", err: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rules, err := ParseRules(tc.rules)
+			if tc.err {
+				if err == nil {
+					t.Errorf("ParseRules(%q) expected error", tc.rules)
+				}
+				return
+			}
+			if err != nil || len(rules) != tc.want {
+				t.Errorf("ParseRules(%q) got %d rules, %v, want %d", tc.rules, len(rules), err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rules, err := ParseRules("https://rpcache-aa.meteofrance.com=http://localhost:1052," +
+		"https://*.meteofrance.com/internet2018client=https://staging.example.com/api," +
+		"https://meteofrance.com/modules/custom/mf_tools_common_theme_public=https://cdn.example.com/pictos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Hosts{Rules: rules}
+	tests := []struct {
+		in, want string
+	}{
+		{"https://rpcache-aa.meteofrance.com/internet2018client/2.0/multiforecast?liste_id=1", "http://localhost:1052/internet2018client/2.0/multiforecast?liste_id=1"},
+		{"https://RWG.meteofrance.com/internet2018client/2.0", "https://staging.example.com/api/2.0"},
+		{"https://rwg.meteofrance.com/internet2018clientx", "https://rwg.meteofrance.com/internet2018clientx"},
+		{"https://meteofrance.com/modules/custom/mf_tools_common_theme_public/svg/weather/p1j.svg", "https://cdn.example.com/pictos/svg/weather/p1j.svg"},
+		{"https://meteofrance.com/previsions-meteo-france/paris/75", "https://meteofrance.com/previsions-meteo-france/paris/75"},
+		{"http://rpcache-aa.meteofrance.com/x", "http://rpcache-aa.meteofrance.com/x"},
+	}
+	for _, tc := range tests {
+		u, err := url.Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := h.Rewrite(u).String(); got != tc.want {
+			t.Errorf("Rewrite(%s)=%s, want %s", tc.in, got, tc.want)
+		}
+		if u.String() != tc.in {
+			t.Errorf("Rewrite(%s) modified its argument", tc.in)
+		}
+	}
+	if got := (Hosts{}).String(); got != "" {
+		t.Errorf("zero Hosts String()=%q", got)
+	}
+}
@@ -0,0 +1,311 @@
+// Package schema detects changes in the shape of upstream payloads.
+//
+// A payload is walked along the Go type decoding it: object keys without a
+// matching field are unknown, fields never present are missing. Each
+// endpoint keeps an inventory of the field paths seen so far, e.g.
+// "features[].properties.forecast[].T". Payloads of an endpoint differ from
+// one source (upstream map) to another, so the first payload of each source
+// is a baseline. Afterwards a field never seen on the endpoint appearing,
+// or a field a source had in every payload disappearing from it, is a
+// change, recorded once in obs.
+//
+// Checking never fails a payload. A nil *Checker is valid and disables it.
+package schema
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gometeo/clock"
+)
+
+// Recorder records shape changes, *obs.Registry implements it. Declared
+// here as obs tests depend on mfmap, which depends on this package.
+type Recorder interface {
+	RecordSchemaChange(endpoint, field, change string)
+}
+
+// Spec describes how an endpoint payload is decoded
+type Spec struct {
+	Endpoint string
+	Type     reflect.Type
+	OpenRoot bool // unknown keys of the root object are expected, not reported
+}
+
+// ChangeKind tells whether a field appeared or disappeared
+type ChangeKind string
+
+const (
+	FieldAdded   ChangeKind = "added"
+	FieldRemoved ChangeKind = "removed"
+)
+
+// Change is a field appearing or disappearing from an endpoint payload
+type Change struct {
+	Time     time.Time
+	Endpoint string
+	Path     string
+	Kind     ChangeKind
+}
+
+// Inventory is the known shape of an endpoint payloads
+type Inventory struct {
+	Endpoint string
+	Payloads int
+	Fields   int      // distinct field paths seen
+	Unknown  []string // fields seen, not decoded into Go types
+	Missing  []string // Go fields absent from payloads
+	Changes  []Change // oldest first
+}
+
+// Checker keeps the field inventory of each endpoint. Safe for concurrent use.
+type Checker struct {
+	clock     clock.Clock
+	obs       Recorder
+	mutex     sync.Mutex
+	endpoints map[string]*endpoint
+}
+
+type endpoint struct {
+	payloads int
+	fields   map[string]bool // field path -> decoded into a Go field
+	missing  map[string]bool // Go fields absent from the last payload
+	reported map[string]bool // changes already recorded, by kind+path
+	changes  []Change
+	always   map[string]map[string]bool // field paths seen in every payload, by source
+}
+
+// New returns a Checker timing changes on c, nil is the system clock.
+func New(c clock.Clock) *Checker {
+	return &Checker{
+		clock:     clock.Or(c),
+		endpoints: make(map[string]*endpoint),
+	}
+}
+
+// SetObs attaches a recorder of shape changes, usually the obs registry.
+// Nil-safe.
+func (c *Checker) SetObs(r Recorder) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.obs = r
+}
+
+// Check walks raw, a payload of src, along spec.Type, updates the inventory
+// of spec.Endpoint and returns the changes from the previous payloads of
+// src. Invalid JSON is ignored, parsers report it. Nil-safe.
+func (c *Checker) Check(spec Spec, src string, raw []byte) []Change {
+	if c == nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	w := newWalk(spec)
+	w.walk(v, spec.Type, "")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ep, ok := c.endpoints[spec.Endpoint]
+	if !ok {
+		ep = &endpoint{
+			fields:   make(map[string]bool),
+			missing:  make(map[string]bool),
+			reported: make(map[string]bool),
+			always:   make(map[string]map[string]bool),
+		}
+		c.endpoints[spec.Endpoint] = ep
+	}
+	ep.payloads++
+	always, ok := ep.always[src]
+	baseline := !ok
+	if baseline {
+		always = make(map[string]bool, len(w.seen))
+		for path := range w.seen {
+			always[path] = true
+		}
+		ep.always[src] = always
+	}
+
+	now := c.clock.Now()
+	var changes []Change
+	change := func(path string, kind ChangeKind) {
+		key := string(kind) + " " + path
+		if baseline || ep.reported[key] {
+			return
+		}
+		ep.reported[key] = true
+		changes = append(changes, Change{Time: now, Endpoint: spec.Endpoint, Path: path, Kind: kind})
+	}
+	for _, path := range sortedKeys(w.seen) {
+		if _, ok := ep.fields[path]; !ok {
+			ep.fields[path] = w.seen[path]
+			change(path, FieldAdded)
+		}
+	}
+	clear(ep.missing)
+	for _, path := range w.missing() {
+		ep.missing[path] = true
+		if always[path] {
+			change(path, FieldRemoved)
+		}
+	}
+	for path := range always {
+		if _, ok := w.seen[path]; !ok {
+			delete(always, path)
+		}
+	}
+	ep.changes = append(ep.changes, changes...)
+	for _, ch := range changes {
+		slog.Warn("upstream schema changed", "endpoint", ch.Endpoint, "field", ch.Path, "change", ch.Kind)
+		if c.obs != nil {
+			c.obs.RecordSchemaChange(ch.Endpoint, ch.Path, string(ch.Kind))
+		}
+	}
+	return changes
+}
+
+// Inventories returns the shape of each endpoint, sorted by name. Nil-safe.
+func (c *Checker) Inventories() []Inventory {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var invs []Inventory
+	for _, name := range sortedKeys(c.endpoints) {
+		ep := c.endpoints[name]
+		inv := Inventory{
+			Endpoint: name,
+			Payloads: ep.payloads,
+			Fields:   len(ep.fields),
+			Missing:  sortedKeys(ep.missing),
+			Changes:  slices.Clone(ep.changes),
+		}
+		for _, path := range sortedKeys(ep.fields) {
+			if !ep.fields[path] {
+				inv.Unknown = append(inv.Unknown, path)
+			}
+		}
+		invs = append(invs, inv)
+	}
+	return invs
+}
+
+// walk is the result of walking a payload along a Go type
+type walk struct {
+	spec    Spec
+	seen    map[string]bool         // field path -> decoded into a Go field
+	objects map[string]reflect.Type // paths of objects decoded into a struct
+}
+
+func newWalk(spec Spec) *walk {
+	return &walk{
+		spec:    spec,
+		seen:    make(map[string]bool),
+		objects: make(map[string]reflect.Type),
+	}
+}
+
+// walk descends into v as long as its shape matches t. Values decoded by
+// custom unmarshalers from another shape (e.g. arrays into structs) are leaves.
+func (w *walk) walk(v any, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		w.objects[path] = t
+		fields := jsonFields(t)
+		for k, val := range obj {
+			p := join(path, k)
+			f, ok := fields[k]
+			if !ok {
+				if path != "" || !w.spec.OpenRoot {
+					w.seen[p] = false
+				}
+				continue
+			}
+			w.seen[p] = true
+			w.walk(val, f.Type, p)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := v.([]any); ok {
+			for _, val := range arr {
+				w.walk(val, t.Elem(), path+"[]")
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]any); ok {
+			for _, val := range obj {
+				w.walk(val, t.Elem(), join(path, "*"))
+			}
+		}
+	}
+}
+
+// missing returns Go fields absent from all objects at their path
+func (w *walk) missing() []string {
+	var missing []string
+	for path, t := range w.objects {
+		for name, f := range jsonFields(t) {
+			if f.Tag.Get("schema") == "computed" {
+				continue
+			}
+			if p := join(path, name); !w.seen[p] {
+				missing = append(missing, p)
+			}
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// jsonFields returns the exported fields of struct t, by json name
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,164 @@
+package schema_test
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"gometeo/obs"
+	"gometeo/schema"
+	"gometeo/testutils"
+)
+
+type testPoint [2]float64
+
+// testCoords decodes from an array, like geojson coordinates
+type testCoords struct {
+	Lat, Lng float64
+}
+
+type testItem struct {
+	Name   string     `json:"name"`
+	Value  *float64   `json:"value"`
+	Coords testCoords `json:"coords"`
+	Local  bool       `json:"local" schema:"computed"`
+}
+
+type testPayload struct {
+	Type   string              `json:"type"`
+	Items  []testItem          `json:"items"`
+	ByName map[string]testItem `json:"by_name"`
+	Point  testPoint           `json:"point"`
+	Time   time.Time           `json:"time"`
+	Hidden string              `json:"-"`
+}
+
+var testSpec = schema.Spec{Endpoint: "test", Type: reflect.TypeFor[testPayload]()}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    schema.Spec
+		json    string
+		unknown []string
+		missing []string
+	}{
+		{
+			name: "complete",
+			spec: testSpec,
+			json: `{"type": "x", "time": "2025-01-01T00:00:00Z", "point": [1, 2],
+				"items": [{"name": "a", "value": 1, "coords": [1, 2]}],
+				"by_name": {"a": {"name": "a", "value": null, "coords": [1, 2]}}}`,
+		},
+		{
+			name: "unknown and missing",
+			spec: testSpec,
+			json: `{"type": "x", "time": "2025-01-01T00:00:00Z", "point": [1, 2], "extra": {"deep": 1},
+				"items": [{"name": "a", "coords": [1, 2], "new": 1}, {"name": "b", "coords": [1, 2]}],
+				"by_name": []}`,
+			unknown: []string{"extra", "items[].new"},
+			missing: []string{"items[].value"},
+		},
+		{
+			name:    "open root",
+			spec:    schema.Spec{Endpoint: "test", Type: testSpec.Type, OpenRoot: true},
+			json:    `{"type": "x", "time": "", "point": [], "items": [], "by_name": {}, "other_module": {}}`,
+			unknown: nil,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := schema.New(nil)
+			c.Check(tc.spec, "", []byte(tc.json))
+			inv := c.Inventories()[0]
+			if !slices.Equal(inv.Unknown, tc.unknown) {
+				t.Errorf("unknown fields got %v, want %v", inv.Unknown, tc.unknown)
+			}
+			if !slices.Equal(inv.Missing, tc.missing) {
+				t.Errorf("missing fields got %v, want %v", inv.Missing, tc.missing)
+			}
+		})
+	}
+}
+
+func TestChanges(t *testing.T) {
+	clk := testutils.NewFakeClock(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	reg := obs.NewRegistryWithClock(clk)
+	c := schema.New(clk)
+	c.SetObs(reg)
+
+	baseline := `{"type": "x", "items": [{"name": "a", "value": 1}]}`
+	if changes := c.Check(testSpec, "map", []byte(baseline)); len(changes) != 0 {
+		t.Errorf("baseline got changes %v", changes)
+	}
+	if changes := c.Check(testSpec, "map", []byte(baseline)); len(changes) != 0 {
+		t.Errorf("same shape got changes %v", changes)
+	}
+
+	// value disappears, new field appears
+	changed := `{"type": "x", "items": [{"name": "a", "val": 1}]}`
+	changes := c.Check(testSpec, "map", []byte(changed))
+	want := []schema.Change{
+		{Time: clk.Now(), Endpoint: "test", Path: "items[].val", Kind: schema.FieldAdded},
+		{Time: clk.Now(), Endpoint: "test", Path: "items[].value", Kind: schema.FieldRemoved},
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("changes got %v, want %v", changes, want)
+	}
+	// reported once
+	if changes := c.Check(testSpec, "map", []byte(changed)); len(changes) != 0 {
+		t.Errorf("second changed payload got changes %v", changes)
+	}
+	// invalid json is ignored
+	if changes := c.Check(testSpec, "map", []byte(`{"type":`)); len(changes) != 0 {
+		t.Errorf("invalid json got changes %v", changes)
+	}
+
+	inv := c.Inventories()[0]
+	if inv.Payloads != 4 || len(inv.Changes) != 2 {
+		t.Errorf("inventory got %+v", inv)
+	}
+	s := reg.Snapshot()
+	if s.SchemaChanges != 2 || len(s.RecentErrors) != 2 || s.RecentErrors[0].Source != obs.SourceSchema {
+		t.Errorf("obs got %d changes, errors %+v", s.SchemaChanges, s.RecentErrors)
+	}
+
+	var nilChecker *schema.Checker
+	nilChecker.SetObs(reg)
+	if nilChecker.Check(testSpec, "map", []byte(baseline)) != nil || nilChecker.Inventories() != nil {
+		t.Error("nil Checker must do nothing")
+	}
+}
+
+func TestChangesPerSource(t *testing.T) {
+	const (
+		full    = `{"type": "x", "items": [{"name": "a", "value": 1}]}`
+		noValue = `{"type": "x", "items": [{"name": "a"}]}`
+		extra   = `{"type": "x", "items": [{"name": "a", "value": 1, "val": 1}]}`
+	)
+	c := schema.New(nil)
+	steps := []struct {
+		src, json string
+		want      []string // kind and path of changes
+	}{
+		{"cantal", full, nil},
+		{"ain", noValue, nil}, // baseline of another map
+		{"ain", full, nil},    // present in some payloads of ain only
+		{"ain", noValue, nil},
+		{"savoie", extra, nil}, // baseline, even with a field new to the endpoint
+		{"cantal", noValue, []string{"removed items[].value"}},
+		{"cantal", extra, nil},   // seen on savoie
+		{"savoie", noValue, nil}, // reported once per endpoint
+		{"ain", `{"type": "x", "items": [{"name": "a", "new": 1}]}`, []string{"added items[].new"}},
+	}
+	for i, s := range steps {
+		var got []string
+		for _, ch := range c.Check(testSpec, s.src, []byte(s.json)) {
+			got = append(got, string(ch.Kind)+" "+ch.Path)
+		}
+		if !slices.Equal(got, s.want) {
+			t.Errorf("step %d (%s): changes got %v, want %v", i, s.src, got, s.want)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"gometeo/clientip"
 )
 
 // from https://arunvelsriram.dev/simple-golang-http-logging-middleware
@@ -52,6 +54,7 @@ func withLogging(h http.Handler) http.Handler {
 			slog.Info("http request",
 				"method", req.Method,
 				"uri", req.RequestURI,
+				"client", clientip.FromRequest(req),
 				"status", responseData.status,
 				"duration", duration,
 				"size", responseData.size,
@@ -10,66 +10,115 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"sync"
 	"syscall"
 	"time"
 
 	"gometeo/appconf"
+	"gometeo/clientip"
+	"gometeo/clock"
 	"gometeo/content"
 	"gometeo/crawl"
 	"gometeo/mfmap"
 	"gometeo/mfmap/schedule"
 	"gometeo/obs"
+	"gometeo/ratelimit"
 	"gometeo/static"
 )
 
 const startPath = "/"
 
+// crawlRoots returns startPath followed by the roots of enabled zone families.
+func crawlRoots() []string {
+	roots := []string{startPath}
+	for _, k := range appconf.Zones() {
+		roots = append(roots, k.Roots...)
+	}
+	return roots
+}
+
 // ServerConf holds server-level tuning parameters.
 // It is internal to the server package; tests inject custom values directly.
 type ServerConf struct {
-	FetchInterval   time.Duration
+	FetchInterval   time.Duration // minimum delay between two map refreshes start
+	FetchWorkers    int           // max concurrent map refreshes
 	FetchTimeout    time.Duration
 	ShutdownTimeout time.Duration
+	Clock           clock.Clock // optional; nil is the system clock
 }
 
 func defaultServerConf() ServerConf {
 	return ServerConf{
-		FetchInterval:   10 * time.Second,
+		FetchInterval:   appconf.FetchInterval(),
+		FetchWorkers:    appconf.FetchWorkers(),
 		FetchTimeout:    5 * time.Minute,
 		ShutdownTimeout: 10 * time.Second,
+		Clock:           appconf.Clock(),
 	}
 }
 
 func contentConf(reg *obs.Registry) content.ContentConf {
 	dayMin, dayMax := appconf.KeepDays()
 	return content.ContentConf{
-		DayMin:  dayMin,
-		DayMax:  dayMax,
-		CacheId: appconf.CacheId(),
-		Obs:     reg,
+		DayMin:        dayMin,
+		DayMax:        dayMax,
+		CacheId:       appconf.CacheId(),
+		Obs:           reg,
+		Clock:         appconf.Clock(),
+		DegradedRatio: appconf.DegradedRatio(),
+		Quarantine:    appconf.Quarantine(),
+		Schema:        appconf.SchemaChecker(),
+		Upstream:      upstreamSettings(),
+		Budget:        appconf.Budget(),
+	}
+}
+
+// upstreamSettings lists the upstream client configuration for the status page
+func upstreamSettings() []content.Setting {
+	s := []content.Setting{{Name: "url", Value: appconf.Upstream()}}
+	if hosts := appconf.Hosts().String(); hosts != "" {
+		s = append(s, content.Setting{Name: "hosts", Value: hosts})
+	}
+	if ttl := appconf.PageTTL(); ttl > 0 {
+		s = append(s, content.Setting{Name: "page ttl", Value: ttl.String()})
+	}
+	switch t := appconf.Transport().(type) {
+	case *crawl.RecordTransport:
+		s = append(s, content.Setting{Name: "record", Value: t.Dir()})
+	case *crawl.ReplayTransport:
+		s = append(s, content.Setting{Name: "replay", Value: t.Dir()})
 	}
+	for _, kv := range appconf.Network().Settings() {
+		s = append(s, content.Setting{Name: kv[0], Value: kv[1]})
+	}
+	return s
 }
 
 func crawlConf(reg *obs.Registry) crawl.CrawlConf {
 	return crawl.CrawlConf{
-		Upstream: appconf.Upstream(),
-		MapConf:  mapConf(),
-		Obs:      reg,
+		Upstream:   appconf.Upstream(),
+		MapConf:    mapConf(),
+		Obs:        reg,
+		Quarantine: appconf.Quarantine(),
+		Transport:  appconf.Transport(),
+		PageTTL:    appconf.PageTTL(),
+		Budget:     appconf.Budget(),
 	}
 }
 
 func mapConf() mfmap.MapConf {
-	r := appconf.UpdateRate()
 	return mfmap.MapConf{
 		CacheId:  appconf.CacheId(),
 		VueJs:    appconf.VueJs(),
 		Upstream: appconf.Upstream(),
-		Rates: schedule.UpdateRates{
-			HotDuration:    r.HotDuration,
-			HotMaxAge:      r.HotMaxAge,
-			ColdMaxAge:     r.ColdMaxAge,
-			FailureBackoff: r.FailureBackoff,
-		},
+		Hosts:    appconf.Hosts(),
+		Rates:    appconf.UpdateRate(),
+		Hits:     appconf.HitFilter(),
+		Scope:    appconf.CrawlScope(),
+		Clock:    appconf.Clock(),
+		Schema:   appconf.SchemaChecker(),
+		Budget:   appconf.Budget(),
+		Svg:      appconf.Svg(),
 	}
 }
 
@@ -87,14 +136,35 @@ func Start() error {
 	slog.SetDefault(slog.New(newLevelSplitHandler(os.Stdout, os.Stderr, logOpts)))
 
 	rates := appconf.UpdateRate()
-	slog.Info("starting gometeo", "commit", appconf.Commit(), "addr", appconf.Addr(), "limit", appconf.Limit(), "oneshot", appconf.OneShot(), "vuejs", appconf.VueJs())
-	slog.Info("update rates", "hotDuration", rates.HotDuration, "hotMaxAge", rates.HotMaxAge, "coldMaxAge", rates.ColdMaxAge, "failureBackoff", rates.FailureBackoff)
+	slog.Info("starting gometeo", "commit", appconf.Commit(), "addr", appconf.Addr(), "limit", appconf.Limit(), "oneshot", appconf.OneShot(), "vuejs", appconf.VueJs(), "now", appconf.Clock().Now().Format(time.RFC3339))
+	slog.Info("upstream", "url", appconf.Upstream(), "hosts", appconf.Hosts().String(), "pageTTL", appconf.PageTTL(), "budget", appconf.Budget().String())
+	slog.Info("crawl scope", "rules", appconf.CrawlScope().String(), "roots", crawlRoots())
+	slog.Info("trusted proxies", "cidrs", appconf.TrustedProxies(), "header", appconf.ProxyHeader())
+	rl := appconf.RateLimit()
+	slog.Info("quarantine", "dir", appconf.Quarantine().Dir())
+	switch t := appconf.Transport().(type) {
+	case *crawl.RecordTransport:
+		slog.Info("recording upstream exchanges", "dir", t.Dir())
+	case *crawl.ReplayTransport:
+		slog.Info("replaying upstream exchanges, network disabled", "dir", t.Dir())
+	}
+	var network []any
+	for _, kv := range appconf.Network().Settings() {
+		network = append(network, kv[0], kv[1])
+	}
+	slog.Info("upstream network", network...)
+	slog.Info("rate limits", "pages", rl.Pages, "data", rl.Data, "static", rl.Static, "maxInFlight", rl.MaxInFlight)
+	slog.Info("update rates", "hotDuration", rates.HotDuration, "hotMaxAge", rates.HotMaxAge, "coldMaxAge", rates.ColdMaxAge, "failureBackoff", rates.FailureBackoff, "hotVisitors", rates.HotVisitors, "hitDedup", rates.HitDedup, "runMargin", rates.RunMargin, "propagateFactor", rates.PropagateFactor, "propagateDepth", rates.PropagateDepth)
 
 	// Root context cancelled on SIGINT/SIGTERM for graceful shutdown.
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	return startWithContext(ctx, defaultServerConf(), obs.NewRegistry())
+	sconf := defaultServerConf()
+	reg := obs.NewRegistryWithClock(sconf.Clock)
+	appconf.SchemaChecker().SetObs(reg)
+	appconf.Budget().SetObs(reg)
+	return startWithContext(ctx, sconf, reg)
 }
 
 func startWithContext(ctx context.Context, sconf ServerConf, reg *obs.Registry) error {
@@ -124,8 +194,10 @@ func startOneShot(ctx context.Context, sconf ServerConf, ln net.Listener, limit
 	if c == nil {
 		fetchCtx, cancel := context.WithTimeout(ctx, sconf.FetchTimeout)
 		cr := crawl.NewCrawler(crawlConf(reg))
-		c = content.New(contentConf(reg))
-		chMap, chPicto := cr.Fetch(fetchCtx, startPath, limit)
+		cconf := contentConf(reg)
+		cconf.Pictos = cr
+		c = content.New(cconf)
+		chMap, chPicto := cr.FetchRoots(fetchCtx, crawlRoots(), limit)
 		<-c.Receive(chMap, chPicto) // wait for all maps downloads to complete
 		cancel()
 
@@ -149,12 +221,14 @@ func startOneShot(ctx context.Context, sconf ServerConf, ln net.Listener, limit
 
 func startNormal(ctx context.Context, sconf ServerConf, ln net.Listener, limit int, reg *obs.Registry) error {
 	cr := crawl.NewCrawler(crawlConf(reg))
-	c := content.New(contentConf(reg))
+	cconf := contentConf(reg)
+	cconf.Pictos = cr
+	c := content.New(cconf)
 	defer c.Close()
 
 	// initial fetch, bounded by FetchTimeout so startup can't hang forever
 	initCtx, cancelInit := context.WithTimeout(ctx, sconf.FetchTimeout)
-	chMap, chPicto := cr.Fetch(initCtx, startPath, limit)
+	chMap, chPicto := cr.FetchRoots(initCtx, crawlRoots(), limit)
 	initDone := c.Receive(chMap, chPicto)
 
 	// forever update loop in background
@@ -183,8 +257,10 @@ func startNormal(ctx context.Context, sconf ServerConf, ln net.Listener, limit i
 	return nil
 }
 
-// runUpdateLoop waits for initDone then repeatedly fetches the next map
-// needing an update. It exits when ctx is cancelled.
+// runUpdateLoop waits for initDone then refreshes maps from the update queue,
+// sleeping until the next one is due. Up to sconf.FetchWorkers refreshes run
+// concurrently, started at least sconf.FetchInterval apart.
+// It exits when ctx is cancelled, after running refreshes complete.
 func runUpdateLoop(
 	ctx context.Context,
 	sconf ServerConf,
@@ -193,39 +269,104 @@ func runUpdateLoop(
 	initDone <-chan struct{},
 ) {
 	<-initDone
-	slog.Info("enter forever update loop")
-	ticker := time.NewTicker(sconf.FetchInterval)
-	defer ticker.Stop()
+	slog.Info("enter forever update loop", "workers", max(sconf.FetchWorkers, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	clk := clock.Or(sconf.Clock)
+	workers := make(chan struct{}, max(sconf.FetchWorkers, 1))
+	var lastStart time.Time
 	for {
+		// wait for a free worker
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case workers <- struct{}{}:
 		}
-		path := c.Updatable()
-		if path == "" {
-			continue
+		path, ok := waitDue(ctx, clk, c.Queue(), lastStart.Add(sconf.FetchInterval))
+		if !ok {
+			return
 		}
-		fetchCtx, cancel := context.WithTimeout(ctx, sconf.FetchTimeout)
-		chMap, chPicto := cr.Fetch(fetchCtx, path, 1)
-		// Tee the map channel so we can tell whether the fetch produced a map.
-		// On failure, mark the map so the scheduler applies the failure backoff
-		// and we don't hammer upstream every tick.
-		teedMap := make(chan *mfmap.MfMap)
-		received := 0
+		lastStart = clk.Now()
+		wg.Add(1)
 		go func() {
-			defer close(teedMap)
-			for m := range chMap {
-				received++
-				teedMap <- m
-			}
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			refreshMap(ctx, sconf, cr, c, path)
 		}()
-		<-c.Receive(teedMap, chPicto)
-		if received == 0 {
-			c.MarkFailure(path)
+	}
+}
+
+// waitDue blocks until the head of q is due and not before notBefore, then pops it.
+// Returns false when ctx is cancelled.
+func waitDue(ctx context.Context, clk clock.Clock, q *schedule.Queue, notBefore time.Time) (string, bool) {
+	for {
+		now := clk.Now()
+		if !now.Before(notBefore) {
+			if path, ok := q.PopDue(now); ok {
+				return path, true
+			}
 		}
-		cancel()
+		// sleep until the head is due, or forever if the queue is empty.
+		// Wake() interrupts the sleep when a map is added or turns hot.
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if _, due, ok := q.Peek(); ok {
+			timer = time.NewTimer(max(due.Sub(now), notBefore.Sub(now)))
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-q.Wake():
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return "", false
+		}
+	}
+}
+
+// refreshMap fetches a single map popped from the update queue and
+// schedules its next update. The full crawl is skipped when a probe shows
+// upstream has not published a new run since the last fetch.
+func refreshMap(ctx context.Context, sconf ServerConf, cr *crawl.Crawler, c *content.Meteo, path string) {
+	fetchCtx, cancel := context.WithTimeout(ctx, sconf.FetchTimeout)
+	defer cancel()
+	if m := c.StoredMap(path); m != nil {
+		changed, err := cr.Probe(fetchCtx, m)
+		if err != nil {
+			slog.Warn("probe failed, full crawl", "path", path, "err", err)
+		} else if !changed {
+			slog.Info("upstream unchanged, crawl skipped", "path", path, "run", m.Schedule.LastRun())
+			m.Schedule.MarkUnchanged()
+			c.FetchDone(path)
+			return
+		}
+	}
+	// scope rules see the same ancestors as in the full crawl
+	chMap, chPicto := cr.FetchFrom(fetchCtx, path, c.Ancestors(path), 1)
+	// Tee the map channel so we can tell whether the fetch produced a map.
+	// On failure, mark the map so the scheduler applies the failure backoff
+	// and we don't hammer upstream.
+	teedMap := make(chan *mfmap.MfMap)
+	received := 0
+	go func() {
+		defer close(teedMap)
+		for m := range chMap {
+			received++
+			teedMap <- m
+		}
+	}()
+	<-c.Receive(teedMap, chPicto)
+	if received == 0 {
+		c.MarkFailure(path)
 	}
+	c.FetchDone(path)
 }
 
 // shutdownServer attempts a graceful shutdown with a bounded deadline,
@@ -253,7 +394,10 @@ func makeMeteoHandler(mc *content.Meteo) http.Handler {
 	static.Register(mux, appconf.CacheId(), mc.Obs())
 	mux.Handle("/", mc)
 	hdl := withOldUrlRedirect(mux)
+	hdl = ratelimit.New(appconf.RateLimit(), mc.Obs()).Middleware(hdl)
 	hdl = withLogging(hdl)
+	// outermost: client address is resolved once for all inner handlers
+	hdl = clientip.NewResolver(appconf.TrustedProxies(), appconf.ProxyHeader()).Middleware(hdl)
 	return hdl
 }
 
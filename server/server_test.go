@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"gometeo/appconf"
 	"gometeo/content"
 	"gometeo/mfmap"
 )
@@ -98,3 +99,13 @@ func TestHealthzReady(t *testing.T) {
 		t.Errorf("healthz status = %d, want %d", resp.StatusCode, http.StatusOK)
 	}
 }
+
+func TestMapConfRates(t *testing.T) {
+	want := appconf.UpdateRate()
+	if want.BudgetStretch <= 1 {
+		t.Fatalf("default BudgetStretch = %v, want a stretch", want.BudgetStretch)
+	}
+	if got := mapConf().Rates; got != want {
+		t.Errorf("mapConf().Rates = %+v, want %+v", got, want)
+	}
+}
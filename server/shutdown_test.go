@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"gometeo/content"
 )
 
 // TestShutdownServerGraceful verifies that shutdownServer waits for an
@@ -90,9 +92,9 @@ func TestUpdateLoopExitsOnContextCancel(t *testing.T) {
 	loopDone := make(chan struct{})
 	go func() {
 		defer close(loopDone)
-		// nil crawler and nil content are safe because ctx is cancelled
-		// before the first ticker fires — neither is dereferenced.
-		runUpdateLoop(ctx, sconf, nil, nil, initDone)
+		// nil crawler is safe because the update queue is empty
+		// and ctx is cancelled before any map is due.
+		runUpdateLoop(ctx, sconf, nil, content.New(contentConf(nil)), initDone)
 	}()
 
 	cancel()
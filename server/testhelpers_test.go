@@ -26,6 +26,7 @@ const testDataDir = "../test_data/"
 func testServerConf() ServerConf {
 	return ServerConf{
 		FetchInterval:   50 * time.Millisecond,
+		FetchWorkers:    2,
 		FetchTimeout:    2 * time.Second,
 		ShutdownTimeout: 1 * time.Second,
 	}
@@ -214,7 +214,7 @@ export const TopNav = {
 
   template: /*html*/`
 <nav class="topnav">
-  <a v-for="item in breadcrumb" :href="item.path">{{item.nom}}</a>
+  <a v-for="item in breadcrumb" :href="'/' + item.path">{{item.nom}}</a>
   <div class="spacer"></div>
  <!-- <a class="no-mobile" href="/about">A propos</a> -->
 </nav>`
@@ -441,7 +441,7 @@ export const MapComponent = {
                 layer.closePopup()
               }),
               layer.on("click", function () {
-                window.location = path
+                window.location = '/' + path
               })
           }
         }
@@ -488,6 +488,9 @@ export const MapComponent = {
     function createMarker(poi, idx, all_pois) {
       const prev = poi.prev        // alias
 
+      // missing values are null in json data
+      const round = (v) => (v == null ? '-' : Math.round(v))
+
       // prepare marker data for current poi
       const m = {
         title: poi.titre,
@@ -498,14 +501,14 @@ export const MapComponent = {
         txt: "",
         icon: prev.weather_icon,
         desc: prev.weather_description,
-        Tmin: Math.round(prev.T_min),
-        Tmax: Math.round(prev.T_max),
+        Tmin: round(prev.T_min),
+        Tmax: round(prev.T_max),
       }
 
       // représentation variable de la temperature selon prev.long_terme
       if (!prev.long_terme) {
         // donnée court-terme en priorité si disponibles
-        m.txt = Math.round(prev.T) + '°'
+        m.txt = round(prev.T) + '°'
       } else {
         m.txt = ` <span class="tmin">${m.Tmin}°</span>/<span class="tmax">${m.Tmax}°</span>`
         m.icon_text_style = 'font-size: 12px;'
@@ -566,13 +569,13 @@ export const MapComponent = {
         let hr_unit = "%";
         // représentation variable court-terme / long-terme
         if (!prev.long_terme) {
-          m.txt = Math.round(prev.relative_humidity) + hr_unit
+          m.txt = round(prev.relative_humidity) + hr_unit
         } else {
           m.txt = `
           <span class="hr_min">
-            ${Math.round(prev.relative_humidity_min)}${hr_unit}
+            ${round(prev.relative_humidity_min)}${hr_unit}
           </span>/<span class="hr_max">
-            ${Math.round(prev.relative_humidity_max)}${hr_unit}
+            ${round(prev.relative_humidity_max)}${hr_unit}
           </span>`
           m.icon_text_style = "font-size: 12px;"
         }
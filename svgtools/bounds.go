@@ -0,0 +1,164 @@
+package svgtools
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// box is an axis-aligned bounding box, ok is false when unknown
+type box struct {
+	x0, y0, x1, y1 float64
+	ok             bool
+}
+
+func (b *box) add(x, y float64) {
+	if !b.ok {
+		*b = box{x, y, x, y, true}
+		return
+	}
+	b.x0, b.y0 = min(b.x0, x), min(b.y0, y)
+	b.x1, b.y1 = max(b.x1, x), max(b.y1, y)
+}
+
+func (b box) overlaps(o box) bool {
+	return b.x0 <= o.x1 && o.x0 <= b.x1 && b.y0 <= o.y1 && o.y0 <= b.y1
+}
+
+// shapeBounds returns a box containing the geometry of a basic shape, not
+// ok for other elements or unparsable attributes
+func shapeBounds(e *etree.Element) box {
+	num := func(key string) (float64, bool) {
+		f, err := strconv.ParseFloat(e.SelectAttrValue(key, "0"), 64)
+		return f, err == nil
+	}
+	nums := func(keys ...string) ([]float64, bool) {
+		fs := make([]float64, len(keys))
+		for i, k := range keys {
+			f, ok := num(k)
+			if !ok {
+				return nil, false
+			}
+			fs[i] = f
+		}
+		return fs, true
+	}
+	var b box
+	switch e.Tag {
+	case "path":
+		return pathBounds(e.SelectAttrValue("d", ""))
+	case "polygon", "polyline":
+		return pointsBounds(e.SelectAttrValue("points", ""))
+	case "rect":
+		if f, ok := nums("x", "y", "width", "height"); ok {
+			b.add(f[0], f[1])
+			b.add(f[0]+f[2], f[1]+f[3])
+		}
+	case "line":
+		if f, ok := nums("x1", "y1", "x2", "y2"); ok {
+			b.add(f[0], f[1])
+			b.add(f[2], f[3])
+		}
+	case "circle":
+		if f, ok := nums("cx", "cy", "r"); ok {
+			b.add(f[0]-f[2], f[1]-f[2])
+			b.add(f[0]+f[2], f[1]+f[2])
+		}
+	case "ellipse":
+		if f, ok := nums("cx", "cy", "rx", "ry"); ok {
+			b.add(f[0]-f[2], f[1]-f[3])
+			b.add(f[0]+f[2], f[1]+f[3])
+		}
+	}
+	return b
+}
+
+func pointsBounds(points string) box {
+	var b box
+	f, ok := parseNumbers(points)
+	if !ok || len(f)%2 != 0 {
+		return box{}
+	}
+	for i := 0; i < len(f); i += 2 {
+		b.add(f[i], f[i+1])
+	}
+	return b
+}
+
+func parseNumbers(s string) ([]float64, bool) {
+	var fs []float64
+	for _, n := range reNumber.FindAllString(s, -1) {
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return nil, false
+		}
+		fs = append(fs, f)
+	}
+	return fs, true
+}
+
+var rePathToken = regexp.MustCompile(`[MmLlHhVvCcSsQqTtAaZz]|[-+]?(?:\d*\.\d+|\d+\.?)(?:[eE][-+]?\d+)?`)
+
+// parameters of path commands
+var pathArgs = map[byte]int{'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'S': 4, 'Q': 4, 'T': 2, 'Z': 0}
+
+// pathBounds returns a box containing the points and control points of
+// path data, which contains the path. Not ok for arcs, whose compact flag
+// syntax is ambiguous, or malformed data.
+func pathBounds(d string) box {
+	var b box
+	var x, y, sx, sy float64 // current point, subpath start
+	tokens := rePathToken.FindAllString(d, -1)
+	for i := 0; i < len(tokens); {
+		cmd := tokens[i][0]
+		upper := strings.ToUpper(tokens[i])[0]
+		n, known := pathArgs[upper]
+		if !known {
+			return box{} // arc or number without command
+		}
+		i++
+		if n == 0 {
+			x, y = sx, sy
+			continue
+		}
+		rel := cmd != upper
+		// a command repeats while numbers follow, M continues with L
+		for first := true; first || (i < len(tokens) && !isPathCommand(tokens[i])); first = false {
+			if i+n > len(tokens) {
+				return box{}
+			}
+			f, ok := parseNumbers(strings.Join(tokens[i:i+n], " "))
+			if !ok || len(f) != n {
+				return box{}
+			}
+			i += n
+			ox, oy := 0.0, 0.0
+			if rel {
+				ox, oy = x, y
+			}
+			switch upper {
+			case 'H':
+				x = f[0] + ox
+			case 'V':
+				y = f[0] + oy
+			default:
+				for j := 0; j+1 < n; j += 2 {
+					b.add(f[j]+ox, f[j+1]+oy)
+				}
+				x, y = f[n-2]+ox, f[n-1]+oy
+			}
+			b.add(x, y)
+			if upper == 'M' && first {
+				sx, sy = x, y
+			}
+		}
+	}
+	return b
+}
+
+func isPathCommand(tok string) bool {
+	c := tok[0]
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
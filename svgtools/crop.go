@@ -52,6 +52,21 @@ func (sz Size) Crop(cr CropRatio) Size {
 	}
 }
 
+// Ratio returns the crop ratio turning the viewbox of sz into vb. Crop
+// rounds to whole units, Ratio tells the crop it actually applied.
+func (sz Size) Ratio(vb Viewbox) CropRatio {
+	w, h := float64(sz.Viewbox[2]), float64(sz.Viewbox[3])
+	if w <= 0 || h <= 0 {
+		return CropRatio{}
+	}
+	return CropRatio{
+		Left:   float64(vb[0]-sz.Viewbox[0]) / w,
+		Right:  float64(sz.Viewbox[0]+sz.Viewbox[2]-vb[0]-vb[2]) / w,
+		Top:    float64(vb[1]-sz.Viewbox[1]) / h,
+		Bottom: float64(sz.Viewbox[1]+sz.Viewbox[3]-vb[1]-vb[3]) / h,
+	}
+}
+
 func (doc *Tree) GetSize() (sz Size, err error) {
 	// get root element
 	root, err := doc.getRoot()
@@ -68,3 +68,25 @@ func TestPxToInt(t *testing.T) {
 		})
 	}
 }
+
+func TestCropRatio(t *testing.T) {
+	sz := Size{Width: 1000, Height: 500, Viewbox: Viewbox{100, 0, 1000, 500}}
+	tests := []struct {
+		cr   CropRatio
+		want Viewbox
+	}{
+		{CropRatio{}, Viewbox{100, 0, 1000, 500}},
+		{CropRatio{Left: 0.2, Right: 0.08, Top: 0.08, Bottom: 0.08}, Viewbox{300, 40, 720, 420}},
+		{CropRatio{Left: 0.1234, Right: 0.3, Top: 0.0011, Bottom: 0.5}, Viewbox{223, 0, 576, 249}},
+	}
+	for _, tc := range tests {
+		got := sz.Crop(tc.cr)
+		if got.Viewbox != tc.want {
+			t.Errorf("Crop(%+v) = %v, want %v", tc.cr, got.Viewbox, tc.want)
+		}
+		// the ratio actually applied crops to the same viewbox
+		if again := sz.Crop(sz.Ratio(got.Viewbox)); again.Viewbox != got.Viewbox {
+			t.Errorf("Crop(Ratio(%v)) = %v", got.Viewbox, again.Viewbox)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package svgtools
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// OptimizeConf holds the settings of an optimization pass
+type OptimizeConf struct {
+	Precision int // decimals kept in coordinates, negative keeps them all
+}
+
+// OptimizeReport tells what an optimization pass saved
+type OptimizeReport struct {
+	Before  int // size of the input, in bytes
+	After   int // size of the output, in bytes
+	Removed int // elements removed
+}
+
+// Saved returns the bytes saved by the pass
+func (r OptimizeReport) Saved() int {
+	return r.Before - r.After
+}
+
+// editor namespaces kept by Optimize, others are metadata
+var keptNamespaces = map[string]bool{"": true, "xlink": true, "xml": true}
+
+// containers of elements not rendered by themselves, left alone by culling
+var nonRendered = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "symbol": true,
+	"pattern": true, "marker": true, "linearGradient": true, "radialGradient": true,
+	"filter": true,
+}
+
+// attributes holding coordinates or lengths, rounded by Optimize
+var numericAttrs = map[string]bool{
+	"d": true, "points": true, "x": true, "y": true, "x1": true, "y1": true,
+	"x2": true, "y2": true, "cx": true, "cy": true, "r": true, "rx": true,
+	"ry": true, "width": true, "height": true, "stroke-width": true,
+}
+
+// elements where whitespace is content
+var textElements = map[string]bool{"text": true, "tspan": true, "textPath": true, "style": true}
+
+// cullMargin is the share of the viewBox added around it before dropping
+// elements outside, so that strokes of shapes just outside still show
+const cullMargin = 0.02
+
+var (
+	reNumber     = regexp.MustCompile(`[-+]?(?:\d*\.\d+|\d+\.?)(?:[eE][-+]?\d+)?`)
+	reSpaces     = regexp.MustCompile(`\s+`)
+	reDisplayOff = regexp.MustCompile(`(?:^|;)\s*display\s*:\s*none\s*(?:;|$)`)
+	reRefs       = regexp.MustCompile(`url\(\s*['"]?#([^)'"\s]+)['"]?\s*\)`)
+)
+
+// Optimize removes from doc what does not change its rendering: comments,
+// doctype, metadata and editor elements and attributes, hidden elements,
+// shapes fully outside the root viewBox and unused defs. Coordinates are
+// rounded to conf.Precision decimals and whitespace is minified.
+// Returns the number of elements removed.
+func (doc *Tree) Optimize(conf OptimizeConf) int {
+	d := (*etree.Document)(doc)
+	for _, t := range append([]etree.Token(nil), d.Child...) {
+		switch t := t.(type) {
+		case *etree.Comment, *etree.Directive:
+			d.RemoveChild(t)
+		case *etree.ProcInst:
+			if t.Target != "xml" {
+				d.RemoveChild(t)
+			}
+		case *etree.CharData:
+			d.RemoveChild(t)
+		}
+	}
+	root := d.Root()
+	if root == nil {
+		return 0
+	}
+	removed := stripElements(root)
+	if vb, err := (*Root)(root).getViewbox(); err == nil {
+		removed += cullOutside(root, vb)
+	}
+	removed += dropUnusedDefs(root)
+	minify(root, root, conf.Precision)
+	return removed
+}
+
+// OptimizeBytes parses img, optimizes it with conf and serializes it back
+func OptimizeBytes(img []byte, conf OptimizeConf) ([]byte, OptimizeReport, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(img); err != nil {
+		return nil, OptimizeReport{}, err
+	}
+	removed := (*Tree)(doc).Optimize(conf)
+	out, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, OptimizeReport{}, err
+	}
+	return out, OptimizeReport{Before: len(img), After: len(out), Removed: removed}, nil
+}
+
+// stripElements removes comments, metadata, editor and hidden elements
+// below e, and editor attributes of e and its descendants
+func stripElements(e *etree.Element) int {
+	removed := 0
+	for _, t := range append([]etree.Token(nil), e.Child...) {
+		switch t := t.(type) {
+		case *etree.Comment, *etree.ProcInst, *etree.Directive:
+			e.RemoveChild(t)
+		case *etree.Element:
+			if t.Tag == "metadata" || !keptNamespaces[t.Space] || isHidden(t) {
+				e.RemoveChild(t)
+				removed += 1 + len(t.FindElements(".//*"))
+				continue
+			}
+			removed += stripElements(t)
+		}
+	}
+	attrs := e.Attr[:0]
+	for _, a := range e.Attr {
+		switch {
+		case a.Space == "xmlns" && a.Key != "xlink":
+		case !keptNamespaces[a.Space] && a.Space != "xmlns":
+		default:
+			attrs = append(attrs, a)
+		}
+	}
+	e.Attr = attrs
+	return removed
+}
+
+func isHidden(e *etree.Element) bool {
+	return e.SelectAttrValue("display", "") == "none" ||
+		reDisplayOff.MatchString(e.SelectAttrValue("style", ""))
+}
+
+// cullOutside removes the shapes below e lying fully outside vb, and the
+// groups left empty. Transformed elements are kept.
+func cullOutside(e *etree.Element, vb Viewbox) int {
+	mx, my := cullMargin*float64(vb[2]), cullMargin*float64(vb[3])
+	view := box{
+		x0: float64(vb[0]) - mx, y0: float64(vb[1]) - my,
+		x1: float64(vb[0]+vb[2]) + mx, y1: float64(vb[1]+vb[3]) + my,
+		ok: true,
+	}
+	var walk func(e *etree.Element) int
+	walk = func(e *etree.Element) int {
+		removed := 0
+		for _, c := range e.ChildElements() {
+			if nonRendered[c.Tag] || c.SelectAttr("transform") != nil {
+				continue
+			}
+			if c.Tag == "g" {
+				removed += walk(c)
+				if len(c.ChildElements()) == 0 && c.SelectAttr("id") == nil {
+					e.RemoveChild(c)
+					removed++
+				}
+				continue
+			}
+			if b := shapeBounds(c); b.ok && !b.overlaps(view) {
+				e.RemoveChild(c)
+				removed++
+			}
+		}
+		return removed
+	}
+	return walk(e)
+}
+
+// dropUnusedDefs removes the children of <defs> never referenced with
+// url(#id) or href="#id", until none is left
+func dropUnusedDefs(root *etree.Element) int {
+	removed := 0
+	for {
+		refs := make(map[string]bool)
+		for _, e := range append(root.FindElements(".//*"), root) {
+			for _, a := range e.Attr {
+				if a.Key == "href" && strings.HasPrefix(a.Value, "#") {
+					refs[a.Value[1:]] = true
+				}
+				for _, m := range reRefs.FindAllStringSubmatch(a.Value, -1) {
+					refs[m[1]] = true
+				}
+			}
+			if e.Tag == "style" {
+				for _, m := range reRefs.FindAllStringSubmatch(e.Text(), -1) {
+					refs[m[1]] = true
+				}
+			}
+		}
+		n := 0
+		for _, defs := range root.FindElements(".//defs") {
+			for _, c := range defs.ChildElements() {
+				if c.Tag == "style" || refs[c.SelectAttrValue("id", "")] {
+					continue
+				}
+				defs.RemoveChild(c)
+				n += 1 + len(c.FindElements(".//*"))
+			}
+			if len(defs.ChildElements()) == 0 {
+				defs.Parent().RemoveChild(defs)
+				n++
+			}
+		}
+		if n == 0 {
+			return removed
+		}
+		removed += n
+	}
+}
+
+// minify rounds coordinates, collapses whitespace in attributes and
+// removes whitespace between elements
+func minify(e, root *etree.Element, precision int) {
+	for i := range e.Attr {
+		a := &e.Attr[i]
+		v := strings.TrimSpace(reSpaces.ReplaceAllString(a.Value, " "))
+		switch {
+		case e == root || a.Space != "" || !numericAttrs[a.Key] || precision < 0:
+		case a.Key == "d":
+			v = roundPath(v, precision)
+		default:
+			v = roundNumbers(v, precision)
+		}
+		a.Value = v
+	}
+	if textElements[e.Tag] {
+		return
+	}
+	for _, t := range append([]etree.Token(nil), e.Child...) {
+		switch t := t.(type) {
+		case *etree.CharData:
+			if strings.TrimSpace(t.Data) == "" {
+				e.RemoveChild(t)
+			}
+		case *etree.Element:
+			minify(t, root, precision)
+		}
+	}
+}
+
+// roundNumbers rounds the numbers of s to precision decimals, keeping
+// them apart when they were only separated by a dot, as in "M1.5.5"
+func roundNumbers(s string, precision int) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range reNumber.FindAllStringIndex(s, -1) {
+		sb.WriteString(s[last:loc[0]])
+		n := formatNumber(s[loc[0]:loc[1]], precision)
+		if loc[0] == last && last > 0 && n[0] != '-' && isNumberEnd(s[last-1]) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(n)
+		last = loc[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// roundPath rounds path data d to precision decimals. Relative coordinates
+// are rounded against the rounded current point, so that rounding errors
+// do not add up along the path. Paths with arcs or malformed data are
+// returned unchanged.
+func roundPath(d string, precision int) string {
+	if strings.Trim(rePathToken.ReplaceAllString(d, ""), " ,\t\n\r") != "" {
+		return d
+	}
+	var sb strings.Builder
+	write := func(f float64) {
+		n := formatNumber(strconv.FormatFloat(f, 'g', -1, 64), precision)
+		if sb.Len() > 0 && n[0] != '-' && isNumberEnd(sb.String()[sb.Len()-1]) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(n)
+	}
+	p := math.Pow10(precision)
+	round := func(f float64) float64 { return math.Round(f*p) / p }
+
+	// current point and subpath start, exact and as rounded in the output
+	var x, y, sx, sy, rx, ry, rsx, rsy float64
+	tokens := rePathToken.FindAllString(d, -1)
+	for i := 0; i < len(tokens); {
+		cmd := tokens[i][0]
+		upper := strings.ToUpper(tokens[i])[0]
+		n, known := pathArgs[upper]
+		if !known {
+			return d // arc or number without command
+		}
+		sb.WriteByte(cmd)
+		i++
+		if n == 0 {
+			x, y, rx, ry = sx, sy, rsx, rsy
+			continue
+		}
+		rel := cmd != upper
+		for first := true; first || (i < len(tokens) && !isPathCommand(tokens[i])); first = false {
+			if i+n > len(tokens) {
+				return d
+			}
+			f, ok := parseNumbers(strings.Join(tokens[i:i+n], " "))
+			if !ok || len(f) != n {
+				return d
+			}
+			i += n
+			// absolute coordinates, then written against the rounded point
+			ox, oy, rox, roy := 0.0, 0.0, 0.0, 0.0
+			if rel {
+				ox, oy, rox, roy = x, y, rx, ry
+			}
+			switch upper {
+			case 'H':
+				x = f[0] + ox
+				write(round(x) - rox)
+				rx = round(x)
+			case 'V':
+				y = f[0] + oy
+				write(round(y) - roy)
+				ry = round(y)
+			default:
+				for j := 0; j+1 < n; j += 2 {
+					write(round(f[j]+ox) - rox)
+					write(round(f[j+1]+oy) - roy)
+				}
+				x, y = f[n-2]+ox, f[n-1]+oy
+				rx, ry = round(x), round(y)
+			}
+			if upper == 'M' && first {
+				sx, sy, rsx, rsy = x, y, rx, ry
+			}
+		}
+	}
+	return sb.String()
+}
+
+func isNumberEnd(c byte) bool {
+	return c == '.' || (c >= '0' && c <= '9')
+}
+
+// formatNumber rounds a number to precision decimals without trailing zeros
+func formatNumber(num string, precision int) string {
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return num
+	}
+	p := math.Pow10(precision)
+	f = math.Round(f*p) / p
+	if f == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
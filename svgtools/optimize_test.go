@@ -0,0 +1,157 @@
+package svgtools_test
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+
+	svt "gometeo/svgtools"
+)
+
+func optimize(t *testing.T, src string, precision int) (string, int) {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(src); err != nil {
+		t.Fatal(err)
+	}
+	removed := (*svt.Tree)(doc).Optimize(svt.OptimizeConf{Precision: precision})
+	out, err := doc.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, removed
+}
+
+func TestOptimize(t *testing.T) {
+	const head = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100">`
+	tests := []struct {
+		name      string
+		src       string
+		precision int
+		want      string
+		removed   int
+	}{
+		{
+			name: "comments and metadata",
+			src: `<?xml version="1.0"?><!-- editor --><!DOCTYPE svg>` + "\n" +
+				`<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" viewBox="0 0 100 100" inkscape:version="1.2">` +
+				`<metadata><title>map</title></metadata><inkscape:grid/><!-- c --><rect width="10" height="10"/></svg>`,
+			precision: 1,
+			want:      `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect width="10" height="10"/></svg>`,
+			removed:   3,
+		},
+		{
+			name:      "hidden elements",
+			src:       head + `<g display="none"><rect/></g><rect style="fill:red; display: none"/><rect width="1" height="1"/></svg>`,
+			precision: 1,
+			want:      head + `<rect width="1" height="1"/></svg>`,
+			removed:   3,
+		},
+		{
+			name: "unused defs",
+			src: head + `<defs><linearGradient id="base"><stop offset="0"/></linearGradient>` +
+				`<linearGradient id="used" href="#base"/><linearGradient id="chained" href="#unused"/>` +
+				`<linearGradient id="unused"/></defs><path d="M0 0h10" fill="url(#used)"/></svg>`,
+			precision: 1,
+			want: head + `<defs><linearGradient id="base"><stop offset="0"/></linearGradient>` +
+				`<linearGradient id="used" href="#base"/></defs><path d="M0 0h10" fill="url(#used)"/></svg>`,
+			removed: 2,
+		},
+		{
+			name:      "all defs unused",
+			src:       head + `<defs><clipPath id="c"><rect/></clipPath></defs><circle r="5"/></svg>`,
+			precision: 1,
+			want:      head + `<circle r="5"/></svg>`,
+			removed:   3,
+		},
+		{
+			name:      "rounding",
+			src:       head + `<path d="M1.04.55L10.449 -20.96e-1 z" stroke-width="0.25" opacity="0.55"/><circle cx="3.333" cy="0.04" r="1"/></svg>`,
+			precision: 1,
+			want:      head + `<path d="M1 0.6L10.4-2.1z" stroke-width="0.3" opacity="0.55"/><circle cx="3.3" cy="0" r="1"/></svg>`,
+		},
+		{
+			name:      "relative path rounded against the rounded point",
+			src:       head + `<path d="m1.04 1.04 l0.14 0.14 0.14 0.14 h0.14 z l0.14 0"/></svg>`,
+			precision: 1,
+			want:      head + `<path d="m1 1l0.2 0.2 0.1 0.1h0.2zl0.2 0"/></svg>`,
+		},
+		{
+			name:      "arcs left unrounded",
+			src:       head + `<path d="M1.04 1.04 a1.5 1.5 0 0 1 2.25 2.25"/></svg>`,
+			precision: 1,
+			want:      head + `<path d="M1.04 1.04 a1.5 1.5 0 0 1 2.25 2.25"/></svg>`,
+		},
+		{
+			name:      "numbers split by a dot",
+			src:       head + `<path d="M1.5.5l.25.04"/></svg>`,
+			precision: 0,
+			want:      head + `<path d="M2 1l0 0"/></svg>`,
+		},
+		{
+			name:      "rounding disabled",
+			src:       head + `<circle cx="3.333" r="1"/></svg>`,
+			precision: -1,
+			want:      head + `<circle cx="3.333" r="1"/></svg>`,
+		},
+		{
+			name: "outside viewbox",
+			src: head + `<path d="M120 0l10 10"/><path d="m90 90l20 20"/><g><rect x="-50" y="0" width="10" height="10"/></g>` +
+				`<g transform="translate(200)"><rect x="-150" width="10" height="10"/></g><circle cx="150" cy="150" r="60"/>` +
+				`<polygon points="200,0 210,0 210,10"/><path d="M200 0a10 10 0 0 1 10 10"/><text x="500">t</text></svg>`,
+			precision: 1,
+			want: head + `<path d="m90 90l20 20"/><g transform="translate(200)"><rect x="-150" width="10" height="10"/></g>` +
+				`<circle cx="150" cy="150" r="60"/><path d="M200 0a10 10 0 0 1 10 10"/><text x="500">t</text></svg>`,
+			removed: 4,
+		},
+		{
+			name:      "whitespace",
+			src:       head + "\n  <g class=\" a\n b \">\n    <text> two  words </text>\n  </g>\n</svg>\n",
+			precision: 1,
+			want:      head + `<g class="a b"><text> two  words </text></g></svg>`,
+		},
+	}
+	for _, tc := range tests {
+		got, removed := optimize(t, tc.src, tc.precision)
+		if got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+		if removed != tc.removed {
+			t.Errorf("%s: %d elements removed, want %d", tc.name, removed, tc.removed)
+		}
+	}
+}
+
+func TestOptimizeLongRelativePath(t *testing.T) {
+	src := `<svg xmlns="http://www.w3.org/2000/svg"><path d="M0 0` + strings.Repeat(" l0.14 0.14", 2000) + `"/></svg>`
+	got, _ := optimize(t, src, 1)
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(got); err != nil {
+		t.Fatal(err)
+	}
+	d := doc.FindElement("//path").SelectAttrValue("d", "")
+	// sum relative moves, the end point must not drift from 280, 280
+	var x, y float64
+	for _, seg := range strings.Split(d, "l")[1:] {
+		var dx, dy float64
+		if _, err := fmt.Sscanf(seg, "%g %g", &dx, &dy); err != nil {
+			t.Fatalf("segment %q: %v", seg, err)
+		}
+		x, y = x+dx, y+dy
+	}
+	if math.Abs(x-280) > 0.05 || math.Abs(y-280) > 0.05 {
+		t.Errorf("end point = %.2f, %.2f, want 280, 280", x, y)
+	}
+}
+
+func TestOptimizeReport(t *testing.T) {
+	src := strings.Repeat(" ", 10) + `<svg xmlns="http://www.w3.org/2000/svg"/>`
+	got, _ := optimize(t, src, 1)
+	r := svt.OptimizeReport{Before: len(src), After: len(got)}
+	if r.Saved() != 10 {
+		t.Errorf("saved %d bytes, want 10", r.Saved())
+	}
+}
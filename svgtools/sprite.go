@@ -0,0 +1,129 @@
+package svgtools
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	xmlns      = "http://www.w3.org/2000/svg"
+	xmlnsXlink = "http://www.w3.org/1999/xlink"
+
+	// spriteIdSep joins a symbol id and the ids of its content,
+	// it is not allowed in picto names so namespaced ids never collide
+	spriteIdSep = "."
+)
+
+// root attributes not carried over to symbols, viewBox is handled apart
+var spriteDroppedAttrs = map[string]bool{
+	"version": true, "x": true, "y": true, "width": true, "height": true,
+	"id": true, xmlViewbox: true, "enable-background": true,
+}
+
+// Sprite merges svg pictos into a sprite sheet of <symbol id="name">
+// elements, in name order, referenced with <use href="sprite.svg#name">.
+// Ids inside a picto are prefixed with its name, and references to them
+// updated, so that they don't collide with other pictos.
+// Pictos that cannot be parsed are skipped and reported in the error,
+// the sprite of the others is returned anyway.
+func Sprite(pictos map[string][]byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	sheet := doc.CreateElement(xmlRoot)
+	sheet.CreateAttr("xmlns", xmlns)
+	sheet.CreateAttr("xmlns:xlink", xmlnsXlink)
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(pictos)) {
+		sym, err := spriteSymbol(name, pictos[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("picto '%s': %w", name, err))
+			continue
+		}
+		sheet.AddChild(sym)
+	}
+	b, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return b, errors.Join(errs...)
+}
+
+// spriteSymbol converts the svg document of a picto into a <symbol>
+func spriteSymbol(name string, img []byte) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(img); err != nil {
+		return nil, err
+	}
+	src := doc.Root()
+	if src == nil || src.Tag != xmlRoot {
+		return nil, fmt.Errorf("<svg> root element not found")
+	}
+	sym := etree.NewElement("symbol")
+	sym.CreateAttr("id", name)
+	vb := src.SelectAttrValue(xmlViewbox, "")
+	if vb == "" {
+		// viewBox defaults to the picto size
+		w, errW := parsePx([]byte(src.SelectAttrValue(xmlWidth, "")))
+		h, errH := parsePx([]byte(src.SelectAttrValue(xmlHeight, "")))
+		if errW != nil || errH != nil {
+			return nil, fmt.Errorf("no viewBox nor width and height in px")
+		}
+		vb = Viewbox{0, 0, w, h}.String()
+	}
+	sym.CreateAttr(xmlViewbox, vb)
+	for _, a := range src.Attr {
+		if a.Space == "xmlns" || a.Key == "xmlns" || spriteDroppedAttrs[a.FullKey()] {
+			continue
+		}
+		sym.CreateAttr(a.FullKey(), a.Value)
+	}
+
+	namespaceIds(name, src)
+	for _, c := range slices.Clone(src.Child) {
+		sym.AddChild(c)
+	}
+	return sym, nil
+}
+
+// namespaceIds prefixes the ids of the descendants of root with prefix,
+// and updates '#id' and 'url(#id)' references in attributes and <style>
+func namespaceIds(prefix string, root *etree.Element) {
+	elems := root.FindElements(".//*")
+	ids := make(map[string]string)
+	for _, e := range elems {
+		if a := e.SelectAttr("id"); a != nil && a.Value != "" {
+			ids[a.Value] = prefix + spriteIdSep + a.Value
+			a.Value = ids[a.Value]
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	replacer := make([]string, 0, 4*len(ids))
+	for _, old := range slices.Sorted(maps.Keys(ids)) {
+		replacer = append(replacer, "url(#"+old+")", "url(#"+ids[old]+")")
+		replacer = append(replacer, "url('#"+old+"')", "url('#"+ids[old]+"')")
+	}
+	urls := strings.NewReplacer(replacer...)
+	for _, e := range elems {
+		for i := range e.Attr {
+			a := &e.Attr[i]
+			if a.Key == "href" && strings.HasPrefix(a.Value, "#") {
+				if id, ok := ids[a.Value[1:]]; ok {
+					a.Value = "#" + id
+				}
+				continue
+			}
+			a.Value = urls.Replace(a.Value)
+		}
+		if e.Tag == "style" {
+			e.SetText(urls.Replace(e.Text()))
+		}
+	}
+}
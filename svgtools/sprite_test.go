@@ -0,0 +1,85 @@
+package svgtools_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+
+	svt "gometeo/svgtools"
+)
+
+const spriteSun = `<?xml version="1.0" encoding="UTF-8"?>
+<svg version="1.1" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="32px" height="32px" viewBox="0 0 32 32" fill="none">
+<defs><linearGradient id="a"><stop offset="0"/></linearGradient><clipPath id="ab"><rect width="32" height="32"/></clipPath></defs>
+<circle id="disc" cx="16" cy="16" r="8" fill="url(#a)" clip-path="url(#ab)"/>
+<use xlink:href="#disc" x="2"/>
+</svg>`
+
+// same ids as spriteSun, no viewBox
+const spriteCloud = `<svg xmlns="http://www.w3.org/2000/svg" width="24px" height="16px">
+<defs><linearGradient id="a"/></defs>
+<style>.c { fill: url(#a); }</style>
+<path class="c" d="M0 0h24v16z"/><use href="#a"/>
+</svg>`
+
+func TestSprite(t *testing.T) {
+	pictos := map[string][]byte{
+		"p2n":    []byte(spriteCloud),
+		"p1j":    []byte(spriteSun),
+		"broken": []byte("<svg><circle>"),
+		"nosize": []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`),
+	}
+	b, err := svt.Sprite(pictos)
+	if err == nil || !strings.Contains(err.Error(), "broken") || !strings.Contains(err.Error(), "nosize") {
+		t.Errorf("Sprite() error = %v, want broken and nosize pictos reported", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(b); err != nil {
+		t.Fatalf("sprite is not valid xml: %v\n%s", err, b)
+	}
+	syms := doc.FindElements("/svg/symbol")
+	if len(syms) != 2 || syms[0].SelectAttrValue("id", "") != "p1j" || syms[1].SelectAttrValue("id", "") != "p2n" {
+		t.Fatalf("sprite symbols = %s", b)
+	}
+
+	tests := []struct {
+		path string
+		attr string
+		want string
+	}{
+		{"/svg/symbol[@id='p1j']", "viewBox", "0 0 32 32"},
+		{"/svg/symbol[@id='p1j']", "fill", "none"},
+		{"/svg/symbol[@id='p1j']", "width", ""},
+		{"/svg/symbol[@id='p1j']//linearGradient", "id", "p1j.a"},
+		{"/svg/symbol[@id='p1j']//clipPath", "id", "p1j.ab"},
+		{"/svg/symbol[@id='p1j']//circle", "fill", "url(#p1j.a)"},
+		{"/svg/symbol[@id='p1j']//circle", "clip-path", "url(#p1j.ab)"},
+		{"/svg/symbol[@id='p1j']//use", "xlink:href", "#p1j.disc"},
+		{"/svg/symbol[@id='p2n']", "viewBox", "0 0 24 16"},
+		{"/svg/symbol[@id='p2n']//linearGradient", "id", "p2n.a"},
+		{"/svg/symbol[@id='p2n']//use", "href", "#p2n.a"},
+	}
+	for _, tc := range tests {
+		e := doc.FindElement(tc.path)
+		if e == nil {
+			t.Errorf("%s not found", tc.path)
+			continue
+		}
+		if got := e.SelectAttrValue(tc.attr, ""); got != tc.want {
+			t.Errorf("%s @%s = %q, want %q", tc.path, tc.attr, got, tc.want)
+		}
+	}
+	if style := doc.FindElement("//symbol[@id='p2n']/style"); style == nil || !strings.Contains(style.Text(), "url(#p2n.a)") {
+		t.Errorf("style references are not namespaced: %s", b)
+	}
+}
+
+func TestSpriteStable(t *testing.T) {
+	pictos := map[string][]byte{"p1j": []byte(spriteSun), "p2n": []byte(spriteCloud)}
+	a, _ := svt.Sprite(pictos)
+	b, _ := svt.Sprite(pictos)
+	if string(a) != string(b) {
+		t.Error("Sprite() output must not depend on map order")
+	}
+}
@@ -29,6 +29,7 @@ var TestConf = mfmap.MapConf{
 		HotDuration: 72 * time.Hour,
 		HotMaxAge:   60 * time.Minute,
 		ColdMaxAge:  240 * time.Minute,
+		HotVisitors: 1,
 	},
 }
 